@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAIQueueTimeoutSeconds caps the AI queue timeout /admin/settings accepts.
+const maxAIQueueTimeoutSeconds = 600
+
+// adminSettings are the runtime-tunable settings. In an update every field
+// is optional and only those sent are changed; changes last until restart.
+type adminSettings struct {
+	MaxConcurrentAICalls  *int  `json:"max_concurrent_ai_calls,omitempty"`
+	AIQueueTimeoutSeconds *int  `json:"ai_queue_timeout_seconds,omitempty"`
+	AIEnabled             *bool `json:"ai_enabled,omitempty"`
+}
+
+func currentAdminSettings() adminSettings {
+	workers := currentAIWorkers()
+	timeout := int(currentAIQueueTimeout() / time.Second)
+	enabled := atomic.LoadInt32(&aiPaused) == 0
+	return adminSettings{
+		MaxConcurrentAICalls:  &workers,
+		AIQueueTimeoutSeconds: &timeout,
+		AIEnabled:             &enabled,
+	}
+}
+
+// getAdminSettingsHandler shows the settings /admin/settings can change, as
+// they stand now.
+func getAdminSettingsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, currentAdminSettings())
+}
+
+// updateAdminSettingsHandler changes the AI worker count, the AI queue
+// timeout or whether AI analysis runs at all, without a restart. Analyses
+// already waiting on the AI keep the timeout they started with.
+func updateAdminSettingsHandler(c *gin.Context) {
+	logPrefix := fmt.Sprintf("[%s]", c.ClientIP())
+
+	var update adminSettings
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid settings: %s", err.Error())})
+		return
+	}
+	if n := update.MaxConcurrentAICalls; n != nil && (*n < 1 || *n > maxAIWorkers) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid max_concurrent_ai_calls value '%d'. Use a number from 1 to %d.", *n, maxAIWorkers)})
+		return
+	}
+	if seconds := update.AIQueueTimeoutSeconds; seconds != nil && (*seconds < 0 || *seconds > maxAIQueueTimeoutSeconds) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid ai_queue_timeout_seconds value '%d'. Use a number from 0 to %d.", *seconds, maxAIQueueTimeoutSeconds)})
+		return
+	}
+
+	if n := update.MaxConcurrentAICalls; n != nil {
+		if err := resizeAIWorkers(*n); err != nil {
+			log.Printf("%s Admin: could not resize AI workers: %v", logPrefix, err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"code": errCodeInternal, "detail": fmt.Sprintf("Could not change the AI worker count: %s", err.Error())})
+			return
+		}
+		log.Printf("%s Admin: AI workers set to %d", logPrefix, *n)
+	}
+	if seconds := update.AIQueueTimeoutSeconds; seconds != nil {
+		atomic.StoreInt64(&aiQueueTimeoutNanos, int64(time.Duration(*seconds)*time.Second))
+		log.Printf("%s Admin: AI queue timeout set to %ds", logPrefix, *seconds)
+	}
+	if enabled := update.AIEnabled; enabled != nil {
+		paused := int32(1)
+		if *enabled {
+			paused = 0
+		}
+		atomic.StoreInt32(&aiPaused, paused)
+		log.Printf("%s Admin: AI analysis enabled: %t", logPrefix, *enabled)
+	}
+	c.JSON(http.StatusOK, currentAdminSettings())
+}
+
+// adminCleanupHandler runs the temp file cleanup now instead of waiting for
+// the next periodic pass.
+func adminCleanupHandler(c *gin.Context) {
+	if !config.DebugSaveUploads {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"code": errCodeFeatureDisabled, "detail": "Uploads are not saved to disk (DEBUG_SAVE_UPLOADS is off), so there is nothing to clean up."})
+		return
+	}
+	removed, freedBytes, err := cleanupTempFiles(config.TempDirRoot, config.MaxTempFileAge)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": fmt.Sprintf("Temp cleanup failed: %s", err.Error())})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"removed_files": removed, "freed_bytes": freedBytes})
+}
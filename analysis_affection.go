@@ -0,0 +1,183 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	lovePhrasesFile     = "love_phrases.json"
+	petNamesFile        = "pet_names.json"
+	greetingPhrasesFile = "greeting_phrases.json"
+)
+
+var (
+	lovePhrases     []string
+	petNames        []string
+	greetingPhrases []string
+)
+
+// heartEmojis count towards the affection index, one point each.
+var heartEmojis = map[rune]struct{}{
+	'❤': {}, '♥': {}, '💕': {}, '💖': {}, '💗': {}, '💓': {}, '💞': {}, '💘': {}, '💝': {},
+	'💜': {}, '💙': {}, '💚': {}, '💛': {}, '🧡': {}, '🤍': {}, '🖤': {}, '🤎': {}, '🩷': {},
+	'😍': {}, '🥰': {}, '😘': {}, '😚': {}, '💋': {}, '🫶': {},
+}
+
+func init() {
+	loadAffectionData()
+}
+
+func loadAffectionData() {
+	for _, list := range []struct {
+		file    string
+		target  *[]string
+		purpose string
+	}{
+		{lovePhrasesFile, &lovePhrases, "love phrases"},
+		{petNamesFile, &petNames, "pet names"},
+		{greetingPhrasesFile, &greetingPhrases, "greeting phrases"},
+	} {
+		phrases, err := loadLanguagePhrases(filepath.Join(dataDir, list.file))
+		if err != nil {
+			log.Printf("Warning: Failed to load %s: %v. Proceeding without them for the affection index.", list.purpose, err)
+			phrases = []string{}
+		}
+		*list.target = phrases
+	}
+}
+
+// AffectionCounts are heart emojis sent, and messages with an "I love you",
+// a pet name or a good-morning/good-night greeting.
+type AffectionCounts struct {
+	Hearts    int `json:"hearts"`
+	LoveYous  int `json:"love_yous"`
+	PetNames  int `json:"pet_names"`
+	Greetings int `json:"greetings"`
+}
+
+func (a AffectionCounts) total() int {
+	return a.Hearts + a.LoveYous + a.PetNames + a.Greetings
+}
+
+// AffectionPoint is one month of the affection index. Index is the month's
+// affection counts per 100 messages, so a quiet month isn't marked down for
+// being quiet. ResponseTimeMinutes is the month's average reply time, worked
+// out like average_response_time_minutes, for plotting alongside.
+type AffectionPoint struct {
+	Month               string   `json:"month"`
+	Messages            int      `json:"messages"`
+	Index               float64  `json:"index"`
+	ResponseTimeMinutes *float64 `json:"response_time_minutes,omitempty"`
+	AffectionCounts
+}
+
+// AffectionIndex is only computed for two-person chats. MoreAffectionate is
+// whoever scored more per 100 of their own messages.
+type AffectionIndex struct {
+	Monthly          []AffectionPoint           `json:"monthly"`
+	Users            map[string]AffectionCounts `json:"users"`
+	MoreAffectionate *AverageChampion           `json:"more_affectionate,omitempty"`
+}
+
+func countAffection(message string) AffectionCounts {
+	var counts AffectionCounts
+	for _, r := range message {
+		if _, ok := heartEmojis[r]; ok {
+			counts.Hearts++
+		}
+	}
+	lower := strings.ToLower(message)
+	if containsAnyPhrase(lower, lovePhrases) {
+		counts.LoveYous++
+	}
+	if containsAnyPhrase(lower, petNames) {
+		counts.PetNames++
+	}
+	if containsAnyPhrase(lower, greetingPhrases) {
+		counts.Greetings++
+	}
+	return counts
+}
+
+func (a *AffectionCounts) add(other AffectionCounts) {
+	a.Hearts += other.Hearts
+	a.LoveYous += other.LoveYous
+	a.PetNames += other.PetNames
+	a.Greetings += other.Greetings
+}
+
+// calculateAffectionIndex returns nil unless exactly two people wrote in the
+// chat and at least one of them was affectionate.
+func calculateAffectionIndex(messagesData []ParsedMessage, convoBreak time.Duration) *AffectionIndex {
+	type monthCounts struct {
+		messages     int
+		counts       AffectionCounts
+		replySeconds float64
+		replies      int
+	}
+	months := make(map[string]*monthCounts)
+	users := make(map[string]AffectionCounts)
+	messageCounts := make(map[string]int)
+	for i, msg := range messagesData {
+		key := msg.Timestamp.Format("2006-01")
+		month, ok := months[key]
+		if !ok {
+			month = &monthCounts{}
+			months[key] = month
+		}
+		counts := countAffection(msg.OriginalMessage)
+		month.messages++
+		month.counts.add(counts)
+		userCounts := users[msg.Sender]
+		userCounts.add(counts)
+		users[msg.Sender] = userCounts
+		messageCounts[msg.Sender]++
+
+		if i > 0 && messagesData[i-1].Sender != msg.Sender {
+			gap := msg.Timestamp.Sub(messagesData[i-1].Timestamp)
+			if gap <= convoBreak && gap > 5*time.Second && gap < 12*time.Hour {
+				month.replySeconds += gap.Seconds()
+				month.replies++
+			}
+		}
+	}
+	if len(users) != 2 {
+		return nil
+	}
+
+	index := &AffectionIndex{Monthly: make([]AffectionPoint, 0, len(months)), Users: users}
+	total := 0
+	for user, counts := range users {
+		total += counts.total()
+		perHundred := roundFloat(float64(counts.total())*100/float64(messageCounts[user]), 2)
+		index.MoreAffectionate = higherAverage(index.MoreAffectionate, user, perHundred)
+	}
+	if total == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(months))
+	for key := range months {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		month := months[key]
+		point := AffectionPoint{
+			Month:           key,
+			Messages:        month.messages,
+			Index:           roundFloat(float64(month.counts.total())*100/float64(month.messages), 2),
+			AffectionCounts: month.counts,
+		}
+		if month.replies > 0 {
+			minutes := roundFloat(month.replySeconds/float64(month.replies)/60, 2)
+			point.ResponseTimeMinutes = &minutes
+		}
+		index.Monthly = append(index.Monthly, point)
+	}
+	return index
+}
@@ -10,25 +10,47 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/joho/godotenv"
+	"golang.org/x/exp/maps"
 )
 
 const (
-	groqMaxTokens          = 4096
-	groqTemperature        = 1.3
+	defaultGroqModel       = "meta-llama/llama-4-scout-17b-16e-instruct"
+	defaultAITemperature   = 1.3
+	maxAITemperature       = 2.0
+	defaultAIMaxTokens     = 4096
 	retryAttempts          = 2
 	singleRetryWaitSeconds = 5
 	groqAPIEndpoint        = "https://api.groq.com/openai/v1/chat/completions"
 	maxUsersForPeopleBlock = 15
+	promptsDir             = "prompts"
+	defaultPromptProfile   = "gossip"
+	duoPromptSuffix        = "_duo"
+	notesPromptProfile     = "notes"
 )
 
+// aiTones are the prompt profiles a client may pick per request via the tone field.
+var aiTones = []string{"roast", "wholesome", "professional", "gossip"}
+
 var (
-	groqAPIKey string
-	groqModel  string
-	httpClient *http.Client
+	groqAPIKey      string
+	groqAPIKeys     []string
+	groqModel       string
+	aiTemperature   float64
+	aiMaxTokens     int
+	aiAllowedModels []string
+	httpClient      *http.Client
+	promptProfile   string
+	promptTemplates map[string]*template.Template
 )
 
 func init() {
@@ -36,22 +58,189 @@ func init() {
 		log.Println("Warning: Error loading .env file:", err)
 	}
 
+	httpClient = &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	loadAISettings()
+}
+
+// loadAISettings reads the Groq key, model, generation parameters and prompt
+// profile from the environment and parses the prompt templates.
+func loadAISettings() {
 	groqAPIKey = os.Getenv("GROQ_API_KEY")
 	groqModel = os.Getenv("GROQ_MODEL")
 
+	// GROQ_API_KEYS are backups, tried in order when GROQ_API_KEY is
+	// rejected or out of quota.
+	groqAPIKeys = nil
+	for _, key := range append([]string{groqAPIKey}, strings.Split(os.Getenv("GROQ_API_KEYS"), ",")...) {
+		if key = strings.TrimSpace(key); key != "" && !slices.Contains(groqAPIKeys, key) {
+			groqAPIKeys = append(groqAPIKeys, key)
+		}
+	}
+	if len(groqAPIKeys) > 0 {
+		groqAPIKey = groqAPIKeys[0]
+	}
+
 	if groqAPIKey == "" {
 		log.Println("CRITICAL: GROQ_API_KEY not found in environment variables. AI Analysis disabled.")
 	} else {
-		log.Println("Found GROQ_API_KEY for AI Analysis.")
+		log.Printf("Found %d Groq API key(s) for AI Analysis.", len(groqAPIKeys))
 	}
 
 	if groqModel == "" {
-		log.Println("CRITICAL: GROQ_MODEL not found in environment variables. Defaulting to meta-llama/llama-4-scout-17b-16e-instruct.")
-		groqModel = "meta-llama/llama-4-scout-17b-16e-instruct"
+		log.Printf("CRITICAL: GROQ_MODEL not found in environment variables. Defaulting to %s.", defaultGroqModel)
+		groqModel = defaultGroqModel
 	}
 
-	httpClient = &http.Client{
-		Timeout: 30 * time.Second,
+	aiTemperature = defaultAITemperature
+	if raw := strings.TrimSpace(os.Getenv("AI_TEMPERATURE")); raw != "" {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 || value > maxAITemperature {
+			log.Printf("Warning: Invalid AI_TEMPERATURE value '%s'. Using default %.1f.", raw, defaultAITemperature)
+		} else {
+			aiTemperature = value
+		}
+	}
+	aiMaxTokens = defaultAIMaxTokens
+	if raw := strings.TrimSpace(os.Getenv("AI_MAX_TOKENS")); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			log.Printf("Warning: Invalid AI_MAX_TOKENS value '%s'. Using default %d.", raw, defaultAIMaxTokens)
+		} else {
+			aiMaxTokens = value
+		}
+	}
+
+	// AI_ALLOWED_MODELS lists the models a request may ask for with ai_model,
+	// so models can be A/B tested without letting clients pick any model.
+	aiAllowedModels = nil
+	for _, model := range strings.Split(os.Getenv("AI_ALLOWED_MODELS"), ",") {
+		if model = strings.TrimSpace(model); model != "" && model != groqModel {
+			aiAllowedModels = append(aiAllowedModels, model)
+		}
+	}
+
+	promptProfile = strings.ToLower(strings.TrimSpace(os.Getenv("AI_PROMPT_PROFILE")))
+	if promptProfile == "" {
+		promptProfile = defaultPromptProfile
+	}
+
+	var err error
+	promptTemplates, err = loadPromptTemplates(filepath.Join(dataDir, promptsDir))
+	if err != nil {
+		log.Printf("CRITICAL: Failed to load prompt templates: %v. AI Analysis will fail until templates are available.", err)
+		promptTemplates = map[string]*template.Template{}
+	}
+	if _, ok := promptTemplates[promptProfile]; !ok {
+		log.Printf("CRITICAL: Prompt profile '%s' (AI_PROMPT_PROFILE) has no template in %s.", promptProfile, filepath.Join(dataDir, promptsDir))
+	} else {
+		log.Printf("Using AI prompt profile '%s'.", promptProfile)
+	}
+}
+
+// aiSettings is a consistent view of the reloadable AI settings. AI calls
+// outlive a reload, so they take a copy up front instead of holding dataMu.
+type aiSettings struct {
+	// apiKey is the first of apiKeys, or empty when AI is not configured.
+	apiKey        string
+	apiKeys       []string
+	model         string
+	temperature   float64
+	maxTokens     int
+	allowedModels []string
+	profile       string
+	templates     map[string]*template.Template
+}
+
+func currentAISettings() aiSettings {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	return aiSettings{
+		apiKey:        groqAPIKey,
+		apiKeys:       groqAPIKeys,
+		model:         groqModel,
+		temperature:   aiTemperature,
+		maxTokens:     aiMaxTokens,
+		allowedModels: aiAllowedModels,
+		profile:       promptProfile,
+		templates:     promptTemplates,
+	}
+}
+
+// selectableAIModels are the models a request may name in ai_model: the
+// default model first, then AI_ALLOWED_MODELS.
+func (s aiSettings) selectableAIModels() []string {
+	return append([]string{s.model}, s.allowedModels...)
+}
+
+func isAllowedAIModel(model string) bool {
+	for _, m := range currentAISettings().selectableAIModels() {
+		if model == m {
+			return true
+		}
+	}
+	return false
+}
+
+type promptTemplateData struct {
+	UserCount     int
+	ChatName      string
+	IncludePeople bool
+	Animals       string
+	GroupLabel    string
+	Traits        string
+	SavedLinks    string
+	IncludeRoles  bool
+	Roles         string
+	Digest        string
+	Participants  string
+}
+
+func loadPromptTemplates(dir string) (map[string]*template.Template, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list prompt templates in '%s': %w", dir, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no prompt templates found in '%s'", dir)
+	}
+
+	templates := make(map[string]*template.Template, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+		tmpl, err := template.New(name).Option("missingkey=error").ParseFiles(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse prompt template '%s': %w", path, err)
+		}
+		templates[name] = tmpl.Lookup(filepath.Base(path))
+	}
+	log.Printf("Loaded %d prompt templates from %s", len(templates), dir)
+	return templates, nil
+}
+
+func renderSystemPrompt(profile string, data promptTemplateData) (string, error) {
+	tmpl, ok := currentAISettings().templates[profile]
+	if !ok {
+		return "", fmt.Errorf("no prompt template for profile '%s'", profile)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("could not render prompt template '%s': %w", profile, err)
+	}
+	return buf.String(), nil
+}
+
+func groupLabel(userCount int) string {
+	switch {
+	case userCount > 3:
+		return "group"
+	case userCount == 3:
+		return "trio"
+	default:
+		return "duo"
 	}
 }
 
@@ -106,14 +295,160 @@ type GroqError struct {
 	Code    string `json:"code"`
 }
 
-func invokeGroq(ctx context.Context, systemPrompt, userContent string) (string, error) {
-	if groqAPIKey == "" {
+// groqHealth remembers the outcome of the most recent Groq calls for the health
+// endpoint. Cancelled or timed-out requests say nothing about Groq and are not
+// recorded.
+var groqHealth struct {
+	sync.Mutex
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+}
+
+type GroqHealthStatus struct {
+	Configured  bool            `json:"configured"`
+	Healthy     bool            `json:"healthy"`
+	Model       string          `json:"model"`
+	LastSuccess string          `json:"last_success,omitempty"`
+	LastFailure string          `json:"last_failure,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	Keys        []GroqKeyHealth `json:"keys,omitempty"`
+}
+
+// withoutErrors drops the error messages, which can quote Groq's responses,
+// for the public /health body.
+func (s GroqHealthStatus) withoutErrors() GroqHealthStatus {
+	s.LastError = ""
+	keys := make([]GroqKeyHealth, len(s.Keys))
+	for i, key := range s.Keys {
+		key.LastError = ""
+		keys[i] = key
+	}
+	s.Keys = keys
+	return s
+}
+
+func recordGroqResult(err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	groqHealth.Lock()
+	defer groqHealth.Unlock()
+	if err != nil {
+		groqHealth.lastFailure = time.Now()
+		groqHealth.lastError = err.Error()
+	} else {
+		groqHealth.lastSuccess = time.Now()
+	}
+}
+
+// currentGroqHealth reports Groq as healthy when a key is configured and in
+// rotation, and the most recent call (if any) succeeded.
+func currentGroqHealth() GroqHealthStatus {
+	groqHealth.Lock()
+	defer groqHealth.Unlock()
+
+	settings := currentAISettings()
+	status := GroqHealthStatus{
+		Configured: settings.apiKey != "",
+		Model:      settings.model,
+		LastError:  groqHealth.lastError,
+		Keys:       groqKeyHealthList(settings.apiKeys),
+	}
+	if !groqHealth.lastSuccess.IsZero() {
+		status.LastSuccess = groqHealth.lastSuccess.UTC().Format(time.RFC3339)
+	}
+	if !groqHealth.lastFailure.IsZero() {
+		status.LastFailure = groqHealth.lastFailure.UTC().Format(time.RFC3339)
+	}
+	anyKeyHealthy := false
+	for _, key := range status.Keys {
+		anyKeyHealthy = anyKeyHealthy || key.Healthy
+	}
+	status.Healthy = status.Configured && anyKeyHealthy && !groqHealth.lastSuccess.Before(groqHealth.lastFailure)
+	return status
+}
+
+// pingGroq sends a one-token completion to check that the key and model work.
+func pingGroq(ctx context.Context) error {
+	settings := currentAISettings()
+	if settings.apiKey == "" {
+		return errors.New("GROQ_API_KEY is not configured")
+	}
+	keyIndex, ok := nextGroqKey(settings.apiKeys, 0)
+	if !ok {
+		err := errors.New("every Groq API key is cooling down after repeated failures")
+		recordGroqResult(err)
+		return err
+	}
+	apiKey := settings.apiKeys[keyIndex]
+
+	requestBodyBytes, err := json.Marshal(GroqRequest{
+		Model:     settings.model,
+		Messages:  []GroqMessage{{Role: "user", Content: "ping"}},
+		MaxTokens: 1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Groq ping payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", groqAPIEndpoint, bytes.NewBuffer(requestBodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create Groq ping request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Groq ping failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var groqErrResp GroqResponse
+		body, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(body, &groqErrResp) == nil && groqErrResp.Error != nil {
+			err = fmt.Errorf("Groq ping returned status %d: %s", resp.StatusCode, groqErrResp.Error.Message)
+		} else {
+			err = fmt.Errorf("Groq ping returned status %d", resp.StatusCode)
+		}
+		if isGroqKeyFailure(resp.StatusCode, resp.Header, groqErrResp.Error) {
+			recordGroqKeyFailure(settings.apiKeys, keyIndex, err)
+		}
+	} else {
+		recordGroqKeySuccess(apiKey)
+	}
+	recordGroqResult(err)
+	return err
+}
+
+// invokeGroq sends messages to model, or to GROQ_MODEL when model is empty.
+func invokeGroq(ctx context.Context, model string, messages []GroqMessage) (string, error) {
+	content, err := callGroq(ctx, model, messages)
+	recordGroqResult(err)
+	return content, err
+}
+
+func callGroq(ctx context.Context, model string, messages []GroqMessage) (string, error) {
+	settings := currentAISettings()
+	if settings.apiKey == "" {
 		return "", errors.New("attempted to call Groq with no API key configured")
 	}
+	if model == "" {
+		model = settings.model
+	}
 
-	var lastErr error
-	keyName := "GROQ_API_KEY"
+	// Every call starts with the first key in rotation and moves on to the
+	// next one, without waiting, when a key is rejected or out of quota.
+	keyIndex, ok := nextGroqKey(settings.apiKeys, 0)
+	if !ok {
+		return "", errors.New("every Groq API key is cooling down after repeated failures")
+	}
+	apiKey, keyName := settings.apiKeys[keyIndex], groqKeyName(keyIndex)
+	switchedKey := false
 
+	var lastErr error
 	for attempt := 1; attempt <= retryAttempts; attempt++ {
 		select {
 		case <-ctx.Done():
@@ -125,7 +460,7 @@ func invokeGroq(ctx context.Context, systemPrompt, userContent string) (string,
 		default:
 		}
 
-		if attempt > 1 {
+		if attempt > 1 && !switchedKey {
 			waitDuration := time.Duration(singleRetryWaitSeconds) * time.Second
 			log.Printf("Retrying Groq API call with %s (attempt %d) after error: %v. Waiting for %s...", keyName, attempt, lastErr, waitDuration)
 
@@ -137,14 +472,13 @@ func invokeGroq(ctx context.Context, systemPrompt, userContent string) (string,
 			}
 		}
 
+		switchedKey = false
+
 		requestPayload := GroqRequest{
-			Model: groqModel,
-			Messages: []GroqMessage{
-				{Role: "system", Content: systemPrompt},
-				{Role: "user", Content: userContent},
-			},
-			Temperature:    groqTemperature,
-			MaxTokens:      groqMaxTokens,
+			Model:          model,
+			Messages:       messages,
+			Temperature:    settings.temperature,
+			MaxTokens:      settings.maxTokens,
 			ResponseFormat: &GroqResponseFormat{Type: "json_object"},
 		}
 		requestBodyBytes, err := json.Marshal(requestPayload)
@@ -156,7 +490,7 @@ func invokeGroq(ctx context.Context, systemPrompt, userContent string) (string,
 		if err != nil {
 			return "", fmt.Errorf("failed to create Groq request object with %s: %w", keyName, err)
 		}
-		req.Header.Set("Authorization", "Bearer "+groqAPIKey)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
 		req.Header.Set("Content-Type", "application/json")
 
 		resp, err := httpClient.Do(req)
@@ -200,6 +534,16 @@ func invokeGroq(ctx context.Context, systemPrompt, userContent string) (string,
 			}
 			lastErr = errors.New(errMsg)
 
+			if isGroqKeyFailure(resp.StatusCode, resp.Header, groqErrResp.Error) {
+				recordGroqKeyFailure(settings.apiKeys, keyIndex, lastErr)
+				if next, ok := nextGroqKey(settings.apiKeys, keyIndex+1); ok && next != keyIndex && attempt < retryAttempts {
+					keyIndex, apiKey, keyName = next, settings.apiKeys[next], groqKeyName(next)
+					switchedKey = true
+					log.Printf("Warning: %v. Switching to %s.", lastErr, keyName)
+					continue
+				}
+			}
+
 			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
 				log.Printf("Warning: Retryable %v", lastErr)
 				if attempt == retryAttempts {
@@ -212,6 +556,8 @@ func invokeGroq(ctx context.Context, systemPrompt, userContent string) (string,
 			}
 		}
 
+		recordGroqKeySuccess(apiKey)
+
 		var groqResp GroqResponse
 		err = json.Unmarshal(responseBodyBytes, &groqResp)
 		if err != nil {
@@ -269,24 +615,90 @@ func invokeGroq(ctx context.Context, systemPrompt, userContent string) (string,
 	return "", fmt.Errorf("all Groq attempts failed for %s (unknown error)", keyName)
 }
 
-func AnalyzeMessagesWithLLM(ctx context.Context, data []ParsedMessage, gapHours float64) (string, error) {
-	if groqAPIKey == "" {
+// requestMissingPeople asks once more for just the people the model left out,
+// which happens most with groups close to maxUsersForPeopleBlock, and merges
+// whatever comes back. Failures only cost the missing entries.
+func requestMissingPeople(ctx context.Context, model string, messages []GroqMessage, output *AIAnalysisOutput, participants []string, missing []string) {
+	usedAnimals := make(map[string]struct{}, len(output.People))
+	for _, person := range output.People {
+		usedAnimals[person.Animal] = struct{}{}
+	}
+	var freeAnimals []string
+	for _, animal := range allowedAIAnimals {
+		if _, used := usedAnimals[animal]; !used {
+			freeAnimals = append(freeAnimals, animal)
+		}
+	}
+
+	log.Printf("Warning: AI output left out %d of %d people, asking for them again: %s", len(missing), len(participants), strings.Join(missing, ", "))
+	messages = append(messages, GroqMessage{Role: "user", Content: fmt.Sprintf(
+		"Your \"people\" array left out: %s.\nRespond with a JSON object containing only a \"people\" array with one object for each of them, in the same format, using these exact names and only these animals: %s.",
+		quoteNames(missing), strings.Join(freeAnimals, ", "))})
+
+	result, err := invokeGroq(ctx, model, messages)
+	if err != nil {
+		log.Printf("Warning: Could not get missing people from AI: %v", err)
+		return
+	}
+	var extra AIAnalysisOutput
+	if err := json.Unmarshal([]byte(result), &extra); err != nil {
+		log.Printf("Warning: AI response for missing people is not valid JSON: %v", err)
+		return
+	}
+	for _, person := range extra.People {
+		if canonical, ok := matchParticipant(person.Name, missing); ok {
+			person.Name = canonical
+			output.People = append(output.People, person)
+		}
+	}
+	repairAIOutput(output, participants)
+}
+
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func isValidAITone(tone string) bool {
+	for _, t := range aiTones {
+		if tone == t {
+			return true
+		}
+	}
+	return false
+}
+
+func AnalyzeMessagesWithLLM(ctx context.Context, data []ParsedMessage, gapHours float64, chatName string, profile string, model string, notes bool, labelRoles bool) (string, warningList, error) {
+	settings := currentAISettings()
+	if settings.apiKey == "" {
 		log.Println("Skipping AI Analysis: GROQ_API_KEY not configured.")
-		return "", nil
+		return "", nil, nil
 	}
 
+	var warnings warningList
 	topics := groupMessagesByTopic(data, gapHours)
-	stratifiedData := stratifyMessages(topics)
+	stratifiedData, omitted := stratifyMessages(topics)
 
 	if len(stratifiedData) == 0 {
 		log.Println("No messages eligible for AI analysis after grouping and stratifying.")
-		return "", nil
+		return "", nil, nil
+	}
+
+	if omitted > 0 {
+		sampled := 0
+		for _, msgs := range stratifiedData {
+			sampled += len(msgs)
+		}
+		warnings.add(warnAISampleTruncated, omitted, fmt.Sprintf("The AI read a random sample of %d of %d eligible messages, up to 23 per person.", sampled, sampled+omitted))
 	}
 
 	groupedMessagesJSONBytes, err := json.MarshalIndent(stratifiedData, "", "  ")
 	if err != nil {
 		log.Printf("Error: Failed to serialize messages for LLM: %v", err)
-		return "", fmt.Errorf("failed to serialize messages for LLM: %w", err)
+		return "", nil, fmt.Errorf("failed to serialize messages for LLM: %w", err)
 	}
 	groupedMessagesJSON := string(groupedMessagesJSONBytes)
 
@@ -295,57 +707,108 @@ func AnalyzeMessagesWithLLM(ctx context.Context, data []ParsedMessage, gapHours
 		uniqueUsers[msg.Sender] = struct{}{}
 	}
 	userCount := len(uniqueUsers)
+	participants := maps.Keys(uniqueUsers)
+	sort.Strings(participants)
+	expectPeople := userCount > 1 && userCount <= maxUsersForPeopleBlock
 
-	systemPrompt := `
-        You will be given a list of messages from each user in a chat.
-        The messages are stratified and cherry picked to be the most interesting, funny, or dramatic.
-        Your task is to summarize the chat in a fun, witty, and engaging way and comment on the overall content of the chat.
-        Do not think of these chats as random or jumping from topic to topic.
-        Instead, think of them as a curated collection of messages that have been handpicked for you to analyze.
-        Your summary should be entertaining and engaging.
-        Your summary should be 3 to 5 sentences long and capture the overall vibe, drama, relationships, and main tea without quoting exact messages.
-        You can also include some fun commentary on the users and their personalities, but keep it light and playful.
-
-        *DO NOT DO THE FOLLOWING*:
-        - Do NOT say that the chats are random or jumping from topic to topic.
-        - Do NOT say that you are an AI or LLM.
-        - Do NOT say that this chat is a mess, jumbled, or chaotic.
-
-        *STRICT INSTRUCTIONS*:
-        - Output ONLY valid JSON.
-        - Your entire response must start with { and end with }.
-        - NO extra text, commentary, markdown, or code block indicators before or after the JSON object.
-
-        Your output JSON object MUST include the following keys:
-        "summary": "<Give a wild, witty summary of the chat — 3 to 5 sentences max. 
-        Capture the overall vibe, drama, relationships, and main tea without quoting exact messages. 
-        Feel free to speculate like a gossip vlogger who lives for chaos.>"
-        `
-	if userCount > 0 && userCount <= maxUsersForPeopleBlock {
-		systemPrompt += `,
-            "people": [
-            {
-                "name": "<person name>",
-                "animal": "one of: <owl, lion, dolphin, fox, bear, rabbit, monkey, tiger, wolf, eagle, elephant, penguin, cat, dog, koala, panda, sheep> — each assigned uniquely strictly from this list. choose wisely",
-                "description": "<person's name is the ANIMAL of the <'group' if count > 3 else 'trio' if count == 3 else 'duo'>, with a brief reason! Then add 2 fun lines about their vibe, keep it Gen Z, playful, and simple.>"
-            }
-            // ... include one object for each unique person in the chat
-            // ... and make sure to only analyze the people whose messages are given to you, not people mentioned in the chats.
-            ]
-            }`
-	} else {
-		systemPrompt += `
-            }`
+	if profile == "" {
+		profile = settings.profile
+	}
+	schema := aiOutputSchema{People: expectPeople, Roles: labelRoles && expectPeople && userCount >= minUsersForRoles}
+	var savedLinks string
+	if notes {
+		profile = notesPromptProfile
+		savedLinks = describeSavedLinks(data)
+	} else if userCount == 2 {
+		if _, ok := settings.templates[profile+duoPromptSuffix]; ok {
+			profile += duoPromptSuffix
+			schema.Relationship = true
+		} else {
+			log.Printf("Warning: No duo prompt template for profile '%s', using the group prompt.", profile)
+		}
 	}
 
-	result, err := invokeGroq(ctx, systemPrompt, groupedMessagesJSON)
+	var traits string
+	if expectPeople {
+		traits = describeStyleTraits(calculateStyleFingerprints(data, time.Duration(gapHours*float64(time.Hour))))
+	}
+
+	systemPrompt, err := renderSystemPrompt(profile, promptTemplateData{
+		UserCount:     userCount,
+		ChatName:      chatName,
+		IncludePeople: expectPeople,
+		Animals:       strings.Join(allowedAIAnimals, ", "),
+		GroupLabel:    groupLabel(userCount),
+		Traits:        traits,
+		SavedLinks:    savedLinks,
+		IncludeRoles:  schema.Roles,
+		Roles:         strings.Join(memberRoles, ", "),
+		Participants:  quoteNames(participants),
+	})
 	if err != nil {
-		log.Printf("Error: AI analysis failed after all attempts with GROQ_API_KEY: %v", err)
-		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			log.Printf("Context cancelled during AI analysis, stopping.")
+		log.Printf("Error: Failed to build system prompt: %v", err)
+		return "", nil, fmt.Errorf("failed to build system prompt: %w", err)
+	}
+
+	messages := []GroqMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: groupedMessagesJSON},
+	}
+
+	var output *AIAnalysisOutput
+	var lastResult string
+	for attempt := 0; attempt <= aiValidationRetries; attempt++ {
+		result, err := invokeGroq(ctx, model, messages)
+		if err != nil {
+			log.Printf("Error: AI analysis failed after all attempts with GROQ_API_KEY: %v", err)
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				log.Printf("Context cancelled during AI analysis, stopping.")
+			}
+			return "", nil, fmt.Errorf("AI analysis failed: %w", err)
+		}
+
+		lastResult = result
+		parsed, violations, err := parseAIOutput(result, participants, schema)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			violations = []string{err.Error()}
+		} else {
+			output = parsed
+		}
+		if len(violations) == 0 {
+			break
+		}
+
+		log.Printf("Warning: AI output failed validation (attempt %d): %s", attempt+1, strings.Join(violations, "; "))
+		if attempt < aiValidationRetries {
+			messages = append(messages,
+				GroqMessage{Role: "assistant", Content: result},
+				GroqMessage{Role: "user", Content: "Your previous response broke these rules:\n- " + strings.Join(violations, "\n- ") +
+					"\nRespond again with the complete corrected JSON object only."},
+			)
 		}
-		return "", fmt.Errorf("AI analysis failed: %w", err)
 	}
 
-	return result, nil
+	if output == nil {
+		return "", nil, errors.New("AI analysis failed: model did not return output matching the expected schema")
+	}
+	repairAIOutput(output, participants)
+	if schema.People {
+		if missing := missingPeople(output.People, participants); len(missing) > 0 {
+			messages = append(messages, GroqMessage{Role: "assistant", Content: lastResult})
+			requestMissingPeople(ctx, model, messages, output, participants, missing)
+			if missing := missingPeople(output.People, participants); len(missing) > 0 {
+				warnings.add(warnAIPeopleIncomplete, len(missing), "The AI did not describe everyone in the chat: "+strings.Join(missing, ", ")+".")
+			}
+		}
+	}
+	if strings.TrimSpace(output.Summary) == "" {
+		return "", nil, errors.New("AI analysis failed: model did not return a summary")
+	}
+
+	validated, err := json.Marshal(output)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to serialize validated AI output: %w", err)
+	}
+	return string(validated), warnings, nil
 }
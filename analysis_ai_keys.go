@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A key that fails groqKeyFailureThreshold calls in a row with an auth or
+// quota error is left out of rotation for groqKeyCooldown, unless it is the
+// last key still in rotation.
+const (
+	groqKeyFailureThreshold = 3
+	groqKeyCooldown         = 5 * time.Minute
+)
+
+type groqKeyState struct {
+	failures      int
+	disabledUntil time.Time
+	lastFailure   time.Time
+	lastError     string
+}
+
+// groqKeys tracks every key ever used by its value, so state survives a
+// reload that keeps the key and keys dropped by one are simply never asked
+// about again.
+var groqKeys = struct {
+	sync.Mutex
+	byKey map[string]*groqKeyState
+}{byKey: make(map[string]*groqKeyState)}
+
+// GroqKeyHealth is how one configured key is doing. Keys are named by
+// position, never by value.
+type GroqKeyHealth struct {
+	Name          string `json:"name"`
+	Healthy       bool   `json:"healthy"`
+	Failures      int    `json:"consecutive_failures"`
+	DisabledUntil string `json:"disabled_until,omitempty"`
+	LastFailure   string `json:"last_failure,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// groqKeyName is how logs and /health refer to the key at index i of
+// aiSettings.apiKeys.
+func groqKeyName(i int) string {
+	if i == 0 {
+		return "GROQ_API_KEY"
+	}
+	return fmt.Sprintf("GROQ_API_KEYS #%d", i)
+}
+
+// isGroqKeyFailure reports whether a Groq error response says something about
+// the key itself, rather than the request or Groq being busy or down. A 429 is
+// usually a per-minute limit that clears by itself, so it only counts when it
+// says the key's daily quota is used up.
+func isGroqKeyFailure(status int, header http.Header, groqErr *GroqError) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	case http.StatusTooManyRequests:
+		return isGroqQuotaExhausted(header, groqErr)
+	}
+	return false
+}
+
+// isGroqQuotaExhausted reads a 429. Groq's x-ratelimit-remaining-requests
+// counts requests per day, and its error message names the daily limit hit.
+func isGroqQuotaExhausted(header http.Header, groqErr *GroqError) bool {
+	if header.Get("x-ratelimit-remaining-requests") == "0" {
+		return true
+	}
+	if groqErr == nil {
+		return false
+	}
+	if groqErr.Code == "insufficient_quota" || groqErr.Type == "insufficient_quota" {
+		return true
+	}
+	message := strings.ToLower(groqErr.Message)
+	return strings.Contains(message, "per day") || strings.Contains(message, "quota")
+}
+
+// nextGroqKey returns the index of the first key at or after start, wrapping
+// around, that is not cooling down. It returns false when all of them are.
+func nextGroqKey(keys []string, start int) (int, bool) {
+	groqKeys.Lock()
+	defer groqKeys.Unlock()
+	now := time.Now()
+	for offset := range keys {
+		i := (start + offset) % len(keys)
+		if state, ok := groqKeys.byKey[keys[i]]; !ok || !now.Before(state.disabledUntil) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// recordGroqKeyFailure counts a key failure against keys[i]. The key is left
+// out of rotation once it reaches the threshold, as long as another of keys
+// is still in rotation to take over.
+func recordGroqKeyFailure(keys []string, i int, err error) {
+	groqKeys.Lock()
+	defer groqKeys.Unlock()
+	state, ok := groqKeys.byKey[keys[i]]
+	if !ok {
+		state = &groqKeyState{}
+		groqKeys.byKey[keys[i]] = state
+	}
+	state.failures++
+	state.lastFailure = time.Now()
+	state.lastError = err.Error()
+	if state.failures < groqKeyFailureThreshold {
+		return
+	}
+	state.failures = 0
+	for j, other := range keys {
+		if otherState, ok := groqKeys.byKey[other]; j != i && (!ok || !state.lastFailure.Before(otherState.disabledUntil)) {
+			state.disabledUntil = state.lastFailure.Add(groqKeyCooldown)
+			log.Printf("Warning: %s failed %d calls in a row; leaving it out of rotation until %s.", groqKeyName(i), groqKeyFailureThreshold, state.disabledUntil.UTC().Format(time.RFC3339))
+			return
+		}
+	}
+	log.Printf("Warning: %s failed %d calls in a row, but it is the last key in rotation; keeping it.", groqKeyName(i), groqKeyFailureThreshold)
+}
+
+func recordGroqKeySuccess(key string) {
+	groqKeys.Lock()
+	defer groqKeys.Unlock()
+	if state, ok := groqKeys.byKey[key]; ok {
+		state.failures = 0
+	}
+}
+
+// groqKeyHealthList reports on each of keys, in order.
+func groqKeyHealthList(keys []string) []GroqKeyHealth {
+	groqKeys.Lock()
+	defer groqKeys.Unlock()
+	now := time.Now()
+	health := make([]GroqKeyHealth, len(keys))
+	for i, key := range keys {
+		health[i] = GroqKeyHealth{Name: groqKeyName(i), Healthy: true}
+		state, ok := groqKeys.byKey[key]
+		if !ok {
+			continue
+		}
+		health[i].Failures = state.failures
+		health[i].LastError = state.lastError
+		if !state.lastFailure.IsZero() {
+			health[i].LastFailure = state.lastFailure.UTC().Format(time.RFC3339)
+		}
+		if now.Before(state.disabledUntil) {
+			health[i].Healthy = false
+			health[i].DisabledUntil = state.disabledUntil.UTC().Format(time.RFC3339)
+		}
+	}
+	return health
+}
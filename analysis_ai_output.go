@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const aiValidationRetries = 1
+
+var allowedAIAnimals = []string{
+	"owl", "lion", "dolphin", "fox", "bear", "rabbit", "monkey", "tiger", "wolf",
+	"eagle", "elephant", "penguin", "cat", "dog", "koala", "panda", "sheep",
+}
+
+type AIAnalysisOutput struct {
+	Summary      string          `json:"summary"`
+	People       []AIPerson      `json:"people,omitempty"`
+	Relationship *AIRelationship `json:"relationship,omitempty"`
+	Roles        []AIRole        `json:"roles,omitempty"`
+}
+
+type AIPerson struct {
+	Name        string `json:"name"`
+	Animal      string `json:"animal"`
+	Description string `json:"description"`
+}
+
+type AIRole struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type AIRelationship struct {
+	CommunicationBalance string   `json:"communication_balance"`
+	Initiator            string   `json:"initiator"`
+	GreenFlags           []string `json:"green_flags"`
+	RedFlags             []string `json:"red_flags"`
+}
+
+// aiOutputSchema lists which optional blocks the prompt asked for, so the
+// response can be held to exactly that shape.
+type aiOutputSchema struct {
+	People       bool
+	Relationship bool
+	Roles        bool
+}
+
+// parseAIOutput decodes the model response and collects every schema violation
+// so they can be fed back to the model in a re-prompt.
+func parseAIOutput(raw string, participants []string, schema aiOutputSchema) (*AIAnalysisOutput, []string, error) {
+	var output AIAnalysisOutput
+	if err := json.Unmarshal([]byte(raw), &output); err != nil {
+		return nil, nil, fmt.Errorf("AI output does not match expected schema: %w", err)
+	}
+	return &output, validateAIOutput(&output, participants, schema), nil
+}
+
+func validateAIOutput(output *AIAnalysisOutput, participants []string, schema aiOutputSchema) []string {
+	var violations []string
+
+	if strings.TrimSpace(output.Summary) == "" {
+		violations = append(violations, `"summary" is missing or empty`)
+	}
+	if schema.Relationship {
+		violations = append(violations, validateAIRelationship(output.Relationship, participants)...)
+	}
+	if schema.People {
+		violations = append(violations, validateAIPeople(output.People, participants)...)
+	}
+	if schema.Roles {
+		violations = append(violations, validateAIRoles(output.Roles, participants)...)
+	}
+
+	return violations
+}
+
+func validateAIRelationship(relationship *AIRelationship, participants []string) []string {
+	if relationship == nil {
+		return []string{`"relationship" is missing`}
+	}
+
+	var violations []string
+	if strings.TrimSpace(relationship.CommunicationBalance) == "" {
+		violations = append(violations, `"relationship.communication_balance" is missing or empty`)
+	}
+	if _, ok := matchParticipant(relationship.Initiator, participants); !ok {
+		violations = append(violations, fmt.Sprintf(`"relationship.initiator" %q is not a participant of this chat`, relationship.Initiator))
+	}
+	if len(relationship.GreenFlags) == 0 {
+		violations = append(violations, `"relationship.green_flags" is missing or empty`)
+	}
+	if len(relationship.RedFlags) == 0 {
+		violations = append(violations, `"relationship.red_flags" is missing or empty`)
+	}
+	return violations
+}
+
+func validateAIPeople(people []AIPerson, participants []string) []string {
+	if len(people) == 0 {
+		return []string{`"people" is missing or empty`}
+	}
+
+	var violations []string
+	seenNames := make(map[string]struct{})
+	seenAnimals := make(map[string]struct{})
+	for _, person := range people {
+		canonical, ok := matchParticipant(person.Name, participants)
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%q is not a participant of this chat", person.Name))
+		} else if _, dup := seenNames[canonical]; dup {
+			violations = append(violations, fmt.Sprintf("%q appears more than once in \"people\"", person.Name))
+		} else {
+			seenNames[canonical] = struct{}{}
+		}
+
+		animal := strings.ToLower(strings.TrimSpace(person.Animal))
+		if !isAllowedAnimal(animal) {
+			violations = append(violations, fmt.Sprintf("animal %q for %q is not in the allowed list", person.Animal, person.Name))
+		} else if _, dup := seenAnimals[animal]; dup {
+			violations = append(violations, fmt.Sprintf("animal %q is assigned to more than one person", person.Animal))
+		} else {
+			seenAnimals[animal] = struct{}{}
+		}
+	}
+	if missing := missingPeople(people, participants); len(missing) > 0 {
+		violations = append(violations, fmt.Sprintf("\"people\" leaves out %s; include every participant", quoteNames(missing)))
+	}
+
+	return violations
+}
+
+// missingPeople lists participants with no entry in people, in roster order.
+func missingPeople(people []AIPerson, participants []string) []string {
+	covered := make(map[string]struct{}, len(people))
+	for _, person := range people {
+		if canonical, ok := matchParticipant(person.Name, participants); ok {
+			covered[canonical] = struct{}{}
+		}
+	}
+	var missing []string
+	for _, participant := range participants {
+		if _, ok := covered[participant]; !ok {
+			missing = append(missing, participant)
+		}
+	}
+	return missing
+}
+
+func validateAIRoles(roles []AIRole, participants []string) []string {
+	if len(roles) == 0 {
+		return []string{`"roles" is missing or empty`}
+	}
+
+	var violations []string
+	seenNames := make(map[string]struct{})
+	for _, role := range roles {
+		canonical, ok := matchParticipant(role.Name, participants)
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%q in \"roles\" is not a participant of this chat", role.Name))
+		} else if _, dup := seenNames[canonical]; dup {
+			violations = append(violations, fmt.Sprintf("%q appears more than once in \"roles\"", role.Name))
+		} else {
+			seenNames[canonical] = struct{}{}
+		}
+		if !isMemberRole(strings.ToLower(strings.TrimSpace(role.Role))) {
+			violations = append(violations, fmt.Sprintf("role %q for %q is not in the allowed list", role.Role, role.Name))
+		}
+	}
+	return violations
+}
+
+// repairAIOutput fixes what can be fixed without another model call: people who
+// are not participants (or repeated) are dropped, invalid or duplicate animals
+// are replaced with unused ones from the allowed list, and a relationship
+// initiator is resolved to the exact sender name or cleared. Roles for unknown
+// or repeated people, or outside the allowed list, are dropped.
+func repairAIOutput(output *AIAnalysisOutput, participants []string) {
+	if output.Relationship != nil {
+		output.Relationship.Initiator, _ = matchParticipant(output.Relationship.Initiator, participants)
+	}
+
+	usedAnimals := make(map[string]struct{})
+	seenNames := make(map[string]struct{})
+	repaired := make([]AIPerson, 0, len(output.People))
+	var needsAnimal []int
+
+	for _, person := range output.People {
+		canonical, ok := matchParticipant(person.Name, participants)
+		if !ok {
+			continue
+		}
+		if _, dup := seenNames[canonical]; dup {
+			continue
+		}
+		seenNames[canonical] = struct{}{}
+		person.Name = canonical
+
+		animal := strings.ToLower(strings.TrimSpace(person.Animal))
+		_, taken := usedAnimals[animal]
+		if isAllowedAnimal(animal) && !taken {
+			person.Animal = animal
+			usedAnimals[animal] = struct{}{}
+		} else {
+			needsAnimal = append(needsAnimal, len(repaired))
+		}
+		repaired = append(repaired, person)
+	}
+
+	for _, idx := range needsAnimal {
+		for _, animal := range allowedAIAnimals {
+			if _, taken := usedAnimals[animal]; !taken {
+				repaired[idx].Animal = animal
+				usedAnimals[animal] = struct{}{}
+				break
+			}
+		}
+	}
+
+	output.People = repaired
+
+	if output.Roles != nil {
+		seenRoleNames := make(map[string]struct{})
+		roles := make([]AIRole, 0, len(output.Roles))
+		for _, role := range output.Roles {
+			canonical, ok := matchParticipant(role.Name, participants)
+			label := strings.ToLower(strings.TrimSpace(role.Role))
+			if !ok || !isMemberRole(label) {
+				continue
+			}
+			if _, dup := seenRoleNames[canonical]; dup {
+				continue
+			}
+			seenRoleNames[canonical] = struct{}{}
+			roles = append(roles, AIRole{Name: canonical, Role: label})
+		}
+		output.Roles = roles
+	}
+}
+
+// matchParticipant resolves a model-supplied name to the exact sender name,
+// accepting either the full sender name or its display (first) name.
+func matchParticipant(name string, participants []string) (string, bool) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if normalized == "" {
+		return "", false
+	}
+
+	for _, participant := range participants {
+		if strings.ToLower(strings.TrimSpace(participant)) == normalized {
+			return participant, true
+		}
+	}
+	for _, participant := range participants {
+		displayNames := extractDisplayNames([]string{participant})
+		if len(displayNames) > 0 && strings.ToLower(displayNames[0]) == normalized {
+			return participant, true
+		}
+	}
+	return "", false
+}
+
+func isMemberRole(role string) bool {
+	for _, allowed := range memberRoles {
+		if role == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func isAllowedAnimal(animal string) bool {
+	for _, allowed := range allowedAIAnimals {
+		if animal == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxAliasSuggestions = 10
+	// minSimilarAliasRunes keeps short names out of the similar-name check,
+	// where a single edit turns one real name into another.
+	minSimilarAliasRunes = 5
+
+	aliasReasonSameName     = "same_name"
+	aliasReasonSimilarName  = "similar_name"
+	aliasReasonNumberToName = "number_to_name"
+)
+
+// AliasSuggestion names senders that are likely the same person, e.g. "Mom"
+// and "Mom ❤️" from exports made before and after a contact was renamed.
+// Senders lists the most active first, as the name to keep; Reason says how
+// the match was found. Suggestions are never applied on their own: clients
+// send them back in the aliases field to merge.
+type AliasSuggestion struct {
+	Senders []string `json:"senders"`
+	Reason  string   `json:"reason"`
+}
+
+// parseSenderAliases reads the aliases field, a JSON object of the name to
+// keep to the other names the same person appears under:
+// {"Mom": ["Mom ❤️", "+91 98765 43210"]}. It returns the mapping in the
+// same shape as the names upload so both are applied in one pass.
+func parseSenderAliases(raw string) (contactNames, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	var groups map[string][]string
+	if err := json.Unmarshal([]byte(trimmed), &groups); err != nil {
+		return nil, fmt.Errorf("aliases must be a JSON object of name to a list of other names: %w", err)
+	}
+
+	aliases := make(contactNames)
+	for name, others := range groups {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if len([]rune(name)) > maxContactNameLength {
+			return nil, errContactNameTooLong
+		}
+		for _, other := range others {
+			key := contactKey(other)
+			if key == "" || key == contactKey(name) {
+				continue
+			}
+			if existing, ok := aliases[key]; ok && existing != name {
+				return nil, fmt.Errorf("'%s' is listed as an alias of both '%s' and '%s'", strings.TrimSpace(other), existing, name)
+			}
+			aliases[key] = name
+		}
+	}
+	if len(aliases) > maxContactNames {
+		return nil, errContactNamesTooMany
+	}
+	return aliases, nil
+}
+
+// withAliases returns the names mapping with the aliases folded in. An alias
+// overrides a name for the same sender, and a number named after an alias is
+// sent straight to the name the alias points to.
+func (n contactNames) withAliases(aliases contactNames) contactNames {
+	if len(aliases) == 0 {
+		return n
+	}
+	merged := make(contactNames, len(n)+len(aliases))
+	for key, name := range n {
+		merged[key] = aliases.rename(name)
+	}
+	for key, name := range aliases {
+		merged[key] = name
+	}
+	return merged
+}
+
+type senderSpan struct {
+	messages int
+	first    time.Time
+	last     time.Time
+}
+
+func (s senderSpan) overlaps(other senderSpan) bool {
+	return !s.last.Before(other.first) && !other.last.Before(s.first)
+}
+
+// suggestAliases looks for senders that are probably one person split across
+// export epochs. Names that only differ in case, emoji or punctuation are
+// suggested outright. Names one or two edits apart, and a phone number with
+// exactly one named sender, are only suggested when the two were never active
+// at the same time, since a contact is renamed between exports rather than
+// mid-chat.
+func suggestAliases(messagesData []ParsedMessage) []AliasSuggestion {
+	spans := make(map[string]*senderSpan)
+	var order []string
+	for _, msg := range messagesData {
+		span, ok := spans[msg.Sender]
+		if !ok {
+			span = &senderSpan{first: msg.Timestamp}
+			spans[msg.Sender] = span
+			order = append(order, msg.Sender)
+		}
+		span.messages++
+		if msg.Timestamp.Before(span.first) {
+			span.first = msg.Timestamp
+		}
+		if msg.Timestamp.After(span.last) {
+			span.last = msg.Timestamp
+		}
+	}
+	if len(order) < 2 {
+		return nil
+	}
+	sort.Strings(order)
+
+	var suggestions []AliasSuggestion
+	suggested := make(map[string]bool)
+	// mergedAway holds the senders a suggestion would fold into another, so
+	// they don't count as separate people when matching numbers.
+	mergedAway := make(map[string]bool)
+	suggest := func(reason string, senders ...string) {
+		sort.Slice(senders, func(i, j int) bool {
+			if spans[senders[i]].messages != spans[senders[j]].messages {
+				return spans[senders[i]].messages > spans[senders[j]].messages
+			}
+			return senders[i] < senders[j]
+		})
+		for i, sender := range senders {
+			suggested[sender] = true
+			if i > 0 {
+				mergedAway[sender] = true
+			}
+		}
+		suggestions = append(suggestions, AliasSuggestion{Senders: senders, Reason: reason})
+	}
+
+	byNormalized := make(map[string][]string)
+	var numbers, named []string
+	for _, sender := range order {
+		if isPhoneSender(sender) {
+			numbers = append(numbers, sender)
+			continue
+		}
+		named = append(named, sender)
+		if normalized := normalizeAliasName(sender); normalized != "" {
+			byNormalized[normalized] = append(byNormalized[normalized], sender)
+		}
+	}
+	for _, sender := range named {
+		group := byNormalized[normalizeAliasName(sender)]
+		if len(group) > 1 && !suggested[group[0]] {
+			suggest(aliasReasonSameName, append([]string(nil), group...)...)
+		}
+	}
+
+	for i, a := range named {
+		for _, b := range named[i+1:] {
+			if suggested[a] || suggested[b] || spans[a].overlaps(*spans[b]) {
+				continue
+			}
+			na, nb := []rune(normalizeAliasName(a)), []rune(normalizeAliasName(b))
+			if min(len(na), len(nb)) < minSimilarAliasRunes {
+				continue
+			}
+			maxEdits := 1
+			if min(len(na), len(nb)) >= 2*minSimilarAliasRunes {
+				maxEdits = 2
+			}
+			if editDistance(na, nb) <= maxEdits {
+				suggest(aliasReasonSimilarName, a, b)
+			}
+		}
+	}
+
+	for _, number := range numbers {
+		var match string
+		candidates := 0
+		for _, name := range named {
+			if !mergedAway[name] && !spans[number].overlaps(*spans[name]) {
+				match = name
+				candidates++
+			}
+		}
+		if candidates == 1 && !suggested[match] {
+			suggest(aliasReasonNumberToName, number, match)
+		}
+	}
+
+	if len(suggestions) > maxAliasSuggestions {
+		suggestions = suggestions[:maxAliasSuggestions]
+	}
+	return suggestions
+}
+
+// isPhoneSender reports whether the export shows the sender as a number
+// rather than a contact name.
+func isPhoneSender(sender string) bool {
+	digits := strings.TrimPrefix(contactKey(sender), "+")
+	return digits != "" && strings.IndexFunc(digits, func(r rune) bool { return !unicode.IsDigit(r) }) == -1
+}
+
+// normalizeAliasName lowercases a name and keeps only its letters and digits,
+// one space between words, so "Mom ❤️" and "mom" compare equal. A name made
+// only of emoji normalizes to "".
+func normalizeAliasName(name string) string {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(name)) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, word)
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// editDistance is the Levenshtein distance between two rune slices.
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// balanceMinMonthMessages keeps months with a handful of messages out of the
+// most and least balanced picks.
+const balanceMinMonthMessages = 20
+
+// BalancePoint is one month's participation balance.
+type BalancePoint struct {
+	Month    string  `json:"month"`
+	Messages int     `json:"messages"`
+	Balance  float64 `json:"balance"`
+}
+
+// ParticipationBalance measures how evenly members share the talking, from 0
+// when one person sends everything to 100 when every member sends the same
+// amount, the normalized entropy of message counts also behind the health
+// score's balance. Every figure counts all of the chat's members, so a group
+// conversation between two of five people is not balanced.
+// ConversationAverage is the mean over conversations of two or more messages,
+// and the most and least balanced months need twenty messages.
+type ParticipationBalance struct {
+	Overall             float64        `json:"overall"`
+	ConversationAverage float64        `json:"conversation_average"`
+	Conversations       int            `json:"conversations"`
+	Monthly             []BalancePoint `json:"monthly"`
+	MostBalancedMonth   string         `json:"most_balanced_month,omitempty"`
+	LeastBalancedMonth  string         `json:"least_balanced_month,omitempty"`
+}
+
+func calculateParticipationBalance(messagesData []ParsedMessage, convoBreak time.Duration) *ParticipationBalance {
+	overall := make(map[string]int)
+	for _, msg := range messagesData {
+		overall[msg.Sender]++
+	}
+	members := len(overall)
+	if members < 2 {
+		return nil
+	}
+
+	balance := &ParticipationBalance{Overall: roundFloat(messageBalance(overall, members)*100, 2)}
+
+	var conversationSum float64
+	convo := make(map[string]int)
+	convoMessages := 0
+	closeConvo := func() {
+		if convoMessages >= 2 {
+			conversationSum += messageBalance(convo, members)
+			balance.Conversations++
+		}
+		convo = make(map[string]int)
+		convoMessages = 0
+	}
+	months := make(map[string]map[string]int)
+	for i, msg := range messagesData {
+		if i > 0 && msg.Timestamp.Sub(messagesData[i-1].Timestamp) > convoBreak {
+			closeConvo()
+		}
+		convo[msg.Sender]++
+		convoMessages++
+
+		key := msg.Timestamp.Format("2006-01")
+		if _, ok := months[key]; !ok {
+			months[key] = make(map[string]int)
+		}
+		months[key][msg.Sender]++
+	}
+	closeConvo()
+	if balance.Conversations > 0 {
+		balance.ConversationAverage = roundFloat(conversationSum/float64(balance.Conversations)*100, 2)
+	}
+
+	keys := make([]string, 0, len(months))
+	for key := range months {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	balance.Monthly = make([]BalancePoint, 0, len(keys))
+	var most, least *BalancePoint
+	for _, key := range keys {
+		messages := 0
+		for _, count := range months[key] {
+			messages += count
+		}
+		point := BalancePoint{Month: key, Messages: messages, Balance: roundFloat(messageBalance(months[key], members)*100, 2)}
+		balance.Monthly = append(balance.Monthly, point)
+		if messages < balanceMinMonthMessages {
+			continue
+		}
+		if most == nil || point.Balance > most.Balance {
+			most = &point
+		}
+		if least == nil || point.Balance < least.Balance {
+			least = &point
+		}
+	}
+	if most != nil && most.Month != least.Month {
+		balance.MostBalancedMonth, balance.LeastBalancedMonth = most.Month, least.Month
+	}
+	return balance
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	autoReplyPhrasesFile = "auto_reply_phrases.json"
+
+	botReasonName      = "bot_name"
+	botReasonAutoReply = "auto_reply"
+	botReasonSchedule  = "regular_schedule"
+
+	// minBotMessages is how many messages a sender needs before their
+	// content or timing can mark them as a bot; a name alone is enough.
+	minBotMessages = 5
+	// botTemplatedShare is the share of a sender's messages that must be
+	// auto-reply phrases or verbatim repeats.
+	botTemplatedShare = 0.6
+	// minScheduledMessages and the two limits below spot posting on a
+	// timer: gaps that hardly vary, or nearly every message at the same
+	// minute of the day.
+	minScheduledMessages = 10
+	botMaxGapVariation   = 0.1
+	botSameMinuteShare   = 0.9
+)
+
+var autoReplyPhrases []string
+
+func init() {
+	loadBotData()
+}
+
+func loadBotData() {
+	var err error
+	autoReplyPhrases, err = loadLanguagePhrases(filepath.Join(dataDir, autoReplyPhrasesFile))
+	if err != nil {
+		log.Printf("Warning: Failed to load auto-reply phrases: %v. Proceeding without auto-reply detection.", err)
+		autoReplyPhrases = []string{}
+	}
+}
+
+// DetectedBot is a sender that looks automated. Reasons lists every signal
+// that matched; Excluded is set when the client asked for bots to be left out
+// of the stats.
+type DetectedBot struct {
+	Sender   string   `json:"sender"`
+	Messages int      `json:"messages"`
+	Reasons  []string `json:"reasons"`
+	Excluded bool     `json:"excluded"`
+}
+
+// detectBots flags senders whose name ends in "Bot", whose messages are
+// mostly business auto-replies or the same text over and over, or who post
+// on a timer.
+func detectBots(messagesData []ParsedMessage) []DetectedBot {
+	bySender := make(map[string][]ParsedMessage)
+	for _, msg := range messagesData {
+		bySender[msg.Sender] = append(bySender[msg.Sender], msg)
+	}
+	// A notes-to-self chat has nobody else in it to be a bot.
+	if len(bySender) < 2 {
+		return nil
+	}
+
+	var bots []DetectedBot
+	for sender, messages := range bySender {
+		var reasons []string
+		if hasBotName(sender) {
+			reasons = append(reasons, botReasonName)
+		}
+		if len(messages) >= minBotMessages && templatedShare(messages) >= botTemplatedShare {
+			reasons = append(reasons, botReasonAutoReply)
+		}
+		if len(messages) >= minScheduledMessages && postsOnSchedule(messages) {
+			reasons = append(reasons, botReasonSchedule)
+		}
+		if len(reasons) > 0 {
+			bots = append(bots, DetectedBot{Sender: sender, Messages: len(messages), Reasons: reasons})
+		}
+	}
+	sort.Slice(bots, func(i, j int) bool {
+		if bots[i].Messages != bots[j].Messages {
+			return bots[i].Messages > bots[j].Messages
+		}
+		return bots[i].Sender < bots[j].Sender
+	})
+	return bots
+}
+
+// hasBotName matches "NewsBot", "Reminder bot" and "deploy_bot", but not
+// names that merely end in the letters, like "Talbot".
+func hasBotName(sender string) bool {
+	words := strings.Fields(sender)
+	if len(words) == 0 {
+		return false
+	}
+	last := words[len(words)-1]
+	lower := strings.ToLower(last)
+	return lower == "bot" || strings.HasSuffix(last, "Bot") || strings.HasSuffix(lower, "_bot") || strings.HasSuffix(lower, "-bot")
+}
+
+// templatedShare is the share of messages that contain an auto-reply phrase
+// or repeat, word for word, text the sender sent at least twice more.
+func templatedShare(messages []ParsedMessage) float64 {
+	texts := make(map[string]int)
+	for _, msg := range messages {
+		texts[strings.ToLower(strings.TrimSpace(msg.OriginalMessage))]++
+	}
+	templated := 0
+	for _, msg := range messages {
+		text := strings.ToLower(strings.TrimSpace(msg.OriginalMessage))
+		if texts[text] >= 3 || containsAnyPhrase(text, autoReplyPhrases) {
+			templated++
+		}
+	}
+	return float64(templated) / float64(len(messages))
+}
+
+// postsOnSchedule reports whether the gaps between a sender's messages barely
+// vary, or nearly all of them land on the same minute of the day.
+func postsOnSchedule(messages []ParsedMessage) bool {
+	var gaps []float64
+	minutes := make(map[int]int)
+	for i, msg := range messages {
+		minutes[msg.Timestamp.Hour()*60+msg.Timestamp.Minute()]++
+		if i > 0 {
+			gaps = append(gaps, msg.Timestamp.Sub(messages[i-1].Timestamp).Minutes())
+		}
+	}
+
+	for _, count := range minutes {
+		if float64(count) >= botSameMinuteShare*float64(len(messages)) {
+			return true
+		}
+	}
+
+	mean := 0.0
+	for _, gap := range gaps {
+		mean += gap
+	}
+	mean /= float64(len(gaps))
+	// Bursts of messages sent within the same minute are a person typing,
+	// not a timer.
+	if mean < time.Hour.Minutes() {
+		return false
+	}
+	variance := 0.0
+	for _, gap := range gaps {
+		variance += (gap - mean) * (gap - mean)
+	}
+	return math.Sqrt(variance/float64(len(gaps)))/mean <= botMaxGapVariation
+}
+
+// excludeSenders drops the given senders' messages and marker counts, so the
+// stats only see the remaining members. Group events are kept as they are.
+func excludeSenders(preprocessed *preprocessResult, senders map[string]struct{}) {
+	if len(senders) == 0 {
+		return
+	}
+	kept := preprocessed.messages[:0]
+	for _, msg := range preprocessed.messages {
+		if _, excluded := senders[msg.Sender]; !excluded {
+			kept = append(kept, msg)
+		}
+	}
+	preprocessed.messages = kept
+
+	markers := &preprocessed.markers
+	for sender := range senders {
+		delete(markers.Deleted, sender)
+		delete(markers.Edited, sender)
+		delete(markers.Polls, sender)
+		delete(markers.Locations, sender)
+		delete(markers.Sent, sender)
+		delete(markers.DeletedByMonth, sender)
+	}
+	polls := markers.PollList[:0]
+	for _, poll := range markers.PollList {
+		if _, excluded := senders[poll.Creator]; !excluded {
+			polls = append(polls, poll)
+		}
+	}
+	markers.PollList = polls
+	attachments := markers.Attachments[:0]
+	for _, a := range markers.Attachments {
+		if _, excluded := senders[a.Sender]; !excluded {
+			attachments = append(attachments, a)
+		}
+	}
+	markers.Attachments = attachments
+	laughs := markers.Laughs[:0]
+	for _, l := range markers.Laughs {
+		if _, excluded := senders[l.Sender]; excluded {
+			continue
+		}
+		if _, excluded := senders[l.After]; excluded {
+			l.After = ""
+		}
+		laughs = append(laughs, l)
+	}
+	markers.Laughs = laughs
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	changeSplitMidpoint = "midpoint"
+	changeSplitRequest  = "request"
+)
+
+// PeriodDelta is one measure before and after the split. Change is After
+// minus Before.
+type PeriodDelta struct {
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+	Change float64 `json:"change"`
+}
+
+func newPeriodDelta(before, after float64) PeriodDelta {
+	return PeriodDelta{Before: roundFloat(before, 2), After: roundFloat(after, 2), Change: roundFloat(after-before, 2)}
+}
+
+// MemberChange is how one member's texting moved between the two halves.
+// ResponseTimeMinutes needs replies in both halves and EmojisPerMessage
+// messages in both, so either is left out for someone who joined or went
+// quiet around the split.
+type MemberChange struct {
+	MessageSharePct     PeriodDelta  `json:"message_share_pct"`
+	ResponseTimeMinutes *PeriodDelta `json:"response_time_minutes,omitempty"`
+	EmojisPerMessage    *PeriodDelta `json:"emojis_per_message,omitempty"`
+}
+
+// ChatChanges compares the chat before and after SplitDate, the first day of
+// the second half. SplitSource is "request" for a date the client sent and
+// "midpoint" for the day halfway between the first and last message.
+// BiggestShift is the member whose share of messages moved most, in
+// percentage points.
+type ChatChanges struct {
+	SplitDate      string                  `json:"split_date"`
+	SplitSource    string                  `json:"split_source"`
+	BeforeMessages int                     `json:"before_messages"`
+	AfterMessages  int                     `json:"after_messages"`
+	Members        map[string]MemberChange `json:"members"`
+	BiggestShift   *AverageChampion        `json:"biggest_shift,omitempty"`
+}
+
+// calculateChatChanges splits the chat at splitDate, or at its midpoint when
+// splitDate is zero. It returns nil when either half would be empty.
+func calculateChatChanges(messagesData []ParsedMessage, convoBreak time.Duration, splitDate time.Time) *ChatChanges {
+	if len(messagesData) == 0 {
+		return nil
+	}
+	source := changeSplitRequest
+	if splitDate.IsZero() {
+		source = changeSplitMidpoint
+		first, last := messagesData[0].Timestamp, messagesData[len(messagesData)-1].Timestamp
+		middle := first.Add(last.Sub(first) / 2)
+		splitDate = time.Date(middle.Year(), middle.Month(), middle.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	type halfCounts struct {
+		messages     int
+		byUser       map[string]int
+		emojis       map[string]int
+		replySeconds map[string]float64
+		replies      map[string]int
+		lastInHalf   *ParsedMessage
+	}
+	newHalf := func() *halfCounts {
+		return &halfCounts{
+			byUser:       make(map[string]int),
+			emojis:       make(map[string]int),
+			replySeconds: make(map[string]float64),
+			replies:      make(map[string]int),
+		}
+	}
+	before, after := newHalf(), newHalf()
+	members := make(map[string]struct{})
+	for i := range messagesData {
+		msg := &messagesData[i]
+		half := after
+		if msg.Timestamp.Before(splitDate) {
+			half = before
+		}
+		members[msg.Sender] = struct{}{}
+		half.messages++
+		half.byUser[msg.Sender]++
+		half.emojis[msg.Sender] += countEmojiRunes(msg.OriginalMessage)
+		if prev := half.lastInHalf; prev != nil && prev.Sender != msg.Sender {
+			gap := msg.Timestamp.Sub(prev.Timestamp)
+			if gap <= convoBreak && gap > 5*time.Second && gap < 12*time.Hour {
+				half.replySeconds[msg.Sender] += gap.Seconds()
+				half.replies[msg.Sender]++
+			}
+		}
+		half.lastInHalf = msg
+	}
+	if before.messages == 0 || after.messages == 0 {
+		return nil
+	}
+
+	changes := &ChatChanges{
+		SplitDate:      splitDate.Format("2006-01-02"),
+		SplitSource:    source,
+		BeforeMessages: before.messages,
+		AfterMessages:  after.messages,
+		Members:        make(map[string]MemberChange, len(members)),
+	}
+	for user := range members {
+		change := MemberChange{
+			MessageSharePct: newPeriodDelta(
+				float64(before.byUser[user])*100/float64(before.messages),
+				float64(after.byUser[user])*100/float64(after.messages),
+			),
+		}
+		if before.replies[user] > 0 && after.replies[user] > 0 {
+			delta := newPeriodDelta(
+				before.replySeconds[user]/float64(before.replies[user])/60,
+				after.replySeconds[user]/float64(after.replies[user])/60,
+			)
+			change.ResponseTimeMinutes = &delta
+		}
+		if before.byUser[user] > 0 && after.byUser[user] > 0 {
+			delta := newPeriodDelta(
+				float64(before.emojis[user])/float64(before.byUser[user]),
+				float64(after.emojis[user])/float64(after.byUser[user]),
+			)
+			change.EmojisPerMessage = &delta
+		}
+		changes.Members[user] = change
+
+		shift := change.MessageSharePct.Change
+		biggest := changes.BiggestShift
+		if biggest == nil || math.Abs(shift) > math.Abs(biggest.Value) || (math.Abs(shift) == math.Abs(biggest.Value) && user < biggest.User) {
+			changes.BiggestShift = &AverageChampion{User: user, Value: shift}
+		}
+	}
+	if changes.BiggestShift != nil && changes.BiggestShift.Value == 0 {
+		changes.BiggestShift = nil
+	}
+	return changes
+}
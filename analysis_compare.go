@@ -0,0 +1,169 @@
+package main
+
+import (
+	"sort"
+
+	"golang.org/x/exp/maps"
+)
+
+// ComparedChat is the headline numbers of one side of a comparison.
+type ComparedChat struct {
+	ChatName                   string   `json:"chat_name"`
+	AnalysisID                 string   `json:"analysis_id,omitempty"`
+	TotalMessages              int      `json:"total_messages"`
+	Participants               int      `json:"participants"`
+	DaysActive                 int      `json:"days_active"`
+	MessagesPerDay             float64  `json:"messages_per_day"`
+	AverageResponseTimeMinutes *float64 `json:"average_response_time_minutes,omitempty"`
+	TopEmojis                  []string `json:"top_emojis"`
+}
+
+// ParticipantOverlap splits the members of two chats by where they appear.
+// Names are matched exactly, so save contacts the same way in both exports
+// (or send a names mapping) for people to line up.
+type ParticipantOverlap struct {
+	Shared []string `json:"shared"`
+	OnlyA  []string `json:"only_a"`
+	OnlyB  []string `json:"only_b"`
+}
+
+// ResponseTimeComparison compares the average reply time of two chats.
+// DifferenceMinutes is A minus B, so a negative value means A replies faster.
+type ResponseTimeComparison struct {
+	DifferenceMinutes float64 `json:"difference_minutes"`
+	Ratio             float64 `json:"ratio,omitempty"`
+	Faster            string  `json:"faster,omitempty"`
+}
+
+// EmojiOverlap compares the top emojis of two chats. OverlapPct is the shared
+// share of all the top emojis between them.
+type EmojiOverlap struct {
+	Shared     []string `json:"shared"`
+	OnlyA      []string `json:"only_a"`
+	OnlyB      []string `json:"only_b"`
+	OverlapPct float64  `json:"overlap_pct"`
+}
+
+// ChatComparison is the diff-style report for POST /compare. Ratios are A
+// divided by B and are left out when B has nothing to divide by.
+type ChatComparison struct {
+	A                   ComparedChat            `json:"a"`
+	B                   ComparedChat            `json:"b"`
+	MessageVolumeRatio  *float64                `json:"message_volume_ratio,omitempty"`
+	MessagesPerDayRatio *float64                `json:"messages_per_day_ratio,omitempty"`
+	Participants        ParticipantOverlap      `json:"participants"`
+	ResponseTime        *ResponseTimeComparison `json:"response_time,omitempty"`
+	Emojis              EmojiOverlap            `json:"emojis"`
+}
+
+const (
+	compareSideA = "a"
+	compareSideB = "b"
+)
+
+// compareResults builds the comparison of two analysed chats. Both results
+// must have stats.
+func compareResults(a, b *AnalysisResult) *ChatComparison {
+	comparison := &ChatComparison{
+		A: summarizeComparedChat(a),
+		B: summarizeComparedChat(b),
+	}
+	comparison.MessageVolumeRatio = ratioOf(float64(comparison.A.TotalMessages), float64(comparison.B.TotalMessages))
+	comparison.MessagesPerDayRatio = ratioOf(comparison.A.MessagesPerDay, comparison.B.MessagesPerDay)
+
+	shared, onlyA, onlyB := splitOverlap(sortedUsers(a.Stats.UserMessageCount), sortedUsers(b.Stats.UserMessageCount))
+	comparison.Participants = ParticipantOverlap{Shared: shared, OnlyA: onlyA, OnlyB: onlyB}
+
+	if ra, rb := comparison.A.AverageResponseTimeMinutes, comparison.B.AverageResponseTimeMinutes; ra != nil && rb != nil {
+		response := &ResponseTimeComparison{DifferenceMinutes: roundFloat(*ra-*rb, 2)}
+		if ratio := ratioOf(*ra, *rb); ratio != nil {
+			response.Ratio = *ratio
+		}
+		switch {
+		case *ra < *rb:
+			response.Faster = compareSideA
+		case *rb < *ra:
+			response.Faster = compareSideB
+		}
+		comparison.ResponseTime = response
+	}
+
+	shared, onlyA, onlyB = splitOverlap(comparison.A.TopEmojis, comparison.B.TopEmojis)
+	comparison.Emojis = EmojiOverlap{Shared: shared, OnlyA: onlyA, OnlyB: onlyB}
+	if union := len(shared) + len(onlyA) + len(onlyB); union > 0 {
+		comparison.Emojis.OverlapPct = roundFloat(float64(len(shared))*100/float64(union), 2)
+	}
+	return comparison
+}
+
+func summarizeComparedChat(result *AnalysisResult) ComparedChat {
+	stats := result.Stats
+	summary := ComparedChat{
+		ChatName:                   result.ChatName,
+		AnalysisID:                 result.ID,
+		TotalMessages:              stats.TotalMessages,
+		Participants:               len(stats.UserMessageCount),
+		DaysActive:                 stats.DaysActive,
+		AverageResponseTimeMinutes: stats.AverageResponseTimeMinutes,
+		TopEmojis:                  rankedKeys(stats.CommonEmojis),
+	}
+	if stats.DaysActive > 0 {
+		summary.MessagesPerDay = roundFloat(float64(stats.TotalMessages)/float64(stats.DaysActive), 2)
+	}
+	return summary
+}
+
+// ratioOf returns a/b rounded, or nil when b is zero.
+func ratioOf(a, b float64) *float64 {
+	if b == 0 {
+		return nil
+	}
+	ratio := roundFloat(a/b, 2)
+	return &ratio
+}
+
+// splitOverlap returns what a and b share and what only each has, keeping
+// the order of a for shared items.
+func splitOverlap(a, b []string) (shared, onlyA, onlyB []string) {
+	inB := make(map[string]struct{}, len(b))
+	for _, item := range b {
+		inB[item] = struct{}{}
+	}
+	inA := make(map[string]struct{}, len(a))
+	shared, onlyA, onlyB = []string{}, []string{}, []string{}
+	for _, item := range a {
+		inA[item] = struct{}{}
+		if _, ok := inB[item]; ok {
+			shared = append(shared, item)
+		} else {
+			onlyA = append(onlyA, item)
+		}
+	}
+	for _, item := range b {
+		if _, ok := inA[item]; !ok {
+			onlyB = append(onlyB, item)
+		}
+	}
+	return shared, onlyA, onlyB
+}
+
+func sortedUsers(counts UserMessageCount) []string {
+	users := maps.Keys(counts)
+	sort.Strings(users)
+	return users
+}
+
+// rankedKeys returns the keys of counts, most frequent first.
+func rankedKeys(counts StringIntMap) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
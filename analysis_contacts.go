@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxContactNames          = 1000
+	maxContactNameLength     = 64
+	minContactNumberDigits   = 5
+	contactNamesHeaderNumber = "number"
+)
+
+var (
+	errContactNamesTooMany = fmt.Errorf("names mapping has more than %d entries", maxContactNames)
+	errContactNameTooLong  = fmt.Errorf("names must be at most %d characters", maxContactNameLength)
+)
+
+// contactNames maps a sender as the export shows it, keyed by contactKey, to
+// the name to show instead.
+type contactNames map[string]string
+
+// parseContactNames reads the names upload: a JSON object of
+// {"+49 151 2345678": "Anna"} or CSV rows of number,name with an optional
+// header row.
+func parseContactNames(raw string) (contactNames, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	pairs := make(map[string]string)
+	if strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal([]byte(trimmed), &pairs); err != nil {
+			return nil, fmt.Errorf("names JSON must be an object of number to name: %w", err)
+		}
+	} else {
+		reader := csv.NewReader(bytes.NewReader([]byte(trimmed)))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		for row := 0; ; row++ {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("names CSV: %w", err)
+			}
+			if len(record) != 2 {
+				return nil, fmt.Errorf("names CSV line %d must have a number and a name", row+1)
+			}
+			if row == 0 && strings.EqualFold(strings.TrimSpace(record[0]), contactNamesHeaderNumber) {
+				continue
+			}
+			pairs[record[0]] = record[1]
+		}
+	}
+
+	if len(pairs) > maxContactNames {
+		return nil, errContactNamesTooMany
+	}
+	names := make(contactNames, len(pairs))
+	for sender, name := range pairs {
+		name = strings.TrimSpace(name)
+		key := contactKey(sender)
+		if key == "" || name == "" {
+			continue
+		}
+		if len([]rune(name)) > maxContactNameLength {
+			return nil, errContactNameTooLong
+		}
+		names[key] = name
+	}
+	return names, nil
+}
+
+// contactKey lets a mapping match however the export spaced or wrapped a
+// number: Android wraps numbers in invisible direction marks and exports mix
+// regular and non-breaking spaces. Anything that is not a phone number is
+// matched as written.
+func contactKey(sender string) string {
+	sender = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, sender))
+
+	var digits strings.Builder
+	for _, r := range sender {
+		switch {
+		case unicode.IsDigit(r):
+			digits.WriteRune(r)
+		case r == '+' || r == '-' || r == '(' || r == ')' || r == '.' || unicode.IsSpace(r):
+		default:
+			return sender
+		}
+	}
+	if digits.Len() < minContactNumberDigits {
+		return sender
+	}
+	if strings.HasPrefix(sender, "+") {
+		return "+" + digits.String()
+	}
+	return digits.String()
+}
+
+func (n contactNames) rename(sender string) string {
+	if name, ok := n[contactKey(sender)]; ok {
+		return name
+	}
+	return sender
+}
+
+// applyContactNames swaps mapped senders for their names everywhere the
+// parser recorded one, so stats, group events and the AI only ever see the
+// names. Two numbers mapped to the same name are counted as one person.
+func applyContactNames(preprocessed *preprocessResult, names contactNames) {
+	if len(names) == 0 {
+		return
+	}
+	for i := range preprocessed.messages {
+		preprocessed.messages[i].Sender = names.rename(preprocessed.messages[i].Sender)
+	}
+	for i := range preprocessed.groupEvents {
+		event := &preprocessed.groupEvents[i]
+		event.Actor = names.rename(event.Actor)
+		if event.Target != "" {
+			event.Target = names.rename(event.Target)
+		}
+	}
+
+	markers := &preprocessed.markers
+	for _, counts := range []map[string]int{markers.Deleted, markers.Edited, markers.Polls, markers.Locations, markers.Sent} {
+		renameCounts(counts, names)
+	}
+	for i := range markers.PollList {
+		markers.PollList[i].Creator = names.rename(markers.PollList[i].Creator)
+	}
+	for i := range markers.Attachments {
+		markers.Attachments[i].Sender = names.rename(markers.Attachments[i].Sender)
+	}
+	for i := range markers.Laughs {
+		markers.Laughs[i].Sender = names.rename(markers.Laughs[i].Sender)
+		if markers.Laughs[i].After != "" {
+			markers.Laughs[i].After = names.rename(markers.Laughs[i].After)
+		}
+	}
+	renamed := make(UserStringIntMap, len(markers.DeletedByMonth))
+	for sender, months := range markers.DeletedByMonth {
+		name := names.rename(sender)
+		if _, ok := renamed[name]; !ok {
+			renamed[name] = make(map[string]int)
+		}
+		for month, count := range months {
+			renamed[name][month] += count
+		}
+	}
+	markers.DeletedByMonth = renamed
+}
+
+// renameCounts re-keys a per-sender count map in place.
+func renameCounts(counts map[string]int, names contactNames) {
+	renamed := make(map[string]int, len(counts))
+	for sender, count := range counts {
+		renamed[names.rename(sender)] += count
+	}
+	clear(counts)
+	for sender, count := range renamed {
+		counts[sender] = count
+	}
+}
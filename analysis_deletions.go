@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+)
+
+const (
+	// deletionSpikeFactor is how many times the chat's overall deletion rate a
+	// month must reach to be flagged, given at least deletionSpikeMinDeleted
+	// deletions that month.
+	deletionSpikeFactor     = 2.0
+	deletionSpikeMinDeleted = 3
+)
+
+type DeletionRatePoint struct {
+	Month   string  `json:"month"`
+	Deleted int     `json:"deleted"`
+	RatePct float64 `json:"rate_pct"`
+}
+
+type DeletionTrend struct {
+	OverallRatePct float64                        `json:"overall_rate_pct"`
+	Monthly        []DeletionRatePoint            `json:"monthly"`
+	UserMonthly    map[string][]DeletionRatePoint `json:"user_monthly"`
+	SpikeMonths    []string                       `json:"spike_months"`
+}
+
+// calculateDeletionTrend reports, per month, the share of messages that were
+// deleted (deleted / (kept + deleted)) for the chat and for each user, and
+// flags months where the chat deleted far more than usual.
+func calculateDeletionTrend(deletedByMonth, keptByMonth UserStringIntMap) *DeletionTrend {
+	if len(deletedByMonth) == 0 {
+		return nil
+	}
+
+	monthSet := make(map[string]struct{})
+	chatDeleted := make(map[string]int)
+	chatKept := make(map[string]int)
+	for _, months := range deletedByMonth {
+		for month, count := range months {
+			monthSet[month] = struct{}{}
+			chatDeleted[month] += count
+		}
+	}
+	for _, months := range keptByMonth {
+		for month, count := range months {
+			monthSet[month] = struct{}{}
+			chatKept[month] += count
+		}
+	}
+	months := make([]string, 0, len(monthSet))
+	for month := range monthSet {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+
+	totalDeleted, totalKept := 0, 0
+	for _, month := range months {
+		totalDeleted += chatDeleted[month]
+		totalKept += chatKept[month]
+	}
+
+	trend := &DeletionTrend{
+		OverallRatePct: deletionRatePct(totalDeleted, totalKept),
+		Monthly:        make([]DeletionRatePoint, 0, len(months)),
+		UserMonthly:    make(map[string][]DeletionRatePoint),
+		SpikeMonths:    []string{},
+	}
+	for _, month := range months {
+		point := DeletionRatePoint{Month: month, Deleted: chatDeleted[month], RatePct: deletionRatePct(chatDeleted[month], chatKept[month])}
+		trend.Monthly = append(trend.Monthly, point)
+		if point.Deleted >= deletionSpikeMinDeleted && point.RatePct >= trend.OverallRatePct*deletionSpikeFactor {
+			trend.SpikeMonths = append(trend.SpikeMonths, month)
+		}
+	}
+
+	users := make(map[string]struct{})
+	for user := range deletedByMonth {
+		users[user] = struct{}{}
+	}
+	for user := range keptByMonth {
+		users[user] = struct{}{}
+	}
+	for user := range users {
+		points := make([]DeletionRatePoint, 0, len(months))
+		for _, month := range months {
+			deleted := deletedByMonth[user][month]
+			points = append(points, DeletionRatePoint{Month: month, Deleted: deleted, RatePct: deletionRatePct(deleted, keptByMonth[user][month])})
+		}
+		trend.UserMonthly[user] = points
+	}
+	return trend
+}
+
+func deletionRatePct(deleted, kept int) float64 {
+	if deleted+kept == 0 {
+		return 0
+	}
+	return roundFloat(float64(deleted)*100.0/float64(deleted+kept), 2)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// describeCharts writes a one or two sentence summary of each chart-shaped
+// stat, keyed by its JSON field, so screen readers and text-only exports get
+// the same takeaway as the chart. Charts that were omitted are not described.
+func describeCharts(stats *ChatStatistics) map[string]string {
+	descriptions := make(map[string]string)
+	add := func(field, description string) {
+		if description != "" {
+			descriptions[field] = description
+		}
+	}
+	add("most_active_users_pct", describeActiveUsers(stats.MostActiveUsersPct))
+	add("user_monthly_activity", describeMonthlyActivity(stats.UserMonthlyActivity))
+	add("calendar_heatmap", describeCalendarHeatmap(stats.CalendarHeatmap))
+	add("monthly_volume", describeMonthlyVolume(stats.MonthlyVolume))
+	add("chat_energy", describeChatEnergy(stats.ChatEnergy))
+	add("user_interaction_matrix", describeInteractions(stats.StrongestPairs))
+	add("user_response_matrix", describeResponseAsymmetry(stats.ResponseAsymmetries))
+	return descriptions
+}
+
+func describeActiveUsers(shares PercentageMap) string {
+	if len(shares) < 2 {
+		return ""
+	}
+	users := make([]string, 0, len(shares))
+	for user := range shares {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if shares[users[i]] != shares[users[j]] {
+			return shares[users[i]] > shares[users[j]]
+		}
+		return users[i] < users[j]
+	})
+	return fmt.Sprintf("%s sent the most messages (%s), followed by %s (%s).",
+		users[0], formatPct(shares[users[0]]), users[1], formatPct(shares[users[1]]))
+}
+
+func describeMonthlyActivity(series []UserActivityChartData) string {
+	totals := make(map[string]int)
+	top := make(map[string]ChampionInfo)
+	for _, user := range series {
+		for _, point := range user.Data {
+			totals[point.X] += point.Y
+			if best, ok := top[point.X]; !ok || point.Y > best.Count || (point.Y == best.Count && user.ID < best.User) {
+				top[point.X] = ChampionInfo{User: user.ID, Count: point.Y}
+			}
+		}
+	}
+
+	peak := ""
+	for month, total := range totals {
+		if peak == "" || total > totals[peak] || (total == totals[peak] && month < peak) {
+			peak = month
+		}
+	}
+	if peak == "" || totals[peak] == 0 {
+		return ""
+	}
+
+	description := fmt.Sprintf("Activity peaked in %s at %s", formatMonth(peak), countNoun(totals[peak], "message"))
+	if len(series) > 1 {
+		description += fmt.Sprintf(", mostly from %s (%s)", top[peak].User, formatThousands(top[peak].Count))
+	}
+	return description + "."
+}
+
+func describeCalendarHeatmap(heatmap *CalendarHeatmap) string {
+	if heatmap == nil || len(heatmap.Data) == 0 {
+		return ""
+	}
+	busiest := heatmap.Data[0]
+	activeDays := 0
+	for _, day := range heatmap.Data {
+		if day.Value > 0 {
+			activeDays++
+		}
+		if day.Value > busiest.Value {
+			busiest = day
+		}
+	}
+	date, err := time.Parse("2006-01-02", busiest.Day)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("The busiest day was %s with %s. Messages were sent on %s of %s.",
+		date.Format("2 January 2006"), countNoun(busiest.Value, "message"), formatThousands(activeDays), countNoun(len(heatmap.Data), "day"))
+}
+
+func describeMonthlyVolume(volume *MonthlyVolumeTrend) string {
+	if volume == nil || volume.ChangePct == nil {
+		return ""
+	}
+	change := *volume.ChangePct
+	switch volume.Trend {
+	case volumeGrowing:
+		return fmt.Sprintf("The chat is growing: recent months averaged %s more messages than the months before.", formatPct(change))
+	case volumeShrinking:
+		return fmt.Sprintf("The chat is quieting down: recent months averaged %s fewer messages than the months before.", formatPct(-change))
+	}
+	return "Monthly message volume has been steady."
+}
+
+func describeChatEnergy(energy *ChatEnergy) string {
+	if energy == nil || energy.PeakEra == nil {
+		return ""
+	}
+	from, errFrom := time.Parse("2006-01-02", energy.PeakEra.From)
+	to, errTo := time.Parse("2006-01-02", energy.PeakEra.To)
+	if errFrom != nil || errTo != nil {
+		return ""
+	}
+	return fmt.Sprintf("The chat had the most energy from %s to %s.",
+		from.Format("2 January 2006"), to.Format("2 January 2006"))
+}
+
+func describeInteractions(pairs []InteractionPair) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	pair := pairs[0]
+	return fmt.Sprintf("%s and %s reply to each other the most, %s or %s of all replies.",
+		pair.Users[0], pair.Users[1], countNoun(pair.Interactions, "reply"), formatPct(pair.SharePct))
+}
+
+func describeResponseAsymmetry(asymmetries []ResponseAsymmetry) string {
+	if len(asymmetries) == 0 {
+		return ""
+	}
+	top := asymmetries[0]
+	return fmt.Sprintf("%s replies to %s in %s on average, but %s takes %s to reply to %s.",
+		top.FastReplier, top.SlowReplier, formatMinutes(top.FastReplyMinutes), top.SlowReplier, formatMinutes(top.SlowReplyMinutes), top.FastReplier)
+}
+
+// formatMinutes writes a duration for reading, e.g. "4 min" or "2.5 hours".
+func formatMinutes(minutes float64) string {
+	if minutes < 60 {
+		return fmt.Sprintf("%.0f min", math.Max(1, math.Round(minutes)))
+	}
+	hours := strings.TrimSuffix(fmt.Sprintf("%.1f", minutes/60), ".0")
+	if hours == "1" {
+		return "1 hour"
+	}
+	return hours + " hours"
+}
+
+// countNoun writes a count with its noun, e.g. "1 message" or "1,204 replies".
+func countNoun(n int, singular string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	plural := singular + "s"
+	if strings.HasSuffix(singular, "y") && !strings.ContainsRune("aeiou", rune(singular[len(singular)-2])) {
+		plural = strings.TrimSuffix(singular, "y") + "ies"
+	}
+	return formatThousands(n) + " " + plural
+}
+
+func formatMonth(month string) string {
+	date, err := time.Parse("2006-01", month)
+	if err != nil {
+		return month
+	}
+	return date.Format("January 2006")
+}
+
+// formatPct writes a percentage without trailing zeros, e.g. "35%" or "12.5%".
+func formatPct(pct float64) string {
+	if pct == math.Trunc(pct) {
+		return fmt.Sprintf("%.0f%%", pct)
+	}
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.1f", pct), "0"), ".") + "%"
+}
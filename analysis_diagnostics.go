@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"bloop-go-server/pkg/parser"
+)
+
+// ParseDiagnostics explains how the upload was read; see parser.Diagnostics.
+// AliasSuggestions lists senders that look like one person under several
+// names.
+type ParseDiagnostics struct {
+	parser.Diagnostics
+	AliasSuggestions []AliasSuggestion `json:"alias_suggestions,omitempty"`
+}
+
+// ParseRatioError is returned in strict mode when too few message lines parse
+// for the stats to be trusted.
+type ParseRatioError struct {
+	Diagnostics ParseDiagnostics
+	MinPct      int
+}
+
+func (e *ParseRatioError) Error() string {
+	return fmt.Sprintf("only %.2f%% of message lines could be parsed, below the strict minimum of %d%%", e.Diagnostics.ParseRatioPct, e.MinPct)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"bloop-go-server/pkg/parser"
+)
+
+const (
+	digestWeekly  = "weekly"
+	digestMonthly = "monthly"
+
+	digestPromptProfile   = "digest"
+	digestTopContributors = 3
+)
+
+var digestPeriodDays = map[string]int{
+	digestWeekly:  7,
+	digestMonthly: 30,
+}
+
+func isValidDigestPeriod(period string) bool {
+	_, ok := digestPeriodDays[period]
+	return ok
+}
+
+// AdminDigest summarises the last week or 30 days of a group, ending at the
+// chat's last message, for an admin to post back into the group. Text is the
+// ready-to-post version of the same facts; AIParagraph is only filled in when
+// the client asked for it and the AI call succeeded.
+type AdminDigest struct {
+	Period              string         `json:"period"`
+	Start               string         `json:"start"`
+	End                 string         `json:"end"`
+	Messages            int            `json:"messages"`
+	PreviousMessages    int            `json:"previous_messages"`
+	ActivityChangePct   *float64       `json:"activity_change_pct"`
+	ActiveMembers       int            `json:"active_members"`
+	NewMembers          []string       `json:"new_members"`
+	TopContributors     []ChampionInfo `json:"top_contributors"`
+	UnansweredQuestions int            `json:"unanswered_questions"`
+	Text                string         `json:"text"`
+	AIParagraph         string         `json:"ai_paragraph,omitempty"`
+}
+
+// calculateAdminDigest builds the digest and returns the messages inside the
+// digest window for the optional AI paragraph. New members are people added to
+// or joining the group in the window, plus anyone whose first message falls
+// in it. A question counts as unanswered when nobody else writes before the
+// conversation breaks.
+func calculateAdminDigest(messagesData []ParsedMessage, events []parser.GroupEvent, period string, convoBreak time.Duration) (*AdminDigest, []ParsedMessage) {
+	days, ok := digestPeriodDays[period]
+	if !ok || len(messagesData) == 0 {
+		return nil, nil
+	}
+
+	end := messagesData[len(messagesData)-1].Timestamp
+	start := end.AddDate(0, 0, -days)
+	previousStart := start.AddDate(0, 0, -days)
+
+	digest := &AdminDigest{
+		Period:          period,
+		Start:           start.Format("2006-01-02"),
+		End:             end.Format("2006-01-02"),
+		NewMembers:      []string{},
+		TopContributors: []ChampionInfo{},
+	}
+
+	counts := make(map[string]int)
+	firstSeen := make(map[string]time.Time)
+	var window []ParsedMessage
+	for i, msg := range messagesData {
+		if _, ok := firstSeen[msg.Sender]; !ok {
+			firstSeen[msg.Sender] = msg.Timestamp
+		}
+		switch {
+		case msg.Timestamp.After(start):
+			digest.Messages++
+			counts[msg.Sender]++
+			window = append(window, msg)
+			if isQuestion(msg.OriginalMessage) && !answeredBeforeBreak(messagesData, i, convoBreak) {
+				digest.UnansweredQuestions++
+			}
+		case msg.Timestamp.After(previousStart):
+			digest.PreviousMessages++
+		}
+	}
+	digest.ActiveMembers = len(counts)
+
+	// Only compare against a full previous period.
+	if !messagesData[0].Timestamp.After(previousStart) && digest.PreviousMessages > 0 {
+		change := roundFloat(float64(digest.Messages-digest.PreviousMessages)/float64(digest.PreviousMessages)*100, 2)
+		digest.ActivityChangePct = &change
+	}
+
+	newMembers := make(map[string]struct{})
+	for _, event := range events {
+		if event.Type != parser.GroupEventAdded && event.Type != parser.GroupEventJoined {
+			continue
+		}
+		when, err := time.Parse("2006-01-02 15:04", event.Timestamp)
+		if err != nil || !when.After(start) {
+			continue
+		}
+		member := event.Actor
+		if event.Type == parser.GroupEventAdded {
+			member = event.Target
+		}
+		newMembers[member] = struct{}{}
+	}
+	// Someone who wrote from the very start of the export is not new, the
+	// export just doesn't go back further.
+	if messagesData[0].Timestamp.Before(start) {
+		for user, first := range firstSeen {
+			if first.After(start) {
+				newMembers[user] = struct{}{}
+			}
+		}
+	}
+	for member := range newMembers {
+		digest.NewMembers = append(digest.NewMembers, member)
+	}
+	sort.Strings(digest.NewMembers)
+
+	for user, count := range counts {
+		digest.TopContributors = append(digest.TopContributors, ChampionInfo{User: user, Count: count})
+	}
+	sort.Slice(digest.TopContributors, func(i, j int) bool {
+		if digest.TopContributors[i].Count != digest.TopContributors[j].Count {
+			return digest.TopContributors[i].Count > digest.TopContributors[j].Count
+		}
+		return digest.TopContributors[i].User < digest.TopContributors[j].User
+	})
+	if len(digest.TopContributors) > digestTopContributors {
+		digest.TopContributors = digest.TopContributors[:digestTopContributors]
+	}
+
+	digest.Text = formatDigestText(digest, start, end)
+	return digest, window
+}
+
+func isQuestion(text string) bool {
+	return strings.HasSuffix(strings.TrimSpace(text), "?")
+}
+
+func answeredBeforeBreak(messagesData []ParsedMessage, index int, convoBreak time.Duration) bool {
+	asked := messagesData[index]
+	for _, next := range messagesData[index+1:] {
+		if next.Timestamp.Sub(asked.Timestamp) > convoBreak {
+			return false
+		}
+		if next.Sender != asked.Sender {
+			return true
+		}
+	}
+	return false
+}
+
+func formatDigestText(digest *AdminDigest, start, end time.Time) string {
+	label := "Weekly"
+	previous := "last week"
+	if digest.Period == digestMonthly {
+		label = "Monthly"
+		previous = "the 30 days before"
+	}
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("%s digest (%s – %s)", label, start.Format("Jan 2"), end.Format("Jan 2")))
+
+	activity := fmt.Sprintf("Messages: %d from %d members", digest.Messages, digest.ActiveMembers)
+	if digest.ActivityChangePct != nil {
+		change := *digest.ActivityChangePct
+		direction := "up"
+		if change < 0 {
+			direction = "down"
+		}
+		activity += fmt.Sprintf(" (%s %.0f%% from %s)", direction, math.Abs(change), previous)
+	}
+	lines = append(lines, activity)
+
+	if len(digest.TopContributors) > 0 {
+		parts := make([]string, len(digest.TopContributors))
+		for i, c := range digest.TopContributors {
+			parts[i] = fmt.Sprintf("%s (%d)", c.User, c.Count)
+		}
+		lines = append(lines, "Top contributors: "+strings.Join(parts, ", "))
+	}
+	if len(digest.NewMembers) > 0 {
+		lines = append(lines, "New members: "+strings.Join(digest.NewMembers, ", "))
+	}
+	lines = append(lines, fmt.Sprintf("Unanswered questions: %d", digest.UnansweredQuestions))
+	return strings.Join(lines, "\n")
+}
+
+// WriteDigestParagraph asks the AI for a short recap of the digest window to
+// post alongside the deterministic facts.
+func WriteDigestParagraph(ctx context.Context, data []ParsedMessage, gapHours float64, chatName string, facts string, model string) (string, error) {
+	if currentAISettings().apiKey == "" {
+		return "", nil
+	}
+
+	stratifiedData, _ := stratifyMessages(groupMessagesByTopic(data, gapHours))
+	if len(stratifiedData) == 0 {
+		return "", nil
+	}
+	messagesJSON, err := json.MarshalIndent(stratifiedData, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize messages for LLM: %w", err)
+	}
+
+	systemPrompt, err := renderSystemPrompt(digestPromptProfile, promptTemplateData{
+		ChatName: chatName,
+		Digest:   facts,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to build digest prompt: %w", err)
+	}
+
+	result, err := invokeGroq(ctx, model, []GroqMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: string(messagesJSON)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("AI digest failed: %w", err)
+	}
+	output, violations, err := parseAIOutput(result, nil, aiOutputSchema{})
+	if err != nil {
+		return "", err
+	}
+	if len(violations) > 0 {
+		return "", errors.New("AI digest failed: " + strings.Join(violations, "; "))
+	}
+	return strings.TrimSpace(output.Summary), nil
+}
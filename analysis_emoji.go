@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	topEmojiCombos       = 6
+	minSignatureComboUse = 2
+)
+
+type EmojiCombo struct {
+	Combo string `json:"combo"`
+	Count int    `json:"count"`
+}
+
+// isEmojiBase reports whether r can start an emoji. It covers the blocks of
+// emojiPattern plus Symbols and Pictographs Extended-A.
+func isEmojiBase(r rune) bool {
+	switch {
+	case r >= 0x1F300 && r <= 0x1F5FF,
+		r >= 0x1F600 && r <= 0x1F64F,
+		r >= 0x1F680 && r <= 0x1F6FF,
+		r >= 0x1F900 && r <= 0x1F9FF,
+		r >= 0x1FA70 && r <= 0x1FAFF,
+		r >= 0x2600 && r <= 0x27BF:
+		return true
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// isEmojiModifier covers runes that attach to the preceding emoji: variation
+// selectors, skin tones, the keycap mark and tag characters.
+func isEmojiModifier(r rune) bool {
+	return (r >= 0xFE00 && r <= 0xFE0F) ||
+		(r >= 0x1F3FB && r <= 0x1F3FF) ||
+		r == 0x20E3 ||
+		(r >= 0xE0020 && r <= 0xE007F)
+}
+
+const zeroWidthJoiner = 0x200D
+
+// splitEmojiRuns returns the runs of directly adjacent emojis in text, each run
+// split into whole emojis. ZWJ sequences (👨‍👩‍👧), skin tones, variation
+// selectors and flag pairs stay together as a single emoji.
+func splitEmojiRuns(text string) [][]string {
+	runes := []rune(text)
+	var runs [][]string
+	var current []string
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if !isEmojiBase(r) && !isRegionalIndicator(r) {
+			if len(current) > 0 {
+				runs = append(runs, current)
+				current = nil
+			}
+			i++
+			continue
+		}
+
+		start := i
+		if isRegionalIndicator(r) {
+			i++
+			if i < len(runes) && isRegionalIndicator(runes[i]) {
+				i++
+			}
+		} else {
+			i++
+			for i < len(runes) {
+				if isEmojiModifier(runes[i]) {
+					i++
+				} else if runes[i] == zeroWidthJoiner && i+1 < len(runes) && isEmojiBase(runes[i+1]) {
+					i += 2
+				} else {
+					break
+				}
+			}
+		}
+		current = append(current, string(runes[start:i]))
+	}
+	if len(current) > 0 {
+		runs = append(runs, current)
+	}
+	return runs
+}
+
+// calculateEmojiCombos counts runs of two or more adjacent emojis as single
+// units, returning the chat's most common combos and each user's signature
+// combo (their most used one, if used at least twice).
+func calculateEmojiCombos(messagesData []ParsedMessage) (StringIntMap, map[string]EmojiCombo) {
+	comboCounter := make(map[string]int)
+	userComboCounter := make(UserStringIntMap)
+
+	for _, msg := range messagesData {
+		for _, run := range splitEmojiRuns(msg.OriginalMessage) {
+			if len(run) < 2 {
+				continue
+			}
+			combo := strings.Join(run, "")
+			comboCounter[combo]++
+			if _, ok := userComboCounter[msg.Sender]; !ok {
+				userComboCounter[msg.Sender] = make(map[string]int)
+			}
+			userComboCounter[msg.Sender][combo]++
+		}
+	}
+
+	signatures := make(map[string]EmojiCombo)
+	for user, combos := range userComboCounter {
+		keys := make([]string, 0, len(combos))
+		for combo := range combos {
+			keys = append(keys, combo)
+		}
+		sort.Strings(keys)
+
+		best := EmojiCombo{}
+		for _, combo := range keys {
+			if combos[combo] > best.Count {
+				best = EmojiCombo{Combo: combo, Count: combos[combo]}
+			}
+		}
+		if best.Count >= minSignatureComboUse {
+			signatures[user] = best
+		}
+	}
+
+	return countTopN(comboCounter, topEmojiCombos), signatures
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// energyPeakWeeks is how many consecutive weeks make up the peak era.
+const energyPeakWeeks = 4
+
+// EnergyWeek is one Monday-to-Sunday week. MessagesPerActiveHour divides the
+// week's messages by the clock hours that had any; Balance is 0–1, how evenly
+// those messages were spread across all members. Energy is the two
+// multiplied, so a busy week carried by one person scores low.
+type EnergyWeek struct {
+	WeekStart             string  `json:"week_start"`
+	Messages              int     `json:"messages"`
+	ActiveHours           int     `json:"active_hours"`
+	MessagesPerActiveHour float64 `json:"messages_per_active_hour"`
+	Balance               float64 `json:"balance"`
+	Energy                float64 `json:"energy"`
+}
+
+// EnergyEra is the stretch of consecutive weeks with the highest average
+// energy. To is the last day of its last week.
+type EnergyEra struct {
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	AverageEnergy float64 `json:"average_energy"`
+}
+
+// ChatEnergy lists every week from the first message to the last, silent
+// weeks included with zero energy, and the peak era.
+type ChatEnergy struct {
+	Weeks   []EnergyWeek `json:"weeks"`
+	PeakEra *EnergyEra   `json:"peak_era"`
+}
+
+func calculateChatEnergy(messagesData []ParsedMessage) *ChatEnergy {
+	if len(messagesData) == 0 {
+		return nil
+	}
+	members := make(map[string]struct{})
+	for _, msg := range messagesData {
+		members[msg.Sender] = struct{}{}
+	}
+	if len(members) < 2 {
+		return nil
+	}
+
+	type weekCounts struct {
+		messages int
+		hours    map[string]struct{}
+		senders  map[string]int
+	}
+	weeks := make(map[string]*weekCounts)
+	for _, msg := range messagesData {
+		key := weekStart(msg.Timestamp).Format("2006-01-02")
+		week, ok := weeks[key]
+		if !ok {
+			week = &weekCounts{hours: make(map[string]struct{}), senders: make(map[string]int)}
+			weeks[key] = week
+		}
+		week.messages++
+		week.hours[msg.Timestamp.Format("2006-01-02 15")] = struct{}{}
+		week.senders[msg.Sender]++
+	}
+
+	energy := &ChatEnergy{Weeks: []EnergyWeek{}}
+	last := weekStart(messagesData[len(messagesData)-1].Timestamp)
+	for start := weekStart(messagesData[0].Timestamp); !start.After(last); start = start.AddDate(0, 0, 7) {
+		entry := EnergyWeek{WeekStart: start.Format("2006-01-02")}
+		if week, ok := weeks[entry.WeekStart]; ok {
+			perHour := float64(week.messages) / float64(len(week.hours))
+			balance := messageBalance(week.senders, len(members))
+			entry.Messages = week.messages
+			entry.ActiveHours = len(week.hours)
+			entry.MessagesPerActiveHour = roundFloat(perHour, 2)
+			entry.Balance = roundFloat(balance, 2)
+			entry.Energy = roundFloat(perHour*balance, 2)
+		}
+		energy.Weeks = append(energy.Weeks, entry)
+	}
+
+	window := min(energyPeakWeeks, len(energy.Weeks))
+	bestStart, bestSum, sum := 0, -1.0, 0.0
+	for i, week := range energy.Weeks {
+		sum += week.Energy
+		if i >= window {
+			sum -= energy.Weeks[i-window].Energy
+		}
+		if i >= window-1 && sum > bestSum {
+			bestStart, bestSum = i-window+1, sum
+		}
+	}
+	if bestSum > 0 {
+		from, _ := time.Parse("2006-01-02", energy.Weeks[bestStart].WeekStart)
+		energy.PeakEra = &EnergyEra{
+			From:          from.Format("2006-01-02"),
+			To:            from.AddDate(0, 0, 7*window-1).Format("2006-01-02"),
+			AverageEnergy: roundFloat(bestSum/float64(window), 2),
+		}
+	}
+	return energy
+}
+
+// weekStart is the Monday that starts t's week.
+func weekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// messageBalance is the normalized entropy of per-member message counts over
+// members people: 1 when all of them sent the same number of messages, 0 when
+// one person sent everything.
+func messageBalance(counts map[string]int, members int) float64 {
+	if members < 2 {
+		return 0
+	}
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log(p)
+	}
+	return entropy / math.Log(float64(members))
+}
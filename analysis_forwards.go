@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// A message is only treated as forwarded content when the same text was
+	// sent at least minForwardCopies times and is long enough not to be a
+	// stock reply like "good night" or "ok see you".
+	minForwardCopies = 3
+	minForwardWords  = 5
+	minForwardRunes  = 30
+	maxForwardedList = 5
+	// forwardPreviewRunes caps the text shown for each forwarded message.
+	forwardPreviewRunes = 120
+)
+
+// ForwardedContent is a long message sent word for word several times, such
+// as a chain message or a good-morning greeting passed around every day.
+type ForwardedContent struct {
+	Text        string `json:"text"`
+	Copies      int    `json:"copies"`
+	Senders     int    `json:"senders"`
+	FirstSent   string `json:"first_sent"`
+	FirstSender string `json:"first_sender"`
+}
+
+// forwardKey normalizes a message for comparing copies: case and spacing
+// don't matter. Messages too short to be forwarded content get "".
+func forwardKey(text string) string {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) < minForwardWords {
+		return ""
+	}
+	key := strings.Join(words, " ")
+	if len([]rune(key)) < minForwardRunes {
+		return ""
+	}
+	return key
+}
+
+// findForwardedContent counts the copies of each forwarded text. It returns
+// the most copied ones for the stats and the set of keys with enough copies
+// to count as forwarded, for collapsing them in the word counts.
+func findForwardedContent(messagesData []ParsedMessage) ([]ForwardedContent, map[string]struct{}) {
+	type copies struct {
+		first   ParsedMessage
+		count   int
+		senders map[string]struct{}
+	}
+	byKey := make(map[string]*copies)
+	for _, msg := range messagesData {
+		key := forwardKey(msg.OriginalMessage)
+		if key == "" {
+			continue
+		}
+		entry, ok := byKey[key]
+		if !ok {
+			entry = &copies{first: msg, senders: make(map[string]struct{})}
+			byKey[key] = entry
+		}
+		entry.count++
+		entry.senders[msg.Sender] = struct{}{}
+	}
+
+	forwarded := make(map[string]struct{})
+	var list []ForwardedContent
+	for key, entry := range byKey {
+		if entry.count < minForwardCopies {
+			continue
+		}
+		forwarded[key] = struct{}{}
+		list = append(list, ForwardedContent{
+			Text:        truncateRunes(strings.TrimSpace(entry.first.OriginalMessage), forwardPreviewRunes),
+			Copies:      entry.count,
+			Senders:     len(entry.senders),
+			FirstSent:   entry.first.Timestamp.Format("2006-01-02"),
+			FirstSender: entry.first.Sender,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Copies != list[j].Copies {
+			return list[i].Copies > list[j].Copies
+		}
+		return list[i].Text < list[j].Text
+	})
+	if len(list) > maxForwardedList {
+		list = list[:maxForwardedList]
+	}
+	return list, forwarded
+}
+
+// truncateRunes shortens text to at most n runes, marking the cut with "…".
+func truncateRunes(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
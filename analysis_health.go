@@ -0,0 +1,175 @@
+package main
+
+import (
+	"log"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	positiveWordsFile = "positive_words.json"
+	negativeWordsFile = "negative_words.json"
+
+	// healthReplyHalfScoreMinutes is the average reply time that scores 50 for
+	// responsiveness; instant replies score 100.
+	healthReplyHalfScoreMinutes = 30.0
+	// healthRecencyHalfLifeDays is how many days of silence halve the recency
+	// score.
+	healthRecencyHalfLifeDays = 30.0
+	healthTrendMonths         = 3
+)
+
+var (
+	positivePhrases []string
+	negativePhrases []string
+)
+
+func init() {
+	loadSentimentData()
+}
+
+func loadSentimentData() {
+	var err error
+	positivePhrases, err = loadLanguagePhrases(filepath.Join(dataDir, positiveWordsFile))
+	if err != nil {
+		log.Printf("Warning: Failed to load positive words: %v. Sentiment will read as neutral.", err)
+		positivePhrases = []string{}
+	}
+	negativePhrases, err = loadLanguagePhrases(filepath.Join(dataDir, negativeWordsFile))
+	if err != nil {
+		log.Printf("Warning: Failed to load negative words: %v. Sentiment will read as neutral.", err)
+		negativePhrases = []string{}
+	}
+}
+
+// HealthSubScores are each on a 0-100 scale, higher is healthier:
+//   - balance: how evenly messages are spread across members (normalized
+//     entropy of message counts; 100 means everyone sends the same amount)
+//   - responsiveness: average reply time, 100 for instant replies and 50 at
+//     30 minutes
+//   - recency: 100 if the last message is from today, halving every 30 days
+//     of silence
+//   - sentiment: share of positive vs negative messages, 50 is neutral
+type HealthSubScores struct {
+	Balance        int `json:"balance"`
+	Responsiveness int `json:"responsiveness"`
+	Recency        int `json:"recency"`
+	Sentiment      int `json:"sentiment"`
+}
+
+type HealthTrendPoint struct {
+	Month     string          `json:"month"`
+	Score     int             `json:"score"`
+	SubScores HealthSubScores `json:"sub_scores"`
+}
+
+// ChatHealth is meant to be drawn as a 0-100 gauge: Score is the unweighted
+// mean of the four sub-scores. Trend holds the same score for each of the last
+// three calendar months that have messages, oldest first, with recency
+// measured from the end of that month.
+type ChatHealth struct {
+	Score     int                `json:"score"`
+	SubScores HealthSubScores    `json:"sub_scores"`
+	Trend     []HealthTrendPoint `json:"trend"`
+}
+
+func calculateChatHealth(messagesData []ParsedMessage, convoBreak time.Duration, now time.Time) *ChatHealth {
+	if len(messagesData) == 0 {
+		return nil
+	}
+	users := make(map[string]struct{})
+	for _, msg := range messagesData {
+		users[msg.Sender] = struct{}{}
+	}
+	if len(users) < 2 {
+		return nil
+	}
+
+	subScores := healthSubScores(messagesData, convoBreak, now)
+	health := &ChatHealth{
+		Score:     subScores.overall(),
+		SubScores: subScores,
+		Trend:     []HealthTrendPoint{},
+	}
+
+	latest := messagesData[len(messagesData)-1].Timestamp
+	lastMonth := time.Date(latest.Year(), latest.Month(), 1, 0, 0, 0, 0, latest.Location())
+	for offset := healthTrendMonths - 1; offset >= 0; offset-- {
+		monthStart := lastMonth.AddDate(0, -offset, 0)
+		monthEnd := monthStart.AddDate(0, 1, 0)
+
+		var monthMessages []ParsedMessage
+		for _, msg := range messagesData {
+			if !msg.Timestamp.Before(monthStart) && msg.Timestamp.Before(monthEnd) {
+				monthMessages = append(monthMessages, msg)
+			}
+		}
+		if len(monthMessages) == 0 {
+			continue
+		}
+
+		reference := monthEnd
+		if now.Before(reference) {
+			reference = now
+		}
+		monthScores := healthSubScores(monthMessages, convoBreak, reference)
+		health.Trend = append(health.Trend, HealthTrendPoint{
+			Month:     monthStart.Format("2006-01"),
+			Score:     monthScores.overall(),
+			SubScores: monthScores,
+		})
+	}
+	return health
+}
+
+func healthSubScores(messagesData []ParsedMessage, convoBreak time.Duration, reference time.Time) HealthSubScores {
+	counts := make(map[string]int)
+	var replySeconds float64
+	replies := 0
+	positive, negative := 0, 0
+
+	for i, msg := range messagesData {
+		counts[msg.Sender]++
+		if i > 0 {
+			prev := messagesData[i-1]
+			diff := msg.Timestamp.Sub(prev.Timestamp)
+			if prev.Sender != msg.Sender && diff <= convoBreak && diff.Seconds() > 5 && diff.Seconds() < 12*3600 {
+				replySeconds += diff.Seconds()
+				replies++
+			}
+		}
+
+		lower := strings.ToLower(msg.OriginalMessage)
+		isPositive := containsAnyPhrase(lower, positivePhrases)
+		isNegative := containsAnyPhrase(lower, negativePhrases)
+		if isPositive && !isNegative {
+			positive++
+		} else if isNegative && !isPositive {
+			negative++
+		}
+	}
+
+	scores := HealthSubScores{Sentiment: 50}
+
+	scores.Balance = int(math.Round(messageBalance(counts, len(counts)) * 100))
+
+	if replies > 0 {
+		avgMinutes := replySeconds / float64(replies) / 60.0
+		scores.Responsiveness = int(math.Round(100 * healthReplyHalfScoreMinutes / (healthReplyHalfScoreMinutes + avgMinutes)))
+	}
+
+	silentDays := max(reference.Sub(messagesData[len(messagesData)-1].Timestamp).Hours()/24, 0)
+	scores.Recency = int(math.Round(100 * math.Pow(0.5, silentDays/healthRecencyHalfLifeDays)))
+
+	if positive+negative > 0 {
+		scores.Sentiment = int(math.Round(50 + 50*float64(positive-negative)/float64(positive+negative)))
+	}
+
+	return scores
+}
+
+func (s HealthSubScores) overall() int {
+	return int(math.Round(float64(s.Balance+s.Responsiveness+s.Recency+s.Sentiment) / 4))
+}
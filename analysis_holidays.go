@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	birthdayPhrasesFile = "birthday_phrases.json"
+	// A day is a spike when it has spikeMinRatio times the messages of the
+	// average active day, and at least spikeMinMessages of them.
+	spikeMinRatio    = 3.0
+	spikeMinMessages = 10
+	// A birthday burst needs this many wishes from at least two people.
+	birthdayMinWishes = 3
+	dateSpikesLimit   = 10
+)
+
+// Occasions a date spike can be put down to.
+const (
+	occasionNewYear    = "new_year"
+	occasionChristmas  = "christmas"
+	occasionValentines = "valentines"
+	occasionHalloween  = "halloween"
+	occasionBirthday   = "birthday"
+)
+
+// fixedDateOccasions are holidays on the same date every year, keyed MM-DD.
+var fixedDateOccasions = map[string]string{
+	"12-31": occasionNewYear,
+	"01-01": occasionNewYear,
+	"12-24": occasionChristmas,
+	"12-25": occasionChristmas,
+	"02-14": occasionValentines,
+	"10-31": occasionHalloween,
+}
+
+var birthdayPhrases []string
+
+func init() {
+	loadBirthdayData()
+}
+
+func loadBirthdayData() {
+	var err error
+	birthdayPhrases, err = loadLanguagePhrases(filepath.Join(dataDir, birthdayPhrasesFile))
+	if err != nil {
+		log.Printf("Warning: Failed to load birthday phrases: %v. Proceeding without birthday detection.", err)
+		birthdayPhrases = []string{}
+	}
+}
+
+// DateSpike is a day far busier than usual. Ratio compares it with the
+// average active day. Occasion names a fixed-date holiday, or "birthday"
+// when the day had a burst of birthday wishes; BirthdayOf is then the one
+// member who posted that day without sending a wish, when there is exactly
+// one.
+type DateSpike struct {
+	Date       string  `json:"date"`
+	Messages   int     `json:"messages"`
+	Ratio      float64 `json:"ratio"`
+	Occasion   string  `json:"occasion,omitempty"`
+	BirthdayOf string  `json:"birthday_of,omitempty"`
+}
+
+// calculateDateSpikes lists the busiest days relative to normal, and every
+// birthday burst even when it didn't make the day busy, largest ratio first.
+func calculateDateSpikes(messagesData []ParsedMessage) []DateSpike {
+	type dayCounts struct {
+		messages int
+		wishes   int
+		wishers  map[string]struct{}
+		senders  map[string]struct{}
+	}
+	days := make(map[string]*dayCounts)
+	for _, msg := range messagesData {
+		date := msg.Timestamp.Format("2006-01-02")
+		day, ok := days[date]
+		if !ok {
+			day = &dayCounts{wishers: make(map[string]struct{}), senders: make(map[string]struct{})}
+			days[date] = day
+		}
+		day.messages++
+		day.senders[msg.Sender] = struct{}{}
+		if containsAnyPhrase(strings.ToLower(msg.OriginalMessage), birthdayPhrases) {
+			day.wishes++
+			day.wishers[msg.Sender] = struct{}{}
+		}
+	}
+	if len(days) == 0 {
+		return nil
+	}
+	average := float64(len(messagesData)) / float64(len(days))
+
+	var spikes []DateSpike
+	for date, day := range days {
+		ratio := float64(day.messages) / average
+		spike := DateSpike{Date: date, Messages: day.messages, Ratio: roundFloat(ratio, 2)}
+		if day.wishes >= birthdayMinWishes && len(day.wishers) >= 2 {
+			spike.Occasion = occasionBirthday
+			var notWishing []string
+			for sender := range day.senders {
+				if _, wished := day.wishers[sender]; !wished {
+					notWishing = append(notWishing, sender)
+				}
+			}
+			if len(notWishing) == 1 {
+				spike.BirthdayOf = notWishing[0]
+			}
+		} else if ratio < spikeMinRatio || day.messages < spikeMinMessages {
+			continue
+		} else {
+			spike.Occasion = fixedDateOccasions[date[5:]]
+		}
+		spikes = append(spikes, spike)
+	}
+
+	sort.Slice(spikes, func(i, j int) bool {
+		if spikes[i].Ratio != spikes[j].Ratio {
+			return spikes[i].Ratio > spikes[j].Ratio
+		}
+		return spikes[i].Date < spikes[j].Date
+	})
+	if len(spikes) > dateSpikesLimit {
+		spikes = spikes[:dateSpikesLimit]
+	}
+	return spikes
+}
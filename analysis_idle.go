@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"bloop-go-server/pkg/parser"
+)
+
+// IdleMember is a group member who sends less than half the average share of
+// messages, the same cut-off as the lurker role. LastMessage and
+// DaysSinceLastMessage, counted back from the chat's last message, are left
+// out for members who never wrote at all.
+type IdleMember struct {
+	User                 string  `json:"user"`
+	Messages             int     `json:"messages"`
+	MessageSharePct      float64 `json:"message_share_pct"`
+	LastMessage          string  `json:"last_message,omitempty"`
+	DaysSinceLastMessage *int    `json:"days_since_last_message,omitempty"`
+}
+
+// IdleMembers lists the quiet members of a group chat, quietest first.
+// Members are everyone who wrote plus anyone the group events show being
+// added or joining and never writing, minus those who later left or were
+// removed. LurkerPct is the share of members who are idle.
+type IdleMembers struct {
+	Members         int          `json:"members"`
+	AverageSharePct float64      `json:"average_share_pct"`
+	LurkerPct       float64      `json:"lurker_pct"`
+	Idle            []IdleMember `json:"idle"`
+}
+
+// currentMembers follows the membership events in order and reports who was
+// still in the group at the end, and who is known to have gone.
+func currentMembers(events []parser.GroupEvent) (present, gone map[string]struct{}) {
+	present = make(map[string]struct{})
+	gone = make(map[string]struct{})
+	set := func(names []string, in bool) {
+		for _, name := range names {
+			if strings.EqualFold(name, "you") {
+				continue
+			}
+			if in {
+				present[name] = struct{}{}
+				delete(gone, name)
+			} else {
+				gone[name] = struct{}{}
+				delete(present, name)
+			}
+		}
+	}
+	for _, event := range events {
+		switch event.Type {
+		case parser.GroupEventAdded:
+			set(splitEventNames(event.Target), true)
+		case parser.GroupEventJoined:
+			set([]string{event.Actor}, true)
+		case parser.GroupEventRemoved:
+			set(splitEventNames(event.Target), false)
+		case parser.GroupEventLeft:
+			set([]string{event.Actor}, false)
+		}
+	}
+	return present, gone
+}
+
+// splitEventNames splits "Alice, Bob and Carol" from an added or removed
+// event into names.
+func splitEventNames(target string) []string {
+	var names []string
+	for _, part := range strings.Split(target, ", ") {
+		for _, name := range strings.Split(part, " and ") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// calculateIdleMembers returns nil for chats with fewer than three members.
+func calculateIdleMembers(messagesData []ParsedMessage, events []parser.GroupEvent) *IdleMembers {
+	if len(messagesData) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	lastSent := make(map[string]time.Time)
+	var chatEnd time.Time
+	for _, msg := range messagesData {
+		counts[msg.Sender]++
+		if msg.Timestamp.After(lastSent[msg.Sender]) {
+			lastSent[msg.Sender] = msg.Timestamp
+		}
+		if msg.Timestamp.After(chatEnd) {
+			chatEnd = msg.Timestamp
+		}
+	}
+	present, gone := currentMembers(events)
+
+	members := make([]string, 0, len(counts)+len(present))
+	for user := range counts {
+		if _, left := gone[user]; !left {
+			members = append(members, user)
+		}
+	}
+	for user := range present {
+		if _, wrote := counts[user]; !wrote {
+			members = append(members, user)
+		}
+	}
+	if len(members) < minUsersForRoles {
+		return nil
+	}
+	sort.Strings(members)
+
+	total := 0
+	for _, user := range members {
+		total += counts[user]
+	}
+	average := 100 / float64(len(members))
+	idle := &IdleMembers{Members: len(members), AverageSharePct: roundFloat(average, 2), Idle: []IdleMember{}}
+	for _, user := range members {
+		share := float64(counts[user]) * 100 / float64(total)
+		if share >= average/2 {
+			continue
+		}
+		member := IdleMember{User: user, Messages: counts[user], MessageSharePct: roundFloat(share, 2)}
+		if last, ok := lastSent[user]; ok {
+			days := int(chatEnd.Sub(last).Hours() / 24)
+			member.LastMessage = last.Format("2006-01-02")
+			member.DaysSinceLastMessage = &days
+		}
+		idle.Idle = append(idle.Idle, member)
+	}
+	sort.SliceStable(idle.Idle, func(i, j int) bool {
+		return idle.Idle[i].Messages < idle.Idle[j].Messages
+	})
+	idle.LurkerPct = roundFloat(float64(len(idle.Idle))*100/float64(len(members)), 2)
+	return idle
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"bloop-go-server/pkg/parser"
+)
+
+const minLettersForAllCaps = 3
+
+type IntensityStats struct {
+	AllCapsMessages        int     `json:"all_caps_messages"`
+	AllCapsPct             float64 `json:"all_caps_pct"`
+	ExclamationsPerMessage float64 `json:"exclamations_per_message"`
+	QuestionsPerMessage    float64 `json:"questions_per_message"`
+}
+
+// calculateIntensityStats inspects the original (not cleaned or lowered) text
+// for shouting: messages written entirely in capitals and the density of "!"
+// and "?" per message. The loudest member has the highest combined share of
+// all-caps messages and exclamations per message.
+func calculateIntensityStats(messagesData []ParsedMessage) (map[string]IntensityStats, *AverageChampion) {
+	type accumulator struct {
+		messages     int
+		allCaps      int
+		exclamations int
+		questions    int
+	}
+	accumulators := make(map[string]*accumulator)
+
+	for _, msg := range messagesData {
+		acc, ok := accumulators[msg.Sender]
+		if !ok {
+			acc = &accumulator{}
+			accumulators[msg.Sender] = acc
+		}
+		acc.messages++
+		if isAllCaps(parser.RemoveLinks(msg.OriginalMessage)) {
+			acc.allCaps++
+		}
+		acc.exclamations += strings.Count(msg.OriginalMessage, "!")
+		acc.questions += strings.Count(msg.OriginalMessage, "?")
+	}
+
+	users := make([]string, 0, len(accumulators))
+	for user := range accumulators {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	intensity := make(map[string]IntensityStats, len(accumulators))
+	var loudest *AverageChampion
+	for _, user := range users {
+		acc := accumulators[user]
+		stats := IntensityStats{
+			AllCapsMessages:        acc.allCaps,
+			AllCapsPct:             roundFloat(float64(acc.allCaps)*100.0/float64(acc.messages), 2),
+			ExclamationsPerMessage: roundFloat(float64(acc.exclamations)/float64(acc.messages), 3),
+			QuestionsPerMessage:    roundFloat(float64(acc.questions)/float64(acc.messages), 3),
+		}
+		intensity[user] = stats
+
+		score := roundFloat(stats.AllCapsPct/100.0+stats.ExclamationsPerMessage, 3)
+		if score > 0 && (loudest == nil || score > loudest.Value) {
+			loudest = &AverageChampion{User: user, Value: score}
+		}
+	}
+	return intensity, loudest
+}
+
+func isAllCaps(text string) bool {
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if !unicode.IsUpper(r) {
+			return false
+		}
+		letters++
+	}
+	return letters >= minLettersForAllCaps
+}
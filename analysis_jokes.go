@@ -0,0 +1,186 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	insideJokeMaxN     = 3
+	insideJokeMinUses  = 4
+	insideJokeMinUsers = 2
+	// insideJokeMaxShare keeps everyday words out: a phrase in more than this
+	// share of messages is part of the chat's vocabulary, not a joke.
+	insideJokeMaxShare = 0.02
+	insideJokeWindow   = 7 * 24 * time.Hour
+	// insideJokeMaxPValue is how likely the busiest week may be to happen by
+	// chance if the phrase were used at an even rate all along, after
+	// correcting for how many phrases were tested.
+	insideJokeMaxPValue = 0.05
+	insideJokeLimit     = 5
+)
+
+// InsideJoke is a phrase that is rare overall but caught on among several
+// members within a short window. PeakWeekStart is the first use in that
+// busiest week.
+type InsideJoke struct {
+	Phrase        string `json:"phrase"`
+	FirstUsed     string `json:"first_used"`
+	Originator    string `json:"originator"`
+	Uses          int    `json:"uses"`
+	Users         int    `json:"users"`
+	PeakWeekStart string `json:"peak_week_start"`
+	PeakWeekUses  int    `json:"peak_week_uses"`
+}
+
+type phraseUse struct {
+	timestamp time.Time
+	sender    string
+}
+
+// findInsideJokes looks for n-grams of one to three cleaned words that are
+// rare across the whole chat, spike within one week and are used by more than
+// one member. A spike counts when a week that busy would be unlikely if the
+// phrase were spread evenly over the chat (a Poisson scan over every week);
+// candidates are ranked by how unlikely, weighted by how many people picked
+// the phrase up.
+func findInsideJokes(messagesData []ParsedMessage) []InsideJoke {
+	if len(messagesData) == 0 {
+		return nil
+	}
+
+	// First pass: count the messages each phrase appears in, so occurrences
+	// are only kept for phrases rare enough to qualify.
+	messageCounts := make(map[string]int)
+	for _, msg := range messagesData {
+		for phrase := range messagePhrases(msg.CleanedMessage) {
+			messageCounts[phrase]++
+		}
+	}
+	maxUses := max(insideJokeMinUses, int(float64(len(messagesData))*insideJokeMaxShare))
+
+	uses := make(map[string][]phraseUse)
+	for _, msg := range messagesData {
+		for phrase := range messagePhrases(msg.CleanedMessage) {
+			if count := messageCounts[phrase]; count >= insideJokeMinUses && count <= maxUses {
+				uses[phrase] = append(uses[phrase], phraseUse{timestamp: msg.Timestamp, sender: msg.Sender})
+			}
+		}
+	}
+
+	span := messagesData[len(messagesData)-1].Timestamp.Sub(messagesData[0].Timestamp)
+	if span < insideJokeWindow {
+		span = insideJokeWindow
+	}
+	windows := float64(span) / float64(insideJokeWindow)
+
+	type candidate struct {
+		joke  InsideJoke
+		score float64
+	}
+	var candidates []candidate
+	for phrase, phraseUses := range uses {
+		senders := make(map[string]struct{})
+		for _, use := range phraseUses {
+			senders[use.sender] = struct{}{}
+		}
+		if len(senders) < insideJokeMinUsers {
+			continue
+		}
+
+		sort.SliceStable(phraseUses, func(i, j int) bool { return phraseUses[i].timestamp.Before(phraseUses[j].timestamp) })
+		peakStart, peakUses := 0, 0
+		end := 0
+		for start := range phraseUses {
+			for end < len(phraseUses) && phraseUses[end].timestamp.Sub(phraseUses[start].timestamp) < insideJokeWindow {
+				end++
+			}
+			if end-start > peakUses {
+				peakStart, peakUses = start, end-start
+			}
+		}
+
+		expected := float64(len(phraseUses)) / windows
+		pValue := math.Min(1, poissonTail(peakUses, expected)*windows*float64(len(uses)))
+		if pValue > insideJokeMaxPValue {
+			continue
+		}
+
+		candidates = append(candidates, candidate{
+			joke: InsideJoke{
+				Phrase:        phrase,
+				FirstUsed:     phraseUses[0].timestamp.Format("2006-01-02"),
+				Originator:    phraseUses[0].sender,
+				Uses:          len(phraseUses),
+				Users:         len(senders),
+				PeakWeekStart: phraseUses[peakStart].timestamp.Format("2006-01-02"),
+				PeakWeekUses:  peakUses,
+			},
+			score: -math.Log(math.Max(pValue, math.SmallestNonzeroFloat64)) * float64(len(senders)),
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		// On a tie the longer phrase is the joke and the shorter its fragment.
+		if li, lj := len(strings.Fields(candidates[i].joke.Phrase)), len(strings.Fields(candidates[j].joke.Phrase)); li != lj {
+			return li > lj
+		}
+		return candidates[i].joke.Phrase < candidates[j].joke.Phrase
+	})
+
+	// A joke's sub-phrases and longer variants burst together; keep only the
+	// best-scoring one of each family.
+	jokes := []InsideJoke{}
+	for _, c := range candidates {
+		overlaps := false
+		for _, picked := range jokes {
+			if containsPhrase(picked.Phrase, c.joke.Phrase) || containsPhrase(c.joke.Phrase, picked.Phrase) {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+		jokes = append(jokes, c.joke)
+		if len(jokes) == insideJokeLimit {
+			break
+		}
+	}
+	if len(jokes) == 0 {
+		return nil
+	}
+	return jokes
+}
+
+// poissonTail is P(X >= k) for X ~ Poisson(lambda).
+func poissonTail(k int, lambda float64) float64 {
+	term := math.Exp(-lambda)
+	below := 0.0
+	for i := 0; i < k; i++ {
+		below += term
+		term *= lambda / float64(i+1)
+	}
+	return math.Max(0, 1-below)
+}
+
+// messagePhrases returns the distinct one- to three-word phrases of a
+// cleaned message, made of words isTopicTerm accepts.
+func messagePhrases(cleaned string) map[string]struct{} {
+	tokens := strings.Fields(cleaned)
+	phrases := make(map[string]struct{})
+	for i := range tokens {
+		for n := 1; n <= insideJokeMaxN && i+n <= len(tokens); n++ {
+			if !isTopicTerm(tokens[i+n-1]) {
+				break
+			}
+			phrases[strings.Join(tokens[i:i+n], " ")] = struct{}{}
+		}
+	}
+	return phrases
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+const (
+	maxKeywords      = 10
+	maxKeywordLength = 50
+)
+
+var (
+	errTooManyKeywords = fmt.Errorf("at most %d keywords can be tracked", maxKeywords)
+	errKeywordTooLong  = fmt.Errorf("keywords must be at most %d characters", maxKeywordLength)
+)
+
+// KeywordTrend is how often a chosen keyword came up each month: Series has
+// one Nivo line per member counting their messages that mention it.
+type KeywordTrend struct {
+	Keyword string                  `json:"keyword"`
+	Total   int                     `json:"total"`
+	Series  []UserActivityChartData `json:"series"`
+}
+
+// parseKeywords reads the comma-separated keywords field. Keywords are
+// matched case-insensitively, so duplicates differing only in case are
+// dropped.
+func parseKeywords(raw string) ([]string, error) {
+	var keywords []string
+	seen := make(map[string]struct{})
+	for _, keyword := range strings.Split(raw, ",") {
+		keyword = strings.ToLower(strings.Join(strings.Fields(keyword), " "))
+		if keyword == "" {
+			continue
+		}
+		if len(keyword) > maxKeywordLength {
+			return nil, errKeywordTooLong
+		}
+		if _, ok := seen[keyword]; ok {
+			continue
+		}
+		seen[keyword] = struct{}{}
+		keywords = append(keywords, keyword)
+	}
+	if len(keywords) > maxKeywords {
+		return nil, errTooManyKeywords
+	}
+	return keywords, nil
+}
+
+// calculateKeywordTrends counts, per keyword, member and month, the messages
+// that mention the keyword as a whole word or phrase. Every series covers
+// every month of the chat so keywords chart on the same axis.
+func calculateKeywordTrends(messagesData []ParsedMessage, keywords []string) []KeywordTrend {
+	if len(keywords) == 0 || len(messagesData) == 0 {
+		return nil
+	}
+
+	patterns := make([]*regexp.Regexp, len(keywords))
+	for i, keyword := range keywords {
+		words := strings.Fields(keyword)
+		for j, word := range words {
+			words[j] = regexp.QuoteMeta(word)
+		}
+		patterns[i] = regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}])` + strings.Join(words, `[\s\p{Zs}]+`) + `(?:[^\p{L}\p{N}]|$)`)
+	}
+
+	counts := make([]UserStringIntMap, len(keywords))
+	totals := make([]int, len(keywords))
+	for i := range counts {
+		counts[i] = make(UserStringIntMap)
+	}
+	allMonths := make(map[string]struct{})
+	users := make(map[string]struct{})
+	for _, msg := range messagesData {
+		month := msg.Timestamp.Format("2006-01")
+		allMonths[month] = struct{}{}
+		users[msg.Sender] = struct{}{}
+		for i, pattern := range patterns {
+			if !pattern.MatchString(msg.OriginalMessage) {
+				continue
+			}
+			if _, ok := counts[i][msg.Sender]; !ok {
+				counts[i][msg.Sender] = make(map[string]int)
+			}
+			counts[i][msg.Sender][month]++
+			totals[i]++
+		}
+	}
+
+	userList := maps.Keys(users)
+	sort.Strings(userList)
+	trends := make([]KeywordTrend, len(keywords))
+	for i, keyword := range keywords {
+		trends[i] = KeywordTrend{
+			Keyword: keyword,
+			Total:   totals[i],
+			Series:  getMonthlyActivity(counts[i], allMonths, userList),
+		}
+	}
+	return trends
+}
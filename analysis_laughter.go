@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"bloop-go-server/pkg/parser"
+)
+
+const laughterTokensFile = "laughter_tokens.json"
+
+var (
+	laughterWords   []string
+	laughterSymbols []string
+)
+
+func init() {
+	loadLaughterData()
+}
+
+func loadLaughterData() {
+	tokens, err := loadLanguagePhrases(filepath.Join(dataDir, laughterTokensFile))
+	if err != nil {
+		log.Printf("Warning: Failed to load laughter tokens: %v. Proceeding without laughter detection.", err)
+		tokens = []string{}
+	}
+	var words, symbols []string
+	for _, token := range tokens {
+		if strings.IndexFunc(token, unicode.IsLetter) >= 0 || strings.IndexFunc(token, unicode.IsDigit) >= 0 {
+			words = append(words, token)
+		} else {
+			symbols = append(symbols, token)
+		}
+	}
+	laughterWords, laughterSymbols = words, symbols
+}
+
+// laugh is one message with laughter in it. After is who wrote the text
+// message just before it, Gap later, when that was someone else.
+type laugh struct {
+	Sender string
+	After  string
+	Gap    time.Duration
+}
+
+type LaughterStats struct {
+	LaughMessages  int     `json:"laugh_messages"`
+	LaughPct       float64 `json:"laugh_pct"`
+	LaughsReceived int     `json:"laughs_received"`
+}
+
+// calculateLaughterStats counts messages containing laughter per user, out
+// of everything they sent, and credits a laugh to the author of the previous
+// message when someone else laughs right after it within the conversation
+// break.
+func calculateLaughterStats(markers parser.Markers, convoBreak time.Duration) (map[string]LaughterStats, *ChampionInfo, *ChampionInfo) {
+	messageCounts := markers.Sent
+	laughs := make(map[string]int)
+	received := make(map[string]int)
+
+	for _, l := range markers.Laughs {
+		laughs[l.Sender]++
+		if l.After != "" && l.Gap <= convoBreak {
+			received[l.After]++
+		}
+	}
+
+	users := make([]string, 0, len(messageCounts))
+	for user := range messageCounts {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	laughter := make(map[string]LaughterStats, len(users))
+	var biggestLaugher, funniest *ChampionInfo
+	for _, user := range users {
+		laughter[user] = LaughterStats{
+			LaughMessages:  laughs[user],
+			LaughPct:       roundFloat(float64(laughs[user])*100.0/float64(messageCounts[user]), 2),
+			LaughsReceived: received[user],
+		}
+		if laughs[user] > 0 && (biggestLaugher == nil || laughs[user] > biggestLaugher.Count) {
+			biggestLaugher = &ChampionInfo{User: user, Count: laughs[user]}
+		}
+		if received[user] > 0 && (funniest == nil || received[user] > funniest.Count) {
+			funniest = &ChampionInfo{User: user, Count: received[user]}
+		}
+	}
+
+	if len(users) < 2 {
+		return laughter, nil, nil
+	}
+	return laughter, biggestLaugher, funniest
+}
+
+func isLaughter(text string) bool {
+	for _, symbol := range laughterSymbols {
+		if strings.Contains(text, symbol) {
+			return true
+		}
+	}
+	for _, word := range strings.Fields(strings.ToLower(parser.RemoveLinks(text))) {
+		word = parser.NormalizeWord(removeEmojis(word))
+		for _, token := range laughterWords {
+			if isLaughterVariant(word, token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isLaughterVariant matches a word against a laughter token, accepting the
+// token repeated or cut off mid-repeat ("hahah", "lolol", "kkkkk") and a
+// stretched final letter ("lmaooo").
+func isLaughterVariant(word, token string) bool {
+	if word == token {
+		return true
+	}
+	if !strings.HasPrefix(word, token) {
+		return false
+	}
+
+	wordRunes := []rune(word)
+	unit := []rune(token)[:smallestPeriod([]rune(token))]
+	last := wordRunes[len(wordRunes)-1]
+	for i, r := range wordRunes {
+		if r != unit[i%len(unit)] {
+			for _, rest := range wordRunes[i:] {
+				if rest != last || wordRunes[i-1] != last {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return true
+}
+
+func smallestPeriod(runes []rune) int {
+	for period := 1; period < len(runes); period++ {
+		repeats := true
+		for i := period; i < len(runes); i++ {
+			if runes[i] != runes[i-period] {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			return period
+		}
+	}
+	return len(runes)
+}
@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// UserLifetime describes when someone was around. DaysActive is the inclusive
+// span from their first to their last message, like the chat-wide
+// days_active; DaysWithMessages counts only the calendar days they actually
+// wrote something. DaysSinceLastMessage is measured from the chat's last
+// message, not from today, so old exports still show who went quiet first.
+type UserLifetime struct {
+	FirstMessage         string `json:"first_message"`
+	LastMessage          string `json:"last_message"`
+	DaysActive           int    `json:"days_active"`
+	DaysWithMessages     int    `json:"days_with_messages"`
+	DaysSinceLastMessage int    `json:"days_since_last_message"`
+}
+
+func calculateUserLifetimes(messagesData []ParsedMessage) map[string]UserLifetime {
+	lifetimes := make(map[string]UserLifetime)
+	if len(messagesData) == 0 {
+		return lifetimes
+	}
+
+	first := make(map[string]time.Time)
+	last := make(map[string]time.Time)
+	days := make(map[string]map[string]struct{})
+	for _, msg := range messagesData {
+		if _, ok := first[msg.Sender]; !ok {
+			first[msg.Sender] = msg.Timestamp
+			days[msg.Sender] = make(map[string]struct{})
+		}
+		last[msg.Sender] = msg.Timestamp
+		days[msg.Sender][msg.Timestamp.Format("2006-01-02")] = struct{}{}
+	}
+
+	chatEnd := messagesData[len(messagesData)-1].Timestamp
+	for user, firstSeen := range first {
+		lastSeen := last[user]
+		lifetimes[user] = UserLifetime{
+			FirstMessage:         firstSeen.Format("2006-01-02 15:04"),
+			LastMessage:          lastSeen.Format("2006-01-02 15:04"),
+			DaysActive:           int(lastSeen.Sub(firstSeen).Hours()/24) + 1,
+			DaysWithMessages:     len(days[user]),
+			DaysSinceLastMessage: int(chatEnd.Sub(lastSeen).Hours() / 24),
+		}
+	}
+	return lifetimes
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	longestMessagesLimit = 5
+	// longestPreviewRunes caps the text shown for each long message.
+	longestPreviewRunes = 120
+)
+
+// LongMessage is one message on the longest messages leaderboard. Text is
+// the start of the message, cut to 120 characters.
+type LongMessage struct {
+	User      string `json:"user"`
+	Timestamp string `json:"timestamp"`
+	Words     int    `json:"words"`
+	Text      string `json:"text"`
+}
+
+// LongestMessages ranks messages by word count: Top is the five longest in
+// the chat and Users each member's own five longest, longest first.
+type LongestMessages struct {
+	Top   []LongMessage            `json:"top"`
+	Users map[string][]LongMessage `json:"users"`
+}
+
+func calculateLongestMessages(messagesData []ParsedMessage) *LongestMessages {
+	type candidate struct {
+		index int
+		words int
+	}
+	var all []candidate
+	byUser := make(map[string][]candidate)
+	for i, msg := range messagesData {
+		words := len(strings.Fields(msg.OriginalMessage))
+		if words == 0 {
+			continue
+		}
+		all = append(all, candidate{index: i, words: words})
+		byUser[msg.Sender] = append(byUser[msg.Sender], candidate{index: i, words: words})
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	// Ties go to the earlier message.
+	leaders := func(candidates []candidate) []LongMessage {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].words > candidates[j].words
+		})
+		if len(candidates) > longestMessagesLimit {
+			candidates = candidates[:longestMessagesLimit]
+		}
+		list := make([]LongMessage, 0, len(candidates))
+		for _, c := range candidates {
+			msg := messagesData[c.index]
+			list = append(list, LongMessage{
+				User:      msg.Sender,
+				Timestamp: msg.Timestamp.Format("2006-01-02 15:04"),
+				Words:     c.words,
+				Text:      truncateRunes(strings.TrimSpace(msg.OriginalMessage), longestPreviewRunes),
+			})
+		}
+		return list
+	}
+
+	longest := &LongestMessages{Top: leaders(all), Users: make(map[string][]LongMessage, len(byUser))}
+	for user, candidates := range byUser {
+		longest.Users[user] = leaders(candidates)
+	}
+	return longest
+}
@@ -8,63 +8,207 @@ import (
 	"io"
 	"log"
 	"runtime"
+	"runtime/debug"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"bloop-go-server/pkg/parser"
 	"golang.org/x/exp/maps"
 )
 
 type aiResultTuple struct {
-	result string
-	err    error
+	result   string
+	warnings warningList
+	err      error
 }
 
+// aiTaskKind selects what an AI worker does with a task.
+type aiTaskKind int
+
+const (
+	aiTaskAnalysis aiTaskKind = iota
+	aiTaskDigest
+)
+
 type aiTask struct {
+	kind         aiTaskKind
 	ctx          context.Context
 	messagesData []ParsedMessage
 	gapHours     float64
+	chatName     string
+	tone         string
+	model        string
+	notes        bool
+	labelRoles   bool
+	digestFacts  string
 	resultChan   chan aiResultTuple
 	logPrefix    string
 }
 
+// AnalysisOptions carries the per-request choices made by the client.
+type AnalysisOptions struct {
+	Tone string
+	// AIModel runs the AI analysis and digest on this model instead of
+	// GROQ_MODEL; handlers only accept models from AI_ALLOWED_MODELS.
+	AIModel string
+	// AIRoles asks the AI to label group roles alongside the deterministic ones.
+	AIRoles bool
+	// Denylist holds extra words or phrases to keep out of word stats and AI input.
+	Denylist []string
+	// KeepNames turns off the automatic filtering of participant names.
+	KeepNames bool
+	// Digest is "weekly" or "monthly" to add an admin digest; DigestAI also
+	// asks the AI for a recap paragraph.
+	Digest   string
+	DigestAI bool
+	// MinParsePct turns on strict mode: when set, AnalyzeChat fails with a
+	// *ParseRatioError if a smaller share of message lines parses.
+	MinParsePct int
+	// ConvoBreakMinutes replaces the dynamic conversation break for stats and
+	// AI grouping when set; zero keeps the dynamic one.
+	ConvoBreakMinutes int
+	// ContactNames replaces senders shown as phone numbers with names, and
+	// merges senders listed as aliases of one another.
+	ContactNames contactNames
+	// NoAI skips the AI analysis and digest paragraph, for offline runs.
+	NoAI bool
+	// DeferAI leaves the AI analysis and digest paragraph unqueued, on the
+	// result for runDeferredAI, so ai_async can answer with the stats first.
+	DeferAI bool
+	// Keywords are tracked month by month in stats.keyword_trends.
+	Keywords []string
+	// ExcludeBots leaves detected bots out of the stats and AI input; they
+	// are reported in the result's bots section either way.
+	ExcludeBots bool
+	// TopWords and TopEmojis size stats.common_words and stats.common_emojis;
+	// zero keeps the defaults.
+	TopWords  int
+	TopEmojis int
+	// CollapseForwards counts forwarded content once in the word and emoji
+	// stats, so chain messages don't dominate them.
+	CollapseForwards bool
+	// ChangeDate is where stats.chat_changes splits the chat; zero splits it
+	// at its midpoint.
+	ChangeDate time.Time
+	// Profanity adds per-member swear word counts to the stats.
+	Profanity bool
+}
+
+// Bounds for a client-supplied conversation break. The dynamic break stays
+// within 30–300 minutes; clients get a little more room either way.
+const (
+	minConvoBreakOverride = 5
+	maxConvoBreakOverride = 24 * 60
+)
+
+const (
+	analysisModeChat  = "chat"
+	analysisModeNotes = "notes"
+)
+
 type AnalysisResult struct {
-	ChatName      string          `json:"chat_name"`
-	TotalMessages int             `json:"total_messages"`
-	Stats         *ChatStatistics `json:"stats"`
-	AIAnalysis    json.RawMessage `json:"ai_analysis"`
-	Error         string          `json:"error,omitempty"`
+	ID            string `json:"analysis_id,omitempty"`
+	ChatName      string `json:"chat_name"`
+	Mode          string `json:"mode,omitempty"`
+	Preset        string `json:"preset,omitempty"`
+	TotalMessages int    `json:"total_messages"`
+	// ConvoBreakMinutes is the conversation break the analysis actually used.
+	ConvoBreakMinutes int                    `json:"convo_break_minutes,omitempty"`
+	ConvoBreak        *ConvoBreakDiagnostics `json:"convo_break,omitempty"`
+	Stats             *ChatStatistics        `json:"stats"`
+	AIAnalysis        json.RawMessage        `json:"ai_analysis"`
+	// AIModel is the model that wrote AIAnalysis.
+	AIModel     string              `json:"ai_model,omitempty"`
+	GroupEvents []parser.GroupEvent `json:"group_events,omitempty"`
+	Digest      *AdminDigest        `json:"digest,omitempty"`
+	Diagnostics *ParseDiagnostics   `json:"diagnostics,omitempty"`
+	Merge       *MergeReport        `json:"merge,omitempty"`
+	Bots        []DetectedBot       `json:"bots,omitempty"`
+	// Warnings lists what made the result less exact, e.g. truncated lines or
+	// a guessed date order. It is always present, empty when nothing did.
+	Warnings []Warning `json:"warnings"`
+	Error    string    `json:"error,omitempty"`
+	// ErrorCode names the cause of Error for clients: ERR_NO_MESSAGES,
+	// ERR_STATS_FAILED, ERR_AI_FAILED or ERR_AI_TIMEOUT, or for a detached
+	// analysis that failed outright, the code its request would have got.
+	ErrorCode string `json:"error_code,omitempty"`
+	// AIStatus is "pending" in an ai_async response, whose AI analysis is
+	// still running; the full result will be at AIResultURL.
+	AIStatus    string `json:"ai_status,omitempty"`
+	AIResultURL string `json:"ai_result_url,omitempty"`
+
+	// deferredAI is the AI work left for later by DeferAI, nil when there is
+	// none.
+	deferredAI *pendingAI
 }
 
-func AnalyzeChat(ctx context.Context, chatReader io.Reader, originalFilename string, aiQueue chan<- aiTask, aiQueueTimeout time.Duration) (*AnalysisResult, error) {
+func AnalyzeChat(ctx context.Context, chatReader io.Reader, originalFilename string, aiQueue chan<- aiTask, aiQueueTimeout time.Duration, maxLineBytes int, opts AnalysisOptions) (*AnalysisResult, error) {
 	logPrefix := fmt.Sprintf("[%s]", originalFilename)
 	// log.Printf("%s Starting analysis using reader", logPrefix)
 	// Added to store raw message count
 	var messagesData []ParsedMessage
 	var statsResult *ChatStatistics
-	var statsErr, aiErr error
+	var statsErr error
+	var preprocessed *preprocessResult
 	var preprocessErr error
 	var rawMessageCount int
 	var userCount int
 	var uniqueUsers []string
 
-	rawMessageCount, messagesData, preprocessErr = preprocessMessages(chatReader) // Modified to get rawMessageCount
+	// Bot detection reads the auto-reply phrases, which a reload replaces, so
+	// it runs under the same read lock as preprocessing.
+	var bots []DetectedBot
+	dataMu.RLock()
+	preprocessed, preprocessErr = preprocessMessages(chatReader, maxLineBytes)
+	if preprocessErr == nil {
+		applyContactNames(preprocessed, opts.ContactNames)
+		bots = detectBots(preprocessed.messages)
+	}
+	dataMu.RUnlock()
 	if preprocessErr != nil {
 		log.Printf("%s Preprocessing failed: %v", logPrefix, preprocessErr)
 		return nil, fmt.Errorf("preprocessing failed: %w", preprocessErr)
 	}
+	preprocessed.diagnostics.AliasSuggestions = suggestAliases(preprocessed.messages)
+	if opts.ExcludeBots && len(bots) > 0 {
+		excluded := make(map[string]struct{}, len(bots))
+		for i := range bots {
+			bots[i].Excluded = true
+			excluded[bots[i].Sender] = struct{}{}
+		}
+		excludeSenders(preprocessed, excluded)
+		log.Printf("%s Excluded %d detected bot(s) from the analysis.", logPrefix, len(bots))
+	}
+	rawMessageCount, messagesData = preprocessed.rawMessageCount, preprocessed.messages
+
+	if opts.MinParsePct > 0 && preprocessed.diagnostics.ParseRatioPct < float64(opts.MinParsePct) {
+		log.Printf("%s Strict mode: parse ratio %.2f%% is below %d%%.", logPrefix, preprocessed.diagnostics.ParseRatioPct, opts.MinParsePct)
+		return nil, &ParseRatioError{Diagnostics: preprocessed.diagnostics, MinPct: opts.MinParsePct}
+	}
 
 	if rawMessageCount == 0 {
 		log.Printf("%s No messages found after preprocessing.", logPrefix)
 		return &AnalysisResult{
 			ChatName:      deriveChatName(originalFilename, []string{}),
 			TotalMessages: 0,
+			Diagnostics:   &preprocessed.diagnostics,
+			Bots:          bots,
+			Warnings:      append([]Warning{}, preprocessed.warnings...),
 			Error:         "No messages found in the file after preprocessing.",
+			ErrorCode:     errCodeNoMessages,
 		}, nil
 	}
 
+	// Everyone who wrote anything takes part, even when none of their
+	// messages survived preprocessing; a chat is notes-to-self only when a
+	// single person wrote in it.
 	usersSet := make(map[string]struct{})
+	for sender := range preprocessed.markers.Sent {
+		usersSet[sender] = struct{}{}
+	}
 	for _, msg := range messagesData {
 		usersSet[msg.Sender] = struct{}{}
 	}
@@ -72,124 +216,319 @@ func AnalyzeChat(ctx context.Context, chatReader io.Reader, originalFilename str
 	sort.Strings(uniqueUsers)
 	userCount = len(uniqueUsers)
 	chatName := deriveChatName(originalFilename, uniqueUsers)
-	dynamicConvoBreakMinutes := calculateDynamicConvoBreak(messagesData, 120, 30, 300)
+	nameFilter := uniqueUsers
+	if opts.KeepNames {
+		nameFilter = nil
+	}
+	applyPrivacyFilter(messagesData, buildPrivacyTerms(nameFilter, opts.Denylist))
+	convoBreakMinutes, convoBreak := calculateDynamicConvoBreak(messagesData, 120, 30, 300)
+	warnings := preprocessed.warnings
+	if !opts.NoAI && atomic.LoadInt32(&aiPaused) != 0 {
+		opts.NoAI = true
+		warnings.add(warnAIPaused, 1, "AI analysis is switched off on this server for now, so this result has statistics only.")
+	}
+	if opts.ConvoBreakMinutes != 0 {
+		convoBreakMinutes = opts.ConvoBreakMinutes
+		convoBreak.Source = convoBreakSourceRequest
+		convoBreak.Minutes = convoBreakMinutes
+	} else if convoBreak.Source == convoBreakSourceDefault {
+		warnings.add(warnConvoBreakDefault, 1, fmt.Sprintf("Too few replies to measure how long this chat's pauses run, so conversations are split after a default %d minutes.", convoBreakMinutes))
+	}
 
 	var wg sync.WaitGroup
-	var aiResultChan chan aiResultTuple
 
 	wg.Add(1)
 	go func(data []ParsedMessage, breakMinutes int) {
 		defer wg.Done()
-		statsResult, statsErr = calculateChatStatistics(data, breakMinutes)
+		defer recoverAsError(&statsErr, "Statistics", logPrefix)
+		dataMu.RLock()
+		defer dataMu.RUnlock()
+		statsResult, statsErr = calculateChatStatistics(data, preprocessed.markers, breakMinutes, statsOptions{topWords: opts.TopWords, topEmojis: opts.TopEmojis, collapseForwards: opts.CollapseForwards, changeDate: opts.ChangeDate, profanity: opts.Profanity, groupEvents: preprocessed.groupEvents})
 		if statsErr != nil {
 			log.Printf("%s Statistics goroutine finished with error: %v", logPrefix, statsErr)
 		}
 		data = nil
-	}(messagesData, dynamicConvoBreakMinutes)
+	}(messagesData, convoBreakMinutes)
 
-	shouldRunAI := userCount > 1 && userCount <= maxUsersForPeopleBlock
+	// A single participant is a notes-to-self chat; the AI writes a digest of
+	// what was saved instead of a people analysis.
+	ai := &pendingAI{model: opts.AIModel}
+	shouldRunAI := !opts.NoAI && userCount >= 1 && userCount <= maxUsersForPeopleBlock
 	if shouldRunAI {
-		// log.Printf("%s Preparing AI analysis task.", logPrefix)
-		aiResultChan = make(chan aiResultTuple, 1)
-		task := aiTask{
-			ctx:          ctx,
+		ai.analysis = &aiJob{task: aiTask{
 			messagesData: messagesData,
-			gapHours:     float64(dynamicConvoBreakMinutes) / 60.0,
-			resultChan:   aiResultChan,
+			gapHours:     float64(convoBreakMinutes) / 60.0,
+			chatName:     chatName,
+			tone:         opts.Tone,
+			model:        opts.AIModel,
+			notes:        userCount == 1,
+			labelRoles:   opts.AIRoles,
 			logPrefix:    logPrefix,
-		}
-
-		sendTimer := time.NewTimer(aiQueueTimeout)
-		select {
-		case aiQueue <- task:
-			// log.Printf("%s AI task successfully queued.", logPrefix)
+		}}
+	} else if opts.NoAI {
+		log.Printf("%s Skipping AI analysis: AI is turned off for this run.", logPrefix)
+	} else {
+		log.Printf("%s Skipping AI analysis: User count (%d) is not between 1 and %d.", logPrefix, userCount, maxUsersForPeopleBlock)
+	}
 
-		case <-ctx.Done():
-			log.Printf("%s Context cancelled before AI task could be queued: %v", logPrefix, ctx.Err())
-			aiErr = ctx.Err()
-			if !sendTimer.Stop() {
-				<-sendTimer.C
-			}
-		case <-sendTimer.C:
-			log.Printf("%s Timed out (%s) waiting to queue AI task.", logPrefix, aiQueueTimeout)
-			return nil, ErrAIQueueTimeout
-		}
-		if !sendTimer.Stop() {
-			select {
-			case <-sendTimer.C:
-			default:
-			}
+	var digest *AdminDigest
+	if opts.Digest != "" {
+		var window []ParsedMessage
+		digest, window = calculateAdminDigest(messagesData, preprocessed.groupEvents, opts.Digest, time.Duration(convoBreakMinutes)*time.Minute)
+		if opts.DigestAI && !opts.NoAI && len(window) > 0 {
+			ai.digest = &aiJob{task: aiTask{
+				kind:         aiTaskDigest,
+				messagesData: window,
+				gapHours:     float64(convoBreakMinutes) / 60.0,
+				chatName:     chatName,
+				digestFacts:  digest.Text,
+				model:        opts.AIModel,
+				logPrefix:    logPrefix + " [digest]",
+			}}
 		}
+	}
 
-	} else {
-		log.Printf("%s Skipping AI analysis: User count (%d) is not between 2 and %d.", logPrefix, userCount, maxUsersForPeopleBlock)
+	if opts.DeferAI {
+		if len(ai.jobs()) == 0 {
+			ai = nil
+		}
+	} else if err := ai.enqueue(ctx, aiQueue, aiQueueTimeout); err != nil {
+		return nil, err
 	}
 
+	keywordTrends := calculateKeywordTrends(messagesData, opts.Keywords)
+
 	messagesData = nil
 	runtime.GC()
 
 	wg.Wait()
 
-	var aiFinalResult string
-	if aiResultChan != nil && aiErr == nil {
-		// log.Printf("%s Waiting for AI result...", logPrefix)
-		select {
-		case resultTuple, ok := <-aiResultChan:
-			if !ok {
-				log.Printf("%s AI result channel closed unexpectedly.", logPrefix)
-				aiErr = errors.New("AI worker closed channel unexpectedly")
-			} else {
-				aiFinalResult = resultTuple.result
-				aiErr = resultTuple.err
-				if aiErr != nil {
-					log.Printf("%s AI analysis returned an error: %v", logPrefix, aiErr)
-				} else {
-					// log.Printf("%s Successfully received AI result.", logPrefix)
-				}
-			}
-		case <-ctx.Done():
-			log.Printf("%s Context cancelled while waiting for AI result: %v", logPrefix, ctx.Err())
-			aiErr = ctx.Err()
-		}
+	if !opts.DeferAI {
+		ai.wait(ctx)
 	}
 
 	finalResult := &AnalysisResult{
-		ChatName:      chatName,
-		TotalMessages: rawMessageCount,
-		Stats:         statsResult,
+		ChatName:          chatName,
+		Mode:              analysisModeChat,
+		TotalMessages:     rawMessageCount,
+		ConvoBreakMinutes: convoBreakMinutes,
+		ConvoBreak:        convoBreak,
+		Stats:             statsResult,
+		GroupEvents:       preprocessed.groupEvents,
+		Digest:            digest,
+		Diagnostics:       &preprocessed.diagnostics,
+		Bots:              bots,
+		Warnings:          append([]Warning{}, warnings...),
+	}
+	if userCount == 1 {
+		finalResult.Mode = analysisModeNotes
 	}
 
 	if finalResult.Stats != nil {
 		finalResult.Stats.TotalMessages = rawMessageCount
+		finalResult.Stats.KeywordTrends = keywordTrends
 	} else if rawMessageCount > 0 && len(messagesData) == 0 {
 		finalResult.Stats = &ChatStatistics{
 			TotalMessages: rawMessageCount,
 		}
 	}
 
-	if aiFinalResult != "" && aiErr == nil {
-		finalResult.AIAnalysis = json.RawMessage(aiFinalResult)
+	// The first failure decides the error code.
+	if statsErr != nil {
+		finalResult.Error = fmt.Sprintf("Statistics failed: %s", statsErr.Error())
+		finalResult.Stats = nil
+		finalResult.ErrorCode = errCodeStatsFailed
+	}
+	if opts.DeferAI {
+		finalResult.deferredAI = ai
 	} else {
-		finalResult.AIAnalysis = nil
+		ai.apply(finalResult)
+	}
+
+	if finalResult.Error != "" {
+		log.Printf("%s Analysis complete with errors: %s", logPrefix, finalResult.Error)
+	}
+	return finalResult, nil
+}
+
+var errAIQueueClosed = errors.New("the AI task queue is closed")
+
+// recoverAsError turns a panic in the deferring goroutine into *errp, so a
+// chat that trips a bug fails its own analysis instead of the whole server.
+// It must be deferred directly.
+func recoverAsError(errp *error, what, logPrefix string) {
+	if r := recover(); r != nil {
+		log.Printf("%s %s panicked: %v\n%s", logPrefix, what, r, debug.Stack())
+		*errp = fmt.Errorf("internal error: %v", r)
+	}
+}
+
+// enqueueAITask hands a task to the AI workers, waiting at most timeout for a
+// free slot. It returns ErrAIQueueTimeout when the queue stays full,
+// errAIQueueClosed once shutdown has closed it, or the context error if the
+// request ends first.
+func enqueueAITask(ctx context.Context, aiQueue chan<- aiTask, task aiTask, timeout time.Duration) error {
+	aiQueueMu.RLock()
+	defer aiQueueMu.RUnlock()
+	if aiWorkersClosed {
+		return errAIQueueClosed
+	}
+
+	sendTimer := time.NewTimer(timeout)
+	defer sendTimer.Stop()
+	atomic.AddInt32(&aiQueueWaiting, 1)
+	defer atomic.AddInt32(&aiQueueWaiting, -1)
+
+	select {
+	case aiQueue <- task:
+		return nil
+	case <-ctx.Done():
+		log.Printf("%s Context cancelled before AI task could be queued: %v", task.logPrefix, ctx.Err())
+		return ctx.Err()
+	case <-sendTimer.C:
+		log.Printf("%s Timed out (%s) waiting to queue AI task.", task.logPrefix, timeout)
+		return ErrAIQueueTimeout
+	}
+}
+
+// pendingAI is the AI work of one analysis: the people analysis, the digest
+// paragraph, or both, each nil when it doesn't run.
+type pendingAI struct {
+	analysis *aiJob
+	digest   *aiJob
+	model    string
+}
+
+// aiJob is one AI task and, once it has run, its outcome.
+type aiJob struct {
+	task    aiTask
+	outcome aiResultTuple
+}
+
+func (p *pendingAI) jobs() []*aiJob {
+	var jobs []*aiJob
+	for _, job := range []*aiJob{p.analysis, p.digest} {
+		if job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// enqueue hands every job to the AI workers under ctx; a job that could not
+// be queued keeps the failure as its outcome. When the queue stays full it
+// stops there and returns ErrAIQueueTimeout.
+func (p *pendingAI) enqueue(ctx context.Context, aiQueue chan<- aiTask, timeout time.Duration) error {
+	for _, job := range p.jobs() {
+		job.task.ctx = ctx
+		job.task.resultChan = make(chan aiResultTuple, 1)
+		if err := enqueueAITask(ctx, aiQueue, job.task, timeout); err != nil {
+			job.task.resultChan = nil
+			job.outcome.err = err
+			if errors.Is(err, ErrAIQueueTimeout) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// wait collects the outcome of every queued job.
+func (p *pendingAI) wait(ctx context.Context) {
+	for _, job := range p.jobs() {
+		if job.task.resultChan == nil {
+			continue
+		}
+		select {
+		case outcome, ok := <-job.task.resultChan:
+			if !ok {
+				outcome.err = errors.New("AI worker closed channel unexpectedly")
+			}
+			job.outcome = outcome
+			if job.outcome.err != nil {
+				log.Printf("%s AI task returned an error: %v", job.task.logPrefix, job.outcome.err)
+			}
+		case <-ctx.Done():
+			log.Printf("%s Context cancelled while waiting for AI result: %v", job.task.logPrefix, ctx.Err())
+			job.outcome.err = ctx.Err()
+		}
 	}
+}
 
+// apply adds the outcomes to result: the analysis and the model that wrote
+// it, the digest paragraph, their warnings, and their failures after any
+// already on result, which keeps deciding the error code.
+func (p *pendingAI) apply(result *AnalysisResult) {
+	warnings := append(warningList{}, result.Warnings...)
 	var errorMessages []string
-	if statsErr != nil {
-		errorMessages = append(errorMessages, fmt.Sprintf("Statistics failed: %s", statsErr.Error()))
-		finalResult.Stats = nil
+	if result.Error != "" {
+		errorMessages = append(errorMessages, result.Error)
+	}
+	fail := func(what string, err error) {
+		if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return
+		}
+		errorMessages = append(errorMessages, fmt.Sprintf("%s failed: %s", what, err.Error()))
+		if result.ErrorCode == "" {
+			result.ErrorCode = aiErrorCode(err)
+		}
 	}
 
-	if aiErr != nil && !errors.Is(aiErr, context.Canceled) && !errors.Is(aiErr, context.DeadlineExceeded) {
-		errorMessages = append(errorMessages, fmt.Sprintf("AI analysis failed: %s", aiErr.Error()))
+	if job := p.analysis; job != nil {
+		warnings.merge(job.outcome.warnings)
+		if job.outcome.err == nil && job.outcome.result != "" {
+			result.AIAnalysis = json.RawMessage(job.outcome.result)
+			result.AIModel = p.model
+			if result.AIModel == "" {
+				result.AIModel = currentAISettings().model
+			}
+		}
+		fail("AI analysis", job.outcome.err)
+	}
+	if job := p.digest; job != nil && result.Digest != nil {
+		if job.outcome.err == nil {
+			result.Digest.AIParagraph = job.outcome.result
+		}
+		fail("AI digest", job.outcome.err)
 	}
 
-	if len(errorMessages) > 0 {
-		finalResult.Error = strings.Join(errorMessages, "; ")
-		log.Printf("%s Analysis complete with errors: %s", logPrefix, finalResult.Error)
-	} //else {
-	// log.Printf("%s Analysis complete successfully.", logPrefix)
-	//	}
-	return finalResult, nil
+	result.Warnings = append([]Warning{}, warnings...)
+	result.Error = strings.Join(errorMessages, "; ")
+}
+
+// currentAIQueueTimeout is how long a server analysis waits for an AI worker.
+func currentAIQueueTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&aiQueueTimeoutNanos))
+}
+
+// recordAITaskDuration folds a finished task into the moving average that
+// queue wait estimates are based on.
+func recordAITaskDuration(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&aiTaskAvgNanos)
+		next := int64(d)
+		if old > 0 {
+			next = old + (int64(d)-old)/5
+		}
+		if atomic.CompareAndSwapInt64(&aiTaskAvgNanos, old, next) {
+			return
+		}
+	}
+}
+
+// aiQueueEstimate reports where a request arriving now would stand in line
+// for an AI worker, 1 being next, and roughly how long it would wait. The
+// wait is zero until a task has finished and there is an average to go by.
+func aiQueueEstimate() (position int, wait time.Duration) {
+	position = len(aiTaskQueue) + int(atomic.LoadInt32(&aiQueueWaiting)) + 1
+	workers := currentAIWorkers()
+	average := time.Duration(atomic.LoadInt64(&aiTaskAvgNanos))
+	if workers == 0 || average == 0 {
+		return position, 0
+	}
+	// Each round of tasks ahead takes about one average task on every worker.
+	rounds := (position + workers - 1) / workers
+	return position, time.Duration(rounds) * average
 }
 
 func deriveChatName(originalFilename string, users []string) string {
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sort"
+
+	"bloop-go-server/pkg/parser"
+)
+
+// MediaMonth is how many attachments of each kind were shared in a month.
+type MediaMonth struct {
+	Month string         `json:"month"`
+	Kinds map[string]int `json:"kinds"`
+}
+
+// MediaAttachmentStats is only present for exports made with media, where
+// every attachment is named; the files themselves are never read.
+type MediaAttachmentStats struct {
+	Total   int                       `json:"total"`
+	ByKind  map[string]int            `json:"by_kind"`
+	Monthly []MediaMonth              `json:"monthly"`
+	Users   map[string]map[string]int `json:"users"`
+}
+
+func calculateMediaAttachmentStats(attachments []parser.Attachment) *MediaAttachmentStats {
+	if len(attachments) == 0 {
+		return nil
+	}
+	stats := &MediaAttachmentStats{
+		Total:  len(attachments),
+		ByKind: make(map[string]int),
+		Users:  make(map[string]map[string]int),
+	}
+	months := make(map[string]map[string]int)
+	for _, a := range attachments {
+		stats.ByKind[a.Kind]++
+		if _, ok := stats.Users[a.Sender]; !ok {
+			stats.Users[a.Sender] = make(map[string]int)
+		}
+		stats.Users[a.Sender][a.Kind]++
+		if _, ok := months[a.Month]; !ok {
+			months[a.Month] = make(map[string]int)
+		}
+		months[a.Month][a.Kind]++
+	}
+
+	keys := make([]string, 0, len(months))
+	for month := range months {
+		keys = append(keys, month)
+	}
+	sort.Strings(keys)
+	stats.Monthly = make([]MediaMonth, 0, len(keys))
+	for _, month := range keys {
+		stats.Monthly = append(stats.Monthly, MediaMonth{Month: month, Kinds: months[month]})
+	}
+	return stats
+}
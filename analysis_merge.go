@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"bloop-go-server/pkg/parser"
+)
+
+const (
+	// maxMergeExports caps how many exports one request may merge.
+	maxMergeExports = 10
+	// mergedTimestampLayout is how merged exports are written back out. It is
+	// one of the registered layouts and reads the same whatever locale the
+	// individual exports came from.
+	mergedTimestampLayout = "2006/01/02 15:04:05"
+)
+
+// MergeReport describes how several exports of one chat were combined.
+type MergeReport struct {
+	Files              int `json:"files"`
+	Messages           int `json:"messages"`
+	DuplicatesDropped  int `json:"duplicates_dropped"`
+	UnreadableMessages int `json:"unreadable_messages"`
+}
+
+// exportEntry is one message or system line with its continuation lines.
+type exportEntry struct {
+	timestamp time.Time
+	key       string
+	text      string
+}
+
+// mergeExports combines overlapping exports of the same chat into a single
+// export ordered by time. Entries are matched on timestamp, sender and
+// message; one that appears n times in any single export is kept n times,
+// so repeated messages within a minute survive while the overlap between
+// exports is dropped. Each export is read with its own layouts, so an export
+// from a phone set to another locale merges too.
+func mergeExports(exports [][]byte, maxLineBytes int) ([]byte, *MergeReport, error) {
+	report := &MergeReport{Files: len(exports)}
+	var entries []exportEntry
+	kept := make(map[string]int)
+
+	for i, export := range exports {
+		detection, err := parser.DetectLayouts(export, maxLineBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("export %d: %w", i+1, err)
+		}
+		fileEntries, unreadable := splitExportEntries(export, detection.Layouts, maxLineBytes)
+		report.UnreadableMessages += unreadable
+
+		occurrences := make(map[string]int)
+		for _, entry := range fileEntries {
+			occurrences[entry.key]++
+			if occurrences[entry.key] > kept[entry.key] {
+				kept[entry.key]++
+				entries = append(entries, entry)
+			} else {
+				report.DuplicatesDropped++
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].timestamp.Before(entries[j].timestamp)
+	})
+	var merged bytes.Buffer
+	for _, entry := range entries {
+		merged.WriteString(entry.text)
+		merged.WriteByte('\n')
+	}
+	report.Messages = len(entries)
+	return merged.Bytes(), report, nil
+}
+
+// splitExportEntries cuts an export into entries rewritten with
+// mergedTimestampLayout. Lines that start like an entry but whose timestamp
+// doesn't parse count as unreadable and stay attached to the entry before
+// them, as the parser would treat them; lines before the first entry have
+// nothing to attach to and are dropped.
+func splitExportEntries(export []byte, layouts []string, maxLineBytes int) ([]exportEntry, int) {
+	var entries []exportEntry
+	unreadable := 0
+
+	scanner := parser.NewLineReader(bytes.NewReader(export), maxLineBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if date, clock, rest, ok := parser.SplitHeader(line); ok {
+			if timestamp, ok := parser.ParseTimestamp(date, clock, layouts); ok {
+				stamp := timestamp.Format(mergedTimestampLayout)
+				entries = append(entries, exportEntry{
+					timestamp: timestamp,
+					key:       stamp + "\n" + rest,
+					text:      stamp + " - " + rest,
+				})
+				continue
+			}
+			unreadable++
+		} else if len(entries) == 0 {
+			unreadable++
+		}
+
+		if len(entries) > 0 {
+			last := &entries[len(entries)-1]
+			last.key += "\n" + line
+			last.text += "\n" + line
+		}
+	}
+	return entries, unreadable
+}
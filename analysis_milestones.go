@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	milestoneBirthday     = "birthday"
+	milestoneAnniversary  = "anniversary"
+	milestoneMessageCount = "message_count"
+	milestoneBusiestDay   = "busiest_day"
+)
+
+var milestoneMessageCounts = []int{1000, 10000, 50000}
+
+// Milestone is a single shareable moment in the chat's history. Count is the
+// anniversary year for anniversaries, the message number crossed for
+// message_count and the number of messages sent that day for busiest_day.
+type Milestone struct {
+	Type  string `json:"type"`
+	Date  string `json:"date"`
+	Count int    `json:"count,omitempty"`
+}
+
+// calculateMilestones returns the chat's birthday (the day of its first
+// message), every anniversary reached by the last message, the days it
+// crossed 1k, 10k and 50k messages, and its busiest day, in date order.
+func calculateMilestones(messagesData []ParsedMessage) []Milestone {
+	if len(messagesData) == 0 {
+		return nil
+	}
+
+	first := messagesData[0].Timestamp
+	last := messagesData[len(messagesData)-1].Timestamp
+	milestones := []Milestone{{Type: milestoneBirthday, Date: first.Format("2006-01-02")}}
+
+	for year := 1; ; year++ {
+		anniversary := time.Date(first.Year()+year, first.Month(), first.Day(), 0, 0, 0, 0, first.Location())
+		if anniversary.After(last) {
+			break
+		}
+		milestones = append(milestones, Milestone{Type: milestoneAnniversary, Date: anniversary.Format("2006-01-02"), Count: year})
+	}
+
+	for _, count := range milestoneMessageCounts {
+		if count > len(messagesData) {
+			break
+		}
+		milestones = append(milestones, Milestone{
+			Type:  milestoneMessageCount,
+			Date:  messagesData[count-1].Timestamp.Format("2006-01-02"),
+			Count: count,
+		})
+	}
+
+	// Ties go to the earliest day.
+	dailyCounts := make(map[string]int)
+	busiest := Milestone{Type: milestoneBusiestDay}
+	for _, msg := range messagesData {
+		day := msg.Timestamp.Format("2006-01-02")
+		dailyCounts[day]++
+		if dailyCounts[day] > busiest.Count {
+			busiest.Date = day
+			busiest.Count = dailyCounts[day]
+		}
+	}
+	milestones = append(milestones, busiest)
+
+	sort.SliceStable(milestones, func(i, j int) bool {
+		return milestones[i].Date < milestones[j].Date
+	})
+	return milestones
+}
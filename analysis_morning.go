@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// firstReplyMinDays keeps members who answered the day's first text only
+// once or twice out of the fastest responder ranking.
+const firstReplyMinDays = 3
+
+// FirstTextReply is who answered a day's first message first, and how many
+// minutes it took.
+type FirstTextReply struct {
+	Date        string  `json:"date"`
+	FirstSender string  `json:"first_sender"`
+	Responder   string  `json:"responder"`
+	Minutes     float64 `json:"minutes"`
+}
+
+// FirstReplierStats counts the days a member was first to answer the day's
+// first text and their median time to do it.
+type FirstReplierStats struct {
+	Days          int     `json:"days"`
+	MedianMinutes float64 `json:"median_minutes"`
+}
+
+// FirstTextResponses covers the replies to each day's first message. A reply
+// is the first message that day from someone else, sent before the
+// conversation break; Unanswered counts days with none. FastestResponder has
+// the lowest median among members who answered on at least three days.
+type FirstTextResponses struct {
+	Days             []FirstTextReply             `json:"days"`
+	Users            map[string]FirstReplierStats `json:"users"`
+	FastestResponder *AverageChampion             `json:"fastest_responder,omitempty"`
+	Unanswered       int                          `json:"unanswered"`
+}
+
+func calculateFirstTextResponses(messagesData []ParsedMessage, convoBreak time.Duration) *FirstTextResponses {
+	responses := &FirstTextResponses{Days: []FirstTextReply{}, Users: make(map[string]FirstReplierStats)}
+	minutesByUser := make(map[string][]float64)
+
+	for i := 0; i < len(messagesData); {
+		first := messagesData[i]
+		day := first.Timestamp.Format("2006-01-02")
+		answered, replied := false, false
+		j := i + 1
+		for ; j < len(messagesData) && messagesData[j].Timestamp.Format("2006-01-02") == day; j++ {
+			msg := messagesData[j]
+			if answered || msg.Sender == first.Sender {
+				continue
+			}
+			// Only the first person to write back counts, in time or not.
+			answered = true
+			wait := msg.Timestamp.Sub(first.Timestamp)
+			if wait < 0 || wait > convoBreak {
+				continue
+			}
+			replied = true
+			minutes := roundFloat(wait.Minutes(), 2)
+			responses.Days = append(responses.Days, FirstTextReply{
+				Date:        day,
+				FirstSender: first.Sender,
+				Responder:   msg.Sender,
+				Minutes:     minutes,
+			})
+			minutesByUser[msg.Sender] = append(minutesByUser[msg.Sender], minutes)
+		}
+		if !replied {
+			responses.Unanswered++
+		}
+		i = j
+	}
+
+	if len(responses.Days) == 0 {
+		return nil
+	}
+	for user, minutes := range minutesByUser {
+		sort.Float64s(minutes)
+		median := roundFloat(Percentile(minutes, 50), 2)
+		responses.Users[user] = FirstReplierStats{Days: len(minutes), MedianMinutes: median}
+		if len(minutes) < firstReplyMinDays {
+			continue
+		}
+		fastest := responses.FastestResponder
+		if fastest == nil || median < fastest.Value || (median == fastest.Value && user < fastest.User) {
+			responses.FastestResponder = &AverageChampion{User: user, Value: median}
+		}
+	}
+	return responses
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"bloop-go-server/pkg/parser"
+)
+
+const (
+	reminderPhrasesFile   = "reminder_phrases.json"
+	notesKeywordsPerMonth = 5
+	notesMaxMonths        = 24
+	notesMaxReminders     = 50
+	notesMaxLinkDomains   = 15
+)
+
+// notesModeOmittedStats are conversation-dynamics stats that have no meaning
+// when the only participant is talking to themselves.
+var notesModeOmittedStats = []string{
+	"conversation_starters_pct",
+	"conversation_starters_monthly",
+	"conversation_enders_pct",
+	"conversation_killers_pct",
+	"conversation_spark",
+	"most_ignored_users_pct",
+	"first_text_champion",
+	"first_text_responses",
+	"longest_monologue",
+	"average_response_time_minutes",
+	"response_time_percentiles",
+	"user_response_matrix",
+	"texting_similarity",
+	"inside_jokes",
+	"essay_writer",
+	"shortest_texter",
+	"loudest_member",
+	"biggest_laugher",
+	"most_laughed_at",
+	"biggest_deleter",
+	"chat_health",
+	"chat_energy",
+	"chat_changes",
+	"politeness",
+	"first_reply_times",
+}
+
+var reminderPhrases []string
+
+func init() {
+	loadReminderData()
+}
+
+func loadReminderData() {
+	var err error
+	reminderPhrases, err = loadLanguagePhrases(filepath.Join(dataDir, reminderPhrasesFile))
+	if err != nil {
+		log.Printf("Warning: Failed to load reminder phrases: %v. Proceeding without reminder detection.", err)
+		reminderPhrases = []string{}
+	}
+}
+
+type MonthlyKeywords struct {
+	Month        string   `json:"month"`
+	MessageCount int      `json:"message_count"`
+	Keywords     []string `json:"keywords"`
+}
+
+type NoteReminder struct {
+	Timestamp string `json:"timestamp"`
+	Text      string `json:"text"`
+}
+
+type NotesSummary struct {
+	KeywordTrends []MonthlyKeywords `json:"keyword_trends"`
+	SavedLinks    StringIntMap      `json:"saved_links"`
+	Reminders     []NoteReminder    `json:"reminders"`
+}
+
+// calculateNotesSummary builds the notes-to-self view of a single-participant
+// chat: what the user wrote about month by month (TF-IDF with each month as a
+// document), which sites they save links from, and notes that read like
+// reminders, most recent first.
+func calculateNotesSummary(messagesData []ParsedMessage) *NotesSummary {
+	summary := &NotesSummary{
+		KeywordTrends: calculateMonthlyKeywords(messagesData),
+		SavedLinks:    countTopN(countLinkDomains(messagesData), notesMaxLinkDomains),
+		Reminders:     []NoteReminder{},
+	}
+
+	for i := len(messagesData) - 1; i >= 0 && len(summary.Reminders) < notesMaxReminders; i-- {
+		msg := messagesData[i]
+		if isReminder(msg.OriginalMessage) {
+			summary.Reminders = append(summary.Reminders, NoteReminder{
+				Timestamp: msg.Timestamp.Format("2006-01-02 15:04"),
+				Text:      msg.OriginalMessage,
+			})
+		}
+	}
+	return summary
+}
+
+func calculateMonthlyKeywords(messagesData []ParsedMessage) []MonthlyKeywords {
+	termCounts := make(map[string]map[string]int)
+	messageCounts := make(map[string]int)
+	for _, msg := range messagesData {
+		month := msg.Timestamp.Format("2006-01")
+		messageCounts[month]++
+		counts, ok := termCounts[month]
+		if !ok {
+			counts = make(map[string]int)
+			termCounts[month] = counts
+		}
+		for _, term := range strings.Fields(msg.CleanedMessage) {
+			if isTopicTerm(term) {
+				counts[term]++
+			}
+		}
+	}
+
+	docFrequency := make(map[string]int)
+	for _, counts := range termCounts {
+		for term := range counts {
+			docFrequency[term]++
+		}
+	}
+
+	months := make([]string, 0, len(termCounts))
+	for month := range termCounts {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+	if len(months) > notesMaxMonths {
+		months = months[len(months)-notesMaxMonths:]
+	}
+
+	docCount := float64(len(termCounts))
+	trends := make([]MonthlyKeywords, 0, len(months))
+	for _, month := range months {
+		counts := termCounts[month]
+		total := 0
+		for _, c := range counts {
+			total += c
+		}
+		scores := make(map[string]float64, len(counts))
+		for term, c := range counts {
+			idf := math.Log((1+docCount)/(1+float64(docFrequency[term]))) + 1
+			scores[term] = float64(c) / float64(total) * idf
+		}
+		trends = append(trends, MonthlyKeywords{
+			Month:        month,
+			MessageCount: messageCounts[month],
+			Keywords:     topScoredTerms(scores, notesKeywordsPerMonth),
+		})
+	}
+	return trends
+}
+
+func countLinkDomains(messagesData []ParsedMessage) map[string]int {
+	domains := make(map[string]int)
+	for _, msg := range messagesData {
+		for _, link := range parser.FindLinks(msg.OriginalMessage) {
+			if domain := linkDomain(link); domain != "" {
+				domains[domain]++
+			}
+		}
+	}
+	return domains
+}
+
+func linkDomain(link string) string {
+	link = strings.TrimRight(link, ".,;:!?)]}'\"")
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// describeSavedLinks lists the most saved domains for the notes digest prompt.
+func describeSavedLinks(messagesData []ParsedMessage) string {
+	top := countTopN(countLinkDomains(messagesData), notesMaxLinkDomains)
+	domains := make([]string, 0, len(top))
+	for domain := range top {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if top[domains[i]] != top[domains[j]] {
+			return top[domains[i]] > top[domains[j]]
+		}
+		return domains[i] < domains[j]
+	})
+
+	lines := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		lines = append(lines, fmt.Sprintf("- %s (%d links)", domain, top[domain]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isReminder(text string) bool {
+	return containsAnyPhrase(strings.ToLower(text), reminderPhrases)
+}
+
+func containsAnyPhrase(text string, phrases []string) bool {
+	for _, phrase := range phrases {
+		if containsPhrase(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPhrase reports whether phrase occurs in text as whole words, so
+// "must" does not match "mustard".
+func containsPhrase(text, phrase string) bool {
+	for offset := 0; offset < len(text); {
+		idx := strings.Index(text[offset:], phrase)
+		if idx < 0 {
+			return false
+		}
+		start := offset + idx
+		end := start + len(phrase)
+
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		offset = start + size
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	thanksPhrasesFile = "thanks_phrases.json"
+	pleasePhrasesFile = "please_phrases.json"
+	// politenessMinMessages keeps members with a handful of messages out of
+	// the most polite and most apologetic picks.
+	politenessMinMessages = 20
+)
+
+var (
+	thanksPhrases []string
+	pleasePhrases []string
+)
+
+func init() {
+	loadPolitenessData()
+}
+
+func loadPolitenessData() {
+	for _, list := range []struct {
+		file    string
+		target  *[]string
+		purpose string
+	}{
+		{thanksPhrasesFile, &thanksPhrases, "thanks phrases"},
+		{pleasePhrasesFile, &pleasePhrases, "please phrases"},
+	} {
+		phrases, err := loadLanguagePhrases(filepath.Join(dataDir, list.file))
+		if err != nil {
+			log.Printf("Warning: Failed to load %s: %v. Proceeding without them for politeness stats.", list.purpose, err)
+			phrases = []string{}
+		}
+		*list.target = phrases
+	}
+}
+
+// UserPoliteness counts a member's messages that thank someone, say please
+// or apologise. PolitePct is the share of their messages with a thanks or a
+// please, SorryPct the share with an apology.
+type UserPoliteness struct {
+	Thanks    int     `json:"thanks"`
+	Please    int     `json:"please"`
+	Sorry     int     `json:"sorry"`
+	PolitePct float64 `json:"polite_pct"`
+	SorryPct  float64 `json:"sorry_pct"`
+}
+
+// PolitenessStats picks the most polite and most apologetic members by
+// PolitePct and SorryPct, among members with at least twenty messages.
+// Apologies use the same word list as the mediator role.
+type PolitenessStats struct {
+	Users          map[string]UserPoliteness `json:"users"`
+	MostPolite     *AverageChampion          `json:"most_polite,omitempty"`
+	MostApologetic *AverageChampion          `json:"most_apologetic,omitempty"`
+}
+
+func calculatePolitenessStats(messagesData []ParsedMessage) *PolitenessStats {
+	messageCounts := make(map[string]int)
+	thanks := make(map[string]int)
+	please := make(map[string]int)
+	sorry := make(map[string]int)
+	polite := make(map[string]int)
+	found := false
+	for _, msg := range messagesData {
+		messageCounts[msg.Sender]++
+		lower := strings.ToLower(msg.OriginalMessage)
+		thanked := containsAnyPhrase(lower, thanksPhrases)
+		asked := containsAnyPhrase(lower, pleasePhrases)
+		if thanked {
+			thanks[msg.Sender]++
+		}
+		if asked {
+			please[msg.Sender]++
+		}
+		if thanked || asked {
+			polite[msg.Sender]++
+			found = true
+		}
+		if containsAnyPhrase(lower, apologyPhrases) {
+			sorry[msg.Sender]++
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	stats := &PolitenessStats{Users: make(map[string]UserPoliteness, len(messageCounts))}
+	for user, messages := range messageCounts {
+		politePct := roundFloat(float64(polite[user])*100/float64(messages), 2)
+		sorryPct := roundFloat(float64(sorry[user])*100/float64(messages), 2)
+		stats.Users[user] = UserPoliteness{
+			Thanks:    thanks[user],
+			Please:    please[user],
+			Sorry:     sorry[user],
+			PolitePct: politePct,
+			SorryPct:  sorryPct,
+		}
+		if messages < politenessMinMessages {
+			continue
+		}
+		stats.MostPolite = higherAverage(stats.MostPolite, user, politePct)
+		stats.MostApologetic = higherAverage(stats.MostApologetic, user, sorryPct)
+	}
+	return stats
+}
+
+// higherAverage returns whichever of current and user has the higher value,
+// preferring the alphabetically first name on a tie. A zero value never wins.
+func higherAverage(current *AverageChampion, user string, value float64) *AverageChampion {
+	if value <= 0 {
+		return current
+	}
+	if current == nil || value > current.Value || (value == current.Value && user < current.User) {
+		return &AverageChampion{User: user, Value: value}
+	}
+	return current
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"bloop-go-server/pkg/parser"
+)
+
+const (
+	maxDenylistEntries     = 200
+	maxDenylistEntryLength = 64
+	// minNamePrefixRunes keeps very short prefixes like "al" from swallowing
+	// ordinary words; "alex" for "alexander" or "chris" for "christina" are
+	// still caught.
+	minNamePrefixRunes = 3
+)
+
+var (
+	errDenylistTooLong      = fmt.Errorf("denylist has more than %d entries", maxDenylistEntries)
+	errDenylistEntryTooLong = fmt.Errorf("denylist entries must be at most %d characters", maxDenylistEntryLength)
+)
+
+// privacyTerms is a set of single words and multi-word phrases (as token
+// slices) to drop from cleaned message text.
+type privacyTerms struct {
+	words   map[string]struct{}
+	phrases [][]string
+}
+
+// buildPrivacyTerms includes every word of every participant's name and its
+// prefixes, so names and short forms of them never surface in word stats or
+// get sent to the AI as message content, plus any words or phrases the client
+// asked to deny. Pass nil participants to keep names in.
+func buildPrivacyTerms(participants []string, denylist []string) privacyTerms {
+	terms := privacyTerms{words: make(map[string]struct{})}
+	for _, participant := range participants {
+		for _, word := range strings.Fields(participant) {
+			normalized := []rune(parser.NormalizeWord(word))
+			for n := min(minNamePrefixRunes, len(normalized)); n <= len(normalized); n++ {
+				if n > 0 {
+					terms.words[string(normalized[:n])] = struct{}{}
+				}
+			}
+		}
+	}
+	for _, entry := range denylist {
+		var tokens []string
+		for _, word := range strings.Fields(entry) {
+			if normalized := parser.NormalizeWord(word); normalized != "" {
+				tokens = append(tokens, normalized)
+			}
+		}
+		switch len(tokens) {
+		case 0:
+		case 1:
+			terms.words[tokens[0]] = struct{}{}
+		default:
+			terms.phrases = append(terms.phrases, tokens)
+		}
+	}
+	return terms
+}
+
+// applyPrivacyFilter removes private terms from each message's cleaned text in
+// place. The cleaned text feeds word counts, topics and the AI input; the
+// original text is left alone for stats that only look at its shape.
+func applyPrivacyFilter(messagesData []ParsedMessage, terms privacyTerms) {
+	if len(terms.words) == 0 && len(terms.phrases) == 0 {
+		return
+	}
+	for i := range messagesData {
+		tokens := strings.Fields(messagesData[i].CleanedMessage)
+		kept := tokens[:0]
+		for j := 0; j < len(tokens); j++ {
+			if n := terms.phraseAt(tokens, j); n > 0 {
+				j += n - 1
+				continue
+			}
+			if _, private := terms.words[tokens[j]]; private {
+				continue
+			}
+			kept = append(kept, tokens[j])
+		}
+		messagesData[i].CleanedMessage = strings.Join(kept, " ")
+	}
+}
+
+// phraseAt returns the length of a denied phrase starting at tokens[start], or 0.
+func (t privacyTerms) phraseAt(tokens []string, start int) int {
+	for _, phrase := range t.phrases {
+		if start+len(phrase) > len(tokens) {
+			continue
+		}
+		matched := true
+		for k, word := range phrase {
+			if tokens[start+k] != word {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return len(phrase)
+		}
+	}
+	return 0
+}
+
+// parseDenylist splits the comma-separated denylist form value.
+func parseDenylist(raw string) ([]string, error) {
+	var entries []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if len(entry) > maxDenylistEntryLength {
+			return nil, errDenylistEntryTooLong
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) > maxDenylistEntries {
+		return nil, errDenylistTooLong
+	}
+	return entries, nil
+}
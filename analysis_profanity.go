@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// profanityDir holds one word list per language, data/profanity/<lang>.txt,
+// with one word per line. Blank lines and lines starting with # are skipped.
+const profanityDir = "profanity"
+
+var profanityWords map[string]struct{}
+
+func init() {
+	loadProfanityData()
+}
+
+func loadProfanityData() {
+	words, err := loadProfanityWords(filepath.Join(dataDir, profanityDir))
+	if err != nil {
+		log.Printf("Warning: Failed to load profanity word lists: %v. Profanity stats will be empty.", err)
+		words = make(map[string]struct{})
+	}
+	profanityWords = words
+}
+
+func loadProfanityWords(dir string) (map[string]struct{}, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list profanity lists in '%s': %w", dir, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no word lists found in '%s'", dir)
+	}
+	sort.Strings(paths)
+
+	words := make(map[string]struct{})
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not open profanity list '%s': %w", path, err)
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+			if word != "" && !strings.HasPrefix(word, "#") {
+				words[word] = struct{}{}
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading profanity list '%s': %w", path, err)
+		}
+	}
+	log.Printf("Loaded %d profanity words in %d languages from %s", len(words), len(paths), dir)
+	return words, nil
+}
+
+// UserProfanity is how much one member swears: every listed word they used,
+// and the share of their messages with at least one.
+type UserProfanity struct {
+	Words       int     `json:"words"`
+	MessagesPct float64 `json:"messages_pct"`
+}
+
+// ProfanityStats is only worked out when the client asks for it with
+// profanity=true. MostUnhinged has the highest share of messages with a
+// swear word in them.
+type ProfanityStats struct {
+	TotalWords   int                      `json:"total_words"`
+	Users        map[string]UserProfanity `json:"users"`
+	MostUnhinged *AverageChampion         `json:"most_unhinged,omitempty"`
+}
+
+// calculateProfanityStats matches whole words against the loaded lists, so
+// "class" doesn't count for "ass". It returns nil when nobody swore.
+func calculateProfanityStats(messagesData []ParsedMessage) *ProfanityStats {
+	if len(profanityWords) == 0 {
+		return nil
+	}
+	messageCounts := make(map[string]int)
+	swearMessages := make(map[string]int)
+	swearWords := make(map[string]int)
+	total := 0
+	for _, msg := range messagesData {
+		messageCounts[msg.Sender]++
+		found := 0
+		for _, word := range strings.FieldsFunc(strings.ToLower(msg.OriginalMessage), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+		}) {
+			if _, ok := profanityWords[strings.Trim(word, "'")]; ok {
+				found++
+			}
+		}
+		if found > 0 {
+			swearMessages[msg.Sender]++
+			swearWords[msg.Sender] += found
+			total += found
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	stats := &ProfanityStats{TotalWords: total, Users: make(map[string]UserProfanity, len(messageCounts))}
+	for user, messages := range messageCounts {
+		pct := roundFloat(float64(swearMessages[user])*100/float64(messages), 2)
+		stats.Users[user] = UserProfanity{Words: swearWords[user], MessagesPct: pct}
+		if pct == 0 {
+			continue
+		}
+		champion := stats.MostUnhinged
+		if champion == nil || pct > champion.Value || (pct == champion.Value && user < champion.User) {
+			stats.MostUnhinged = &AverageChampion{User: user, Value: pct}
+		}
+	}
+	return stats
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	planningPhrasesFile = "planning_phrases.json"
+	hypePhrasesFile     = "hype_phrases.json"
+	apologyWordsFile    = "apology_words.json"
+	minUsersForRoles    = 3
+
+	rolePlanner    = "planner"
+	roleComedian   = "comedian"
+	roleLurker     = "lurker"
+	roleHypePerson = "hype-person"
+	roleMediator   = "mediator"
+)
+
+// memberRoles is also the list the AI may choose from when labeling roles.
+var memberRoles = []string{rolePlanner, roleComedian, roleLurker, roleHypePerson, roleMediator}
+
+var (
+	planningPhrases []string
+	hypePhrases     []string
+	apologyPhrases  []string
+)
+
+func init() {
+	loadRoleData()
+}
+
+func loadRoleData() {
+	for _, list := range []struct {
+		file    string
+		target  *[]string
+		purpose string
+	}{
+		{planningPhrasesFile, &planningPhrases, "planning phrases"},
+		{hypePhrasesFile, &hypePhrases, "hype phrases"},
+		{apologyWordsFile, &apologyPhrases, "apology words"},
+	} {
+		phrases, err := loadLanguagePhrases(filepath.Join(dataDir, list.file))
+		if err != nil {
+			log.Printf("Warning: Failed to load %s: %v. Proceeding without them for role detection.", list.purpose, err)
+			phrases = []string{}
+		}
+		*list.target = phrases
+	}
+}
+
+type MemberRole struct {
+	User  string  `json:"user"`
+	Role  string  `json:"role"`
+	Score float64 `json:"score"`
+}
+
+// calculateMemberRoles gives every member of a group chat one role from
+// measured behaviour. Each trait is scored per message and scaled against the
+// member who shows it most, and a member takes the role they score highest in:
+//
+//   - planner: messages about plans, times and places
+//   - comedian: laughter from others right after their messages
+//   - hype-person: excited phrases, hype emojis and exclamation marks
+//   - mediator: apologies, weighted by how many different people they reply to
+//   - lurker: sending less than half of an even share of messages
+//
+// Lurker takes precedence, since a quiet member's few messages say little.
+func calculateMemberRoles(messagesData []ParsedMessage, userMessageCount UserMessageCount, laughter map[string]LaughterStats, intensity map[string]IntensityStats, interactions InteractionMatrix) []MemberRole {
+	if len(userMessageCount) < minUsersForRoles {
+		return nil
+	}
+
+	planning := make(map[string]int)
+	hype := make(map[string]int)
+	apologies := make(map[string]int)
+	for _, msg := range messagesData {
+		lower := strings.ToLower(msg.OriginalMessage)
+		if containsAnyPhrase(lower, planningPhrases) {
+			planning[msg.Sender]++
+		}
+		if containsAnyPhrase(lower, hypePhrases) {
+			hype[msg.Sender]++
+		}
+		if containsAnyPhrase(lower, apologyPhrases) {
+			apologies[msg.Sender]++
+		}
+	}
+
+	// interactions[a][b] counts b replying to a.
+	repliedTo := make(map[string]int)
+	for _, replies := range interactions {
+		for replier, count := range replies {
+			if count > 0 {
+				repliedTo[replier]++
+			}
+		}
+	}
+
+	users := make([]string, 0, len(userMessageCount))
+	totalMessages := 0
+	for user, count := range userMessageCount {
+		users = append(users, user)
+		totalMessages += count
+	}
+	sort.Strings(users)
+
+	others := float64(len(users) - 1)
+	raw := make(map[string]map[string]float64, len(memberRoles))
+	for _, role := range memberRoles {
+		raw[role] = make(map[string]float64, len(users))
+	}
+	for _, user := range users {
+		messages := float64(userMessageCount[user])
+		raw[rolePlanner][user] = float64(planning[user]) / messages
+		raw[roleComedian][user] = float64(laughter[user].LaughsReceived) / messages
+		raw[roleHypePerson][user] = float64(hype[user])/messages + intensity[user].ExclamationsPerMessage/2
+		raw[roleMediator][user] = float64(apologies[user]) / messages * float64(repliedTo[user]) / others
+	}
+
+	maxByRole := make(map[string]float64, len(raw))
+	for role, scores := range raw {
+		for _, score := range scores {
+			maxByRole[role] = max(maxByRole[role], score)
+		}
+	}
+
+	fairShare := float64(totalMessages) / float64(len(users))
+	roles := make([]MemberRole, 0, len(users))
+	for _, user := range users {
+		if share := float64(userMessageCount[user]) / fairShare; share < 0.5 {
+			roles = append(roles, MemberRole{User: user, Role: roleLurker, Score: roundFloat(1-share*2, 3)})
+			continue
+		}
+
+		best := MemberRole{User: user}
+		for _, role := range memberRoles {
+			if role == roleLurker {
+				continue
+			}
+			if score := safeRatio(raw[role][user], maxByRole[role]); score > best.Score {
+				best.Role, best.Score = role, score
+			}
+		}
+		if best.Role != "" {
+			roles = append(roles, best)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// seasonPeakRatio is how far above a year's average month a month must be
+	// to count as a peak for that year.
+	seasonPeakRatio       = 1.25
+	seasonMinYearsPeaked  = 2
+	seasonMinYearsInRange = 2
+)
+
+type MonthOfYearActivity struct {
+	Month            string  `json:"month"`
+	AvgMessages      float64 `json:"avg_messages"`
+	RelativeActivity float64 `json:"relative_activity"`
+	YearsObserved    int     `json:"years_observed"`
+	YearsPeaked      int     `json:"years_peaked"`
+}
+
+type SeasonalityStats struct {
+	Season        string                `json:"season,omitempty"`
+	PeakMonths    []string              `json:"peak_months"`
+	BusiestMonth  string                `json:"busiest_month"`
+	QuietestMonth string                `json:"quietest_month"`
+	MonthOfYear   []MonthOfYearActivity `json:"month_of_year"`
+}
+
+// calculateSeasonality compares each calendar month against the average month
+// of the same year, then aggregates by month of year. A month is a recurring
+// peak when it ran well above its year's average in at least two years and in
+// at least half of the years it was observed. The first and last month of the
+// chat are partial and left out, and the result is nil until the remaining
+// months cover the same month of year twice.
+func calculateSeasonality(messagesData []ParsedMessage) *SeasonalityStats {
+	if len(messagesData) == 0 {
+		return nil
+	}
+
+	first := messagesData[0].Timestamp
+	last := messagesData[len(messagesData)-1].Timestamp
+	start := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	end := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if !start.Before(end) {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, msg := range messagesData {
+		counts[msg.Timestamp.Format("2006-01")]++
+	}
+
+	// Every full month in range, including silent ones.
+	byYear := make(map[int]map[time.Month]int)
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		if _, ok := byYear[month.Year()]; !ok {
+			byYear[month.Year()] = make(map[time.Month]int)
+		}
+		byYear[month.Year()][month.Month()] = counts[month.Format("2006-01")]
+	}
+
+	type accumulator struct {
+		messages int
+		relative float64
+		years    int
+		peaked   int
+	}
+	var monthsOfYear [13]accumulator
+	for _, months := range byYear {
+		total := 0
+		for _, count := range months {
+			total += count
+		}
+		yearAverage := float64(total) / float64(len(months))
+		for month, count := range months {
+			acc := &monthsOfYear[month]
+			acc.messages += count
+			acc.years++
+			if yearAverage > 0 {
+				relative := float64(count) / yearAverage
+				acc.relative += relative
+				if relative >= seasonPeakRatio {
+					acc.peaked++
+				}
+			}
+		}
+	}
+
+	seasonality := &SeasonalityStats{PeakMonths: []string{}, MonthOfYear: []MonthOfYearActivity{}}
+	var busiest, quietest *MonthOfYearActivity
+	repeatedMonth := false
+	for month := time.January; month <= time.December; month++ {
+		acc := monthsOfYear[month]
+		if acc.years == 0 {
+			continue
+		}
+		activity := MonthOfYearActivity{
+			Month:            month.String(),
+			AvgMessages:      roundFloat(float64(acc.messages)/float64(acc.years), 2),
+			RelativeActivity: roundFloat(acc.relative/float64(acc.years), 2),
+			YearsObserved:    acc.years,
+			YearsPeaked:      acc.peaked,
+		}
+		seasonality.MonthOfYear = append(seasonality.MonthOfYear, activity)
+
+		if acc.years < seasonMinYearsInRange {
+			continue
+		}
+		repeatedMonth = true
+		if acc.peaked >= seasonMinYearsPeaked && acc.peaked*2 >= acc.years {
+			seasonality.PeakMonths = append(seasonality.PeakMonths, activity.Month)
+		}
+		if busiest == nil || activity.RelativeActivity > busiest.RelativeActivity {
+			busiest = &seasonality.MonthOfYear[len(seasonality.MonthOfYear)-1]
+		}
+		if quietest == nil || activity.RelativeActivity < quietest.RelativeActivity {
+			quietest = &seasonality.MonthOfYear[len(seasonality.MonthOfYear)-1]
+		}
+	}
+	if !repeatedMonth {
+		return nil
+	}
+
+	relativeOf := make(map[string]float64, len(seasonality.MonthOfYear))
+	for _, activity := range seasonality.MonthOfYear {
+		relativeOf[activity.Month] = activity.RelativeActivity
+	}
+	sort.SliceStable(seasonality.PeakMonths, func(i, j int) bool {
+		return relativeOf[seasonality.PeakMonths[i]] > relativeOf[seasonality.PeakMonths[j]]
+	})
+	if len(seasonality.PeakMonths) > 0 {
+		seasonality.Season = seasonality.PeakMonths[0]
+	}
+	seasonality.BusiestMonth = busiest.Month
+	seasonality.QuietestMonth = quietest.Month
+	return seasonality
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+type UserPairSimilarity struct {
+	Users                [2]string `json:"users"`
+	Score                float64   `json:"score"`
+	StyleSimilarity      float64   `json:"style_similarity"`
+	VocabularySimilarity float64   `json:"vocabulary_similarity"`
+}
+
+type TextingSimilarity struct {
+	MostSimilar  UserPairSimilarity `json:"most_similar"`
+	MostOpposite UserPairSimilarity `json:"most_opposite"`
+}
+
+// calculateTextingSimilarity scores every pair of users by how alike they
+// write: half from the distance between their normalized style fingerprints,
+// half from the cosine similarity of their word counts. It needs at least three
+// users, otherwise the most similar and most opposite pair would be the same.
+func calculateTextingSimilarity(fingerprints map[string]StyleFingerprint, userWordCounts UserStringIntMap) *TextingSimilarity {
+	users := make([]string, 0, len(fingerprints))
+	for user := range fingerprints {
+		users = append(users, user)
+	}
+	if len(users) < 3 {
+		return nil
+	}
+	sort.Strings(users)
+
+	var pairs []UserPairSimilarity
+	for i := 0; i < len(users); i++ {
+		for j := i + 1; j < len(users); j++ {
+			a, b := users[i], users[j]
+			style := styleSimilarity(fingerprints[a].Normalized, fingerprints[b].Normalized)
+			vocabulary := cosineSimilarity(userWordCounts[a], userWordCounts[b])
+			pairs = append(pairs, UserPairSimilarity{
+				Users:                [2]string{a, b},
+				Score:                roundFloat((style+vocabulary)/2, 3),
+				StyleSimilarity:      roundFloat(style, 3),
+				VocabularySimilarity: roundFloat(vocabulary, 3),
+			})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Score > pairs[j].Score
+	})
+
+	return &TextingSimilarity{
+		MostSimilar:  pairs[0],
+		MostOpposite: pairs[len(pairs)-1],
+	}
+}
+
+func styleSimilarity(a, b StyleVector) float64 {
+	diffs := []float64{
+		a.MessageLength - b.MessageLength,
+		a.Emoji - b.Emoji,
+		a.Punctuation - b.Punctuation,
+		a.Caps - b.Caps,
+		a.ResponseSpeed - b.ResponseSpeed,
+	}
+	sumSquares := 0.0
+	for _, d := range diffs {
+		sumSquares += d * d
+	}
+	return 1 - math.Sqrt(sumSquares)/math.Sqrt(float64(len(diffs)))
+}
+
+func cosineSimilarity(a, b map[string]int) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	dot, normA, normB := 0.0, 0.0, 0.0
+	for word, countA := range a {
+		normA += float64(countA * countA)
+		if countB, ok := b[word]; ok {
+			dot += float64(countA * countB)
+		}
+	}
+	for _, countB := range b {
+		normB += float64(countB * countB)
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
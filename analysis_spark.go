@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// sparkChainCap stops the first turn of a long conversation from scoring
+	// far above everyone else just for being first.
+	sparkChainCap = 10
+	// sparkMinTurns keeps members who barely spoke out of the ranking.
+	sparkMinTurns = 10
+)
+
+// ResponseChainStats describes what happens after someone speaks. A turn is a
+// run of consecutive messages from one person; AvgChain is how many turns by
+// anyone follow one of theirs before the conversation breaks, counting at
+// most ten.
+type ResponseChainStats struct {
+	Turns    int     `json:"turns"`
+	AvgChain float64 `json:"avg_chain"`
+}
+
+// calculateResponseChains returns each member's response-chain stats and the
+// members ranked by conversational spark, highest average chain first.
+func calculateResponseChains(messagesData []ParsedMessage, convoBreak time.Duration) (map[string]ResponseChainStats, []AverageChampion) {
+	type turn struct {
+		sender string
+		convo  int
+	}
+	var turns []turn
+	convo := 0
+	for i, msg := range messagesData {
+		if i > 0 {
+			prev := messagesData[i-1]
+			if msg.Timestamp.Sub(prev.Timestamp) > convoBreak {
+				convo++
+			} else if msg.Sender == prev.Sender {
+				continue
+			}
+		}
+		turns = append(turns, turn{sender: msg.Sender, convo: convo})
+	}
+
+	turnCounts := make(map[string]int)
+	chainTotals := make(map[string]int)
+	following := 0
+	for i := len(turns) - 1; i >= 0; i-- {
+		if i == len(turns)-1 || turns[i+1].convo != turns[i].convo {
+			following = 0
+		} else {
+			following++
+		}
+		turnCounts[turns[i].sender]++
+		chainTotals[turns[i].sender] += min(following, sparkChainCap)
+	}
+
+	chains := make(map[string]ResponseChainStats)
+	var ranking []AverageChampion
+	for user, count := range turnCounts {
+		avg := roundFloat(float64(chainTotals[user])/float64(count), 2)
+		chains[user] = ResponseChainStats{Turns: count, AvgChain: avg}
+		if count >= sparkMinTurns {
+			ranking = append(ranking, AverageChampion{User: user, Value: avg})
+		}
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Value != ranking[j].Value {
+			return ranking[i].Value > ranking[j].Value
+		}
+		return ranking[i].User < ranking[j].User
+	})
+	return chains, ranking
+}
@@ -6,10 +6,12 @@ import (
 	"math"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
 
+	"bloop-go-server/pkg/parser"
 	"golang.org/x/exp/maps"
 )
 
@@ -33,11 +35,35 @@ type UserActivityChartData struct {
 	Data []GraphPoint `json:"data"`
 }
 
+// SharePoint is a percentage in a Nivo line series; Y is null for a month
+// with nothing to share out, which Nivo draws as a gap.
+type SharePoint struct {
+	X string   `json:"x"`
+	Y *float64 `json:"y"`
+}
+
+type UserShareChartData struct {
+	ID   string       `json:"id"`
+	Data []SharePoint `json:"data"`
+}
+
+// WeekdayWeekendAverage compares messages per active day on weekdays and at
+// weekends. ByWeekday runs Monday to Sunday.
 type WeekdayWeekendAverage struct {
-	AverageWeekdayMessages float64 `json:"average_weekday_messages"`
-	AverageWeekendMessages float64 `json:"average_weekend_messages"`
-	Difference             float64 `json:"difference"`
-	PercentageDifference   float64 `json:"percentage_difference"`
+	AverageWeekdayMessages float64          `json:"average_weekday_messages"`
+	AverageWeekendMessages float64          `json:"average_weekend_messages"`
+	Difference             float64          `json:"difference"`
+	PercentageDifference   float64          `json:"percentage_difference"`
+	ActiveWeekdays         int              `json:"active_weekdays"`
+	ActiveWeekendDays      int              `json:"active_weekend_days"`
+	ByWeekday              []WeekdayAverage `json:"by_weekday"`
+}
+
+type WeekdayAverage struct {
+	Day             string  `json:"day"`
+	Messages        int     `json:"messages"`
+	ActiveDays      int     `json:"active_days"`
+	AverageMessages float64 `json:"average_messages"`
 }
 
 type ChampionInfo struct {
@@ -46,27 +72,97 @@ type ChampionInfo struct {
 }
 
 type ChatStatistics struct {
-	TotalMessages              int                     `json:"total_messages"`
-	DaysActive                 int                     `json:"days_active"`
-	UserMessageCount           UserMessageCount        `json:"user_message_count"`
-	MostActiveUsersPct         PercentageMap           `json:"most_active_users_pct"`
-	ConversationStartersPct    PercentageMap           `json:"conversation_starters_pct"`
-	MostIgnoredUsersPct        PercentageMap           `json:"most_ignored_users_pct"`
-	FirstTextChampion          ChampionInfo            `json:"first_text_champion"`
-	LongestMonologue           ChampionInfo            `json:"longest_monologue"`
-	CommonWords                StringIntMap            `json:"common_words"`
-	CommonEmojis               StringIntMap            `json:"common_emojis"`
-	AverageResponseTimeMinutes float64                 `json:"average_response_time_minutes"`
-	PeakHour                   *int                    `json:"peak_hour"`
+	TotalMessages           int              `json:"total_messages"`
+	DaysActive              int              `json:"days_active"`
+	UserMessageCount        UserMessageCount `json:"user_message_count"`
+	MostActiveUsersPct      PercentageMap    `json:"most_active_users_pct"`
+	ConversationStartersPct PercentageMap    `json:"conversation_starters_pct,omitempty"`
+	// ConversationStartersMonthly is each member's share of the conversations
+	// started in each month.
+	ConversationStartersMonthly []UserShareChartData `json:"conversation_starters_monthly,omitempty"`
+	ConversationEndersPct       PercentageMap        `json:"conversation_enders_pct,omitempty"`
+	ConversationKillersPct      PercentageMap        `json:"conversation_killers_pct,omitempty"`
+	ConversationKiller          *ChampionInfo        `json:"conversation_killer,omitempty"`
+	MostIgnoredUsersPct         PercentageMap        `json:"most_ignored_users_pct,omitempty"`
+	FirstTextChampion           *ChampionInfo        `json:"first_text_champion,omitempty"`
+	LongestMonologue            *ChampionInfo        `json:"longest_monologue,omitempty"`
+	CommonWords                 StringIntMap         `json:"common_words"`
+	Wordcloud                   []WordcloudToken     `json:"wordcloud"`
+	CommonEmojis                StringIntMap         `json:"common_emojis"`
+	AverageResponseTimeMinutes  *float64             `json:"average_response_time_minutes,omitempty"`
+	ResponseTimePercentiles     *DurationPercentiles `json:"response_time_percentiles,omitempty"`
+	// ConversationGapPercentiles covers the quiet spells between
+	// conversations, i.e. gaps longer than the conversation break.
+	ConversationGapPercentiles *DurationPercentiles    `json:"conversation_gap_percentiles,omitempty"`
+	PeakHour                   *int                    `json:"peak_hour,omitempty"`
 	UserMonthlyActivity        []UserActivityChartData `json:"user_monthly_activity"`
-	WeekdayVsWeekendAvg        WeekdayWeekendAverage   `json:"weekday_vs_weekend_avg"`
+	DailyCounts                []DailyCount            `json:"daily_counts"`
+	CalendarHeatmap            *CalendarHeatmap        `json:"calendar_heatmap"`
+	WeekdayVsWeekendAvg        *WeekdayWeekendAverage  `json:"weekday_vs_weekend_avg,omitempty"`
 	UserInteractionMatrix      [][]interface{}         `json:"user_interaction_matrix,omitempty"`
+	UserInteractionMatrixPct   [][]interface{}         `json:"user_interaction_matrix_pct,omitempty"`
+	StrongestPairs             []InteractionPair       `json:"strongest_pairs,omitempty"`
+	// UserResponseMatrix has the interaction matrix layout, with each cell the
+	// average minutes from the row member's message to the column member's
+	// reply, or null when they never replied.
+	UserResponseMatrix       [][]interface{}               `json:"user_response_matrix,omitempty"`
+	ResponseAsymmetries      []ResponseAsymmetry           `json:"response_asymmetries,omitempty"`
+	UserStyleFingerprints    map[string]StyleFingerprint   `json:"user_style_fingerprints"`
+	TextingSimilarity        *TextingSimilarity            `json:"texting_similarity,omitempty"`
+	Topics                   *TopicSummary                 `json:"topics,omitempty"`
+	InsideJokes              []InsideJoke                  `json:"inside_jokes,omitempty"`
+	MostForwarded            []ForwardedContent            `json:"most_forwarded,omitempty"`
+	CommonEmojiCombos        StringIntMap                  `json:"common_emoji_combos"`
+	UserSignatureEmojiCombos map[string]EmojiCombo         `json:"user_signature_emoji_combos"`
+	UserMessageLengths       map[string]MessageLengthStats `json:"user_message_lengths"`
+	EssayWriter              *AverageChampion              `json:"essay_writer,omitempty"`
+	ShortestTexter           *AverageChampion              `json:"shortest_texter,omitempty"`
+	UserIntensity            map[string]IntensityStats     `json:"user_intensity"`
+	LoudestMember            *AverageChampion              `json:"loudest_member,omitempty"`
+	UserLaughter             map[string]LaughterStats      `json:"user_laughter"`
+	BiggestLaugher           *ChampionInfo                 `json:"biggest_laugher,omitempty"`
+	MostLaughedAt            *ChampionInfo                 `json:"most_laughed_at,omitempty"`
+	UserDeletedMessages      UserMessageCount              `json:"user_deleted_messages"`
+	UserEditedMessages       UserMessageCount              `json:"user_edited_messages"`
+	BiggestDeleter           *ChampionInfo                 `json:"biggest_deleter,omitempty"`
+	DeletionTrend            *DeletionTrend                `json:"deletion_trend,omitempty"`
+	UserPollCounts           UserMessageCount              `json:"user_poll_counts"`
+	UserLocationCounts       UserMessageCount              `json:"user_location_counts"`
+	Polls                    []parser.Poll                 `json:"polls,omitempty"`
+	Roles                    []MemberRole                  `json:"roles,omitempty"`
+	ChatHealth               *ChatHealth                   `json:"chat_health,omitempty"`
+	Seasonality              *SeasonalityStats             `json:"seasonality,omitempty"`
+	UserLifetimes            map[string]UserLifetime       `json:"user_lifetimes"`
+	Milestones               []Milestone                   `json:"milestones"`
+	MonthlyVolume            *MonthlyVolumeTrend           `json:"monthly_volume,omitempty"`
+	ChatEnergy               *ChatEnergy                   `json:"chat_energy,omitempty"`
+	UserResponseChains       map[string]ResponseChainStats `json:"user_response_chains,omitempty"`
+	ConversationSpark        []AverageChampion             `json:"conversation_spark,omitempty"`
+	FirstTextResponses       *FirstTextResponses           `json:"first_text_responses,omitempty"`
+	DateSpikes               []DateSpike                   `json:"date_spikes,omitempty"`
+	ChatChanges              *ChatChanges                  `json:"chat_changes,omitempty"`
+	Politeness               *PolitenessStats              `json:"politeness,omitempty"`
+	AffectionIndex           *AffectionIndex               `json:"affection_index,omitempty"`
+	MediaAttachments         *MediaAttachmentStats         `json:"media_attachments,omitempty"`
+	LongestMessages          *LongestMessages              `json:"longest_messages,omitempty"`
+	IdleMembers              *IdleMembers                  `json:"idle_members,omitempty"`
+	ParticipationBalance     *ParticipationBalance         `json:"participation_balance,omitempty"`
+	FirstReplyTimes          *FirstReplyTimes              `json:"first_reply_times,omitempty"`
+	Profanity                *ProfanityStats               `json:"profanity,omitempty"`
+	KeywordTrends            []KeywordTrend                `json:"keyword_trends,omitempty"`
+	ChartDescriptions        map[string]string             `json:"chart_descriptions,omitempty"`
+	Notes                    *NotesSummary                 `json:"notes,omitempty"`
+	OmittedStats             map[string]string             `json:"omitted_stats,omitempty"`
 }
 
-func calculatePercentile(sortedData []float64, p float64) float64 {
+// Percentile returns the p-th percentile (0–100) of ascending sortedData,
+// interpolating linearly between the two nearest ranks (rank p/100*(n+1)).
+// Percentiles beyond the ends of the data clamp to the smallest or largest
+// value, and empty data gives 0.
+func Percentile(sortedData []float64, p float64) float64 {
 	n := len(sortedData)
 	if n == 0 {
-		return 0 // Or handle as error
+		return 0
 	}
 	if p <= 0 {
 		return sortedData[0]
@@ -90,10 +186,70 @@ func calculatePercentile(sortedData []float64, p float64) float64 {
 	valKMinus1 := sortedData[k-1]
 	valK := sortedData[k]
 
-	return valKMinus1 + d*(valK-valK)
+	return valKMinus1 + d*(valK-valKMinus1)
 }
 
-func calculateDynamicConvoBreak(messagesData []ParsedMessage, defaultBreakMinutes, minBreak, maxBreak int) int {
+// DurationPercentiles summarises a distribution of gaps in minutes.
+type DurationPercentiles struct {
+	Samples    int     `json:"samples"`
+	P50Minutes float64 `json:"p50_minutes"`
+	P75Minutes float64 `json:"p75_minutes"`
+	P95Minutes float64 `json:"p95_minutes"`
+}
+
+// calculateDurationPercentiles sorts minutes in place and returns its
+// p50/p75/p95, or nil when there are no samples.
+func calculateDurationPercentiles(minutes []float64) *DurationPercentiles {
+	if len(minutes) == 0 {
+		return nil
+	}
+	sort.Float64s(minutes)
+	return &DurationPercentiles{
+		Samples:    len(minutes),
+		P50Minutes: roundFloat(Percentile(minutes, 50), 2),
+		P75Minutes: roundFloat(Percentile(minutes, 75), 2),
+		P95Minutes: roundFloat(Percentile(minutes, 95), 2),
+	}
+}
+
+const (
+	convoBreakPercentile     = 85.0
+	convoBreakPaddingMinutes = 30
+	convoBreakMinSamples     = 20
+
+	convoBreakSourceDynamic = "dynamic"
+	convoBreakSourceDefault = "default"
+	convoBreakSourceRequest = "request"
+)
+
+// responseTimeBucketEdges are the histogram bucket bounds in minutes. Reply
+// gaps of 12 hours or more are never sampled.
+var responseTimeBucketEdges = []int{0, 1, 2, 5, 10, 15, 30, 60, 120, 180, 240, 360, 720}
+
+type ResponseTimeBucket struct {
+	FromMinutes int `json:"from_minutes"`
+	ToMinutes   int `json:"to_minutes"`
+	Count       int `json:"count"`
+}
+
+// ConvoBreakDiagnostics shows how the conversation break was picked. The
+// dynamic break is the 85th percentile of reply gaps between different
+// senders plus 30 minutes, clamped to MinMinutes–MaxMinutes; with fewer than
+// 20 samples the default is used, and Source is "request" when the client
+// set the break. The histogram covers every sampled gap either way.
+type ConvoBreakDiagnostics struct {
+	Source            string               `json:"source"`
+	Minutes           int                  `json:"minutes"`
+	ResponseSamples   int                  `json:"response_samples"`
+	Percentile        float64              `json:"percentile"`
+	PercentileMinutes float64              `json:"percentile_minutes"`
+	PaddingMinutes    int                  `json:"padding_minutes"`
+	MinMinutes        int                  `json:"min_minutes"`
+	MaxMinutes        int                  `json:"max_minutes"`
+	Histogram         []ResponseTimeBucket `json:"histogram"`
+}
+
+func calculateDynamicConvoBreak(messagesData []ParsedMessage, defaultBreakMinutes, minBreak, maxBreak int) (int, *ConvoBreakDiagnostics) {
 	responseTimesMinutes := []float64{}
 	var lastTimestamp time.Time
 	var lastSender string
@@ -112,22 +268,50 @@ func calculateDynamicConvoBreak(messagesData []ParsedMessage, defaultBreakMinute
 		firstTimestampProcessed = true
 	}
 
-	if len(responseTimesMinutes) < 20 {
+	diagnostics := &ConvoBreakDiagnostics{
+		Source:          convoBreakSourceDefault,
+		Minutes:         defaultBreakMinutes,
+		ResponseSamples: len(responseTimesMinutes),
+		Percentile:      convoBreakPercentile,
+		PaddingMinutes:  convoBreakPaddingMinutes,
+		MinMinutes:      minBreak,
+		MaxMinutes:      maxBreak,
+		Histogram:       responseTimeHistogram(responseTimesMinutes),
+	}
+
+	if len(responseTimesMinutes) < convoBreakMinSamples {
 		log.Printf("Not enough response time data (%d points) for dynamic break, using default: %d mins", len(responseTimesMinutes), defaultBreakMinutes)
-		return defaultBreakMinutes
+		return defaultBreakMinutes, diagnostics
 	}
 
 	sort.Float64s(responseTimesMinutes)
 
-	p85 := calculatePercentile(responseTimesMinutes, 85.0)
+	p85 := Percentile(responseTimesMinutes, convoBreakPercentile)
 
-	dynamicBreak := p85 + 30
+	dynamicBreak := p85 + convoBreakPaddingMinutes
 
 	dynamicBreakClamped := math.Max(float64(minBreak), math.Min(dynamicBreak, float64(maxBreak)))
 
 	result := int(math.Round(dynamicBreakClamped))
 	// log.Printf("Calculated dynamic conversation break: %d minutes (based on p85=%.2f)", result, p85)
-	return result
+	diagnostics.Source = convoBreakSourceDynamic
+	diagnostics.Minutes = result
+	diagnostics.PercentileMinutes = roundFloat(p85, 2)
+	return result, diagnostics
+}
+
+func responseTimeHistogram(responseTimesMinutes []float64) []ResponseTimeBucket {
+	buckets := make([]ResponseTimeBucket, len(responseTimeBucketEdges)-1)
+	for i := range buckets {
+		buckets[i] = ResponseTimeBucket{FromMinutes: responseTimeBucketEdges[i], ToMinutes: responseTimeBucketEdges[i+1]}
+	}
+	for _, minutes := range responseTimesMinutes {
+		i := sort.Search(len(buckets), func(i int) bool { return minutes < float64(buckets[i].ToMinutes) })
+		if i < len(buckets) {
+			buckets[i].Count++
+		}
+	}
+	return buckets
 }
 
 func countTopN(counter map[string]int, n int) StringIntMap {
@@ -156,9 +340,65 @@ func countTopN(counter map[string]int, n int) StringIntMap {
 	return topN
 }
 
+// convoKillerWindow is how quickly a reply has to follow the previous message
+// for the chat to count as still flowing. A reply like that which is then met
+// with a conversation break killed the conversation; any last message before
+// a break just ended it.
+const convoKillerWindow = 5 * time.Minute
+
+// Default and largest sizes of the common words and emojis lists.
+const (
+	defaultTopWords  = 10
+	maxTopWords      = 100
+	defaultTopEmojis = 6
+	maxTopEmojis     = 50
+)
+
+// parseTopN reads a requested list size from 1 to limit; empty means the
+// default and is returned as zero.
+func parseTopN(raw string, limit int) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 || n > limit {
+		return 0, fmt.Errorf("must be from 1 to %d", limit)
+	}
+	return n, nil
+}
+
 // main stats calculation function
 
-func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int) (*ChatStatistics, error) {
+// statsOptions carries the per-request choices that change the stats.
+type statsOptions struct {
+	// topWords and topEmojis size the common words and emojis lists; zero
+	// keeps the defaults.
+	topWords  int
+	topEmojis int
+	// collapseForwards counts the words and emojis of forwarded content once
+	// instead of once per copy.
+	collapseForwards bool
+	// changeDate splits the chat for stats.chat_changes; zero splits it at
+	// its midpoint.
+	changeDate time.Time
+	// profanity turns on stats.profanity, which is off unless asked for.
+	profanity bool
+	// groupEvents let stats.idle_members include members who never wrote.
+	groupEvents []parser.GroupEvent
+}
+
+func calculateChatStatistics(messagesData []ParsedMessage, markers parser.Markers, convoBreakMinutes int, opts statsOptions) (*ChatStatistics, error) {
+	topWords, topEmojis := opts.topWords, opts.topEmojis
+	if topWords == 0 {
+		topWords = defaultTopWords
+	}
+	if topEmojis == 0 {
+		topEmojis = defaultTopEmojis
+	}
 	// log.Printf("Starting statistics calculation for %d messages...", len(messagesData))
 	if len(messagesData) == 0 {
 		return nil, fmt.Errorf("cannot calculate statistics on empty message list")
@@ -166,18 +406,24 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 
 	userMessageCount := make(UserMessageCount)
 	userStartsConvo := make(map[string]int)
+	monthlyStartsByUser := make(UserStringIntMap) // user -> month (YYYY-MM) -> conversations started
+	userEndsConvo := make(map[string]int)
+	userKillsConvo := make(map[string]int)
 	userFirstTexts := make(map[string]int) // Count per day
 	wordCounter := make(map[string]int)
-	emojiCounter := make(map[string]int) // Counts distinct emojis per message
+	userWordCounter := make(UserStringIntMap) // user -> word -> count
+	emojiCounter := make(map[string]int)      // Counts distinct emojis per message
 
 	dailyMessageCountByDate := make(map[string]int) // YYYY-MM-DD -> count
 	hourlyMessageCount := make(map[int]int)         // 0-23 -> count
-	dailyMessageCountByWeekday := make(map[int]int) // 0 (Sun) - 6 (Sat) -> count
 	monthlyActivityByUser := make(UserStringIntMap) // user -> month (YYYY-MM) -> count
 
 	totalResponseTimeSeconds := 0.0
 	responseCount := 0
+	responseTimesMinutes := []float64{}
+	conversationGapsMinutes := []float64{}
 	interactionMatrix := make(InteractionMatrix)
+	pairResponses := make(pairResponseTimes)
 
 	maxMonologueCount := 0
 	maxMonologueSender := ""
@@ -187,6 +433,7 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 	var lastTimestamp time.Time
 	var lastSender string
 	var lastDateStr string
+	lastWasQuickReply := false
 	currentConvoStartSender := ""
 	allMonths := make(map[string]struct{})
 	userIgnoredCount := make(map[string]int)
@@ -196,6 +443,9 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 
 	wordRegex := regexp.MustCompile(`\b[a-zA-Z0-9]{3,}\b`)
 
+	mostForwarded, forwardedKeys := findForwardedContent(messagesData)
+	countedForwards := make(map[string]struct{})
+
 	convoBreakDuration := time.Duration(convoBreakMinutes) * time.Minute
 
 	for i, msg := range messagesData {
@@ -206,12 +456,19 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 			timeDiff := msg.Timestamp.Sub(lastTimestamp)
 			if timeDiff > convoBreakDuration {
 				isNewConvo = true
+				conversationGapsMinutes = append(conversationGapsMinutes, timeDiff.Minutes())
 				currentConvoStartSender = msg.Sender // This message starts a new convo
+				userEndsConvo[lastSender]++
+				if lastWasQuickReply {
+					userKillsConvo[lastSender]++
+				}
 			} else if lastSender != "" && msg.Sender != lastSender {
 				responseDiffSeconds := timeDiff.Seconds()
 				if responseDiffSeconds > 5 && responseDiffSeconds < (12*3600) {
 					totalResponseTimeSeconds += responseDiffSeconds
 					responseCount++
+					responseTimesMinutes = append(responseTimesMinutes, responseDiffSeconds/60.0)
+					pairResponses.add(lastSender, msg.Sender, responseDiffSeconds)
 				}
 				if _, ok := interactionMatrix[lastSender]; !ok {
 					interactionMatrix[lastSender] = make(map[string]int)
@@ -225,6 +482,11 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 
 		if isNewConvo && currentConvoStartSender != "" {
 			userStartsConvo[currentConvoStartSender]++
+			startMonth := msg.Timestamp.Format("2006-01")
+			if _, ok := monthlyStartsByUser[currentConvoStartSender]; !ok {
+				monthlyStartsByUser[currentConvoStartSender] = make(map[string]int)
+			}
+			monthlyStartsByUser[currentConvoStartSender][startMonth]++
 			currentConvoStartSender = ""
 		}
 
@@ -250,14 +512,35 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 			currentStreakCount = 1
 		}
 
+		countContent := true
+		if opts.collapseForwards {
+			if key := forwardKey(msg.OriginalMessage); key != "" {
+				if _, forwarded := forwardedKeys[key]; forwarded {
+					_, counted := countedForwards[key]
+					countedForwards[key] = struct{}{}
+					countContent = !counted
+				}
+			}
+		}
+
 		words := wordRegex.FindAllString(strings.ToLower(msg.CleanedMessage), -1)
+		if !countContent {
+			words = nil
+		}
 		for _, word := range words {
 			if _, isStopword := stopwordsSet[word]; !isStopword {
 				wordCounter[word]++
+				if _, ok := userWordCounter[msg.Sender]; !ok {
+					userWordCounter[msg.Sender] = make(map[string]int)
+				}
+				userWordCounter[msg.Sender][word]++
 			}
 		}
 
-		foundEmojis := emojiPattern.FindAllString(msg.OriginalMessage, -1)
+		var foundEmojis []string
+		if countContent {
+			foundEmojis = emojiPattern.FindAllString(msg.OriginalMessage, -1)
+		}
 		for _, emojiMatch := range foundEmojis {
 			runes := []rune(emojiMatch)
 			for i := 0; i < len(runes); i++ {
@@ -278,7 +561,6 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 
 		dailyMessageCountByDate[currentDateStr]++
 		hourlyMessageCount[msg.Timestamp.Hour()]++
-		dailyMessageCountByWeekday[int(msg.Timestamp.Weekday())]++
 
 		monthStr := msg.Timestamp.Format("2006-01")
 		if _, ok := monthlyActivityByUser[msg.Sender]; !ok {
@@ -291,6 +573,7 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 			userIgnoredCount[msg.Sender]++
 		}
 
+		lastWasQuickReply = !isFirstMessage && msg.Sender != lastSender && msg.Timestamp.Sub(lastTimestamp) <= convoKillerWindow
 		lastSender = msg.Sender
 		lastTimestamp = msg.Timestamp
 
@@ -319,6 +602,9 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 		}
 	}
 
+	conversationEndersPct := shareOfTotal(userEndsConvo)
+	conversationKillersPct := shareOfTotal(userKillsConvo)
+
 	totalIgnored := 0
 	for _, count := range userIgnoredCount {
 		totalIgnored += count
@@ -364,27 +650,149 @@ func calculateChatStatistics(messagesData []ParsedMessage, convoBreakMinutes int
 		daysActive = int(latestMessageTimestamp.Sub(firstMessageTimestamp).Hours()/24) + 1
 	}
 
+	styleFingerprints := calculateStyleFingerprints(messagesData, convoBreakDuration)
+	commonEmojiCombos, signatureEmojiCombos := calculateEmojiCombos(messagesData)
+	messageLengths, essayWriter, shortestTexter := calculateMessageLengthStats(messagesData)
+	userIntensity, loudestMember := calculateIntensityStats(messagesData)
+	userLaughter, biggestLaugher, mostLaughedAt := calculateLaughterStats(markers, convoBreakDuration)
+	markerUsers := markers.Senders(maps.Keys(userMessageCount))
+	userDeleted := markerCounts(markers.Deleted, markerUsers)
+	deletionTrend := calculateDeletionTrend(markers.DeletedByMonth, monthlyActivityByUser)
+	seasonality := calculateSeasonality(messagesData)
+	responseChains, conversationSpark := calculateResponseChains(messagesData, convoBreakDuration)
+	chatHealth := calculateChatHealth(messagesData, convoBreakDuration, time.Now())
+	roles := calculateMemberRoles(messagesData, userMessageCount, userLaughter, userIntensity, interactionMatrix)
+
 	stats := &ChatStatistics{
-		TotalMessages:              totalMessages,
-		DaysActive:                 daysActive,
-		UserMessageCount:           userMessageCount,
-		MostActiveUsersPct:         mostActiveUsersPct,
-		ConversationStartersPct:    conversationStartersPct,
-		MostIgnoredUsersPct:        mostIgnoredUsersPct,
-		FirstTextChampion:          firstTextChampion,
-		LongestMonologue:           ChampionInfo{User: maxMonologueSender, Count: maxMonologueCount},
-		CommonWords:                countTopN(wordCounter, 10),
-		CommonEmojis:               countTopN(emojiCounter, 6),
-		AverageResponseTimeMinutes: averageResponseTimeMinutes,
-		PeakHour:                   peakHour,
-		UserMonthlyActivity:        getMonthlyActivity(monthlyActivityByUser, allMonths, maps.Keys(userMessageCount)),
-		WeekdayVsWeekendAvg:        calcWeekdayWeekendAvg(dailyMessageCountByWeekday),
-		UserInteractionMatrix:      formatInteractionMatrix(interactionMatrix, maps.Keys(userMessageCount)),
+		TotalMessages:               totalMessages,
+		DaysActive:                  daysActive,
+		UserMessageCount:            userMessageCount,
+		MostActiveUsersPct:          mostActiveUsersPct,
+		ConversationStartersPct:     conversationStartersPct,
+		ConversationStartersMonthly: getMonthlyShare(monthlyStartsByUser, allMonths, maps.Keys(userMessageCount)),
+		ConversationEndersPct:       conversationEndersPct,
+		ConversationKillersPct:      conversationKillersPct,
+		ConversationKiller:          topCountChampion(userKillsConvo),
+		MostIgnoredUsersPct:         mostIgnoredUsersPct,
+		FirstTextChampion:           &firstTextChampion,
+		LongestMonologue:            &ChampionInfo{User: maxMonologueSender, Count: maxMonologueCount},
+		CommonWords:                 countTopN(wordCounter, topWords),
+		Wordcloud:                   calculateWordcloud(wordCounter, userWordCounter),
+		CommonEmojis:                countTopN(emojiCounter, topEmojis),
+		AverageResponseTimeMinutes:  &averageResponseTimeMinutes,
+		ResponseTimePercentiles:     calculateDurationPercentiles(responseTimesMinutes),
+		ConversationGapPercentiles:  calculateDurationPercentiles(conversationGapsMinutes),
+		PeakHour:                    peakHour,
+		UserMonthlyActivity:         getMonthlyActivity(monthlyActivityByUser, allMonths, maps.Keys(userMessageCount)),
+		DailyCounts:                 calculateDailyCounts(messagesData),
+		CalendarHeatmap:             calculateCalendarHeatmap(messagesData),
+		WeekdayVsWeekendAvg:         calcWeekdayWeekendAvg(dailyMessageCountByDate),
+		UserInteractionMatrix:       formatInteractionMatrix(interactionMatrix, maps.Keys(userMessageCount)),
+		UserInteractionMatrixPct:    formatInteractionMatrixPct(interactionMatrix, maps.Keys(userMessageCount)),
+		StrongestPairs:              calculateStrongestPairs(interactionMatrix, maps.Keys(userMessageCount), strongestPairsLimit),
+		UserResponseMatrix:          formatResponseMatrix(pairResponses, maps.Keys(userMessageCount)),
+		ResponseAsymmetries:         calculateResponseAsymmetries(pairResponses, responseAsymmetriesLimit),
+		UserStyleFingerprints:       styleFingerprints,
+		TextingSimilarity:           calculateTextingSimilarity(styleFingerprints, userWordCounter),
+		Topics:                      extractTopics(messagesData, float64(convoBreakMinutes)/60.0),
+		InsideJokes:                 findInsideJokes(messagesData),
+		MostForwarded:               mostForwarded,
+		CommonEmojiCombos:           commonEmojiCombos,
+		UserSignatureEmojiCombos:    signatureEmojiCombos,
+		UserMessageLengths:          messageLengths,
+		EssayWriter:                 essayWriter,
+		ShortestTexter:              shortestTexter,
+		UserIntensity:               userIntensity,
+		LoudestMember:               loudestMember,
+		UserLaughter:                userLaughter,
+		BiggestLaugher:              biggestLaugher,
+		MostLaughedAt:               mostLaughedAt,
+		UserDeletedMessages:         userDeleted,
+		UserEditedMessages:          markerCounts(markers.Edited, markerUsers),
+		BiggestDeleter:              topCountChampion(userDeleted),
+		DeletionTrend:               deletionTrend,
+		UserPollCounts:              markerCounts(markers.Polls, markerUsers),
+		UserLocationCounts:          markerCounts(markers.Locations, markerUsers),
+		Polls:                       markers.PollList,
+		Roles:                       roles,
+		ChatHealth:                  chatHealth,
+		Seasonality:                 seasonality,
+		UserLifetimes:               calculateUserLifetimes(messagesData),
+		Milestones:                  calculateMilestones(messagesData),
+		MonthlyVolume:               calculateMonthlyVolume(messagesData),
+		ChatEnergy:                  calculateChatEnergy(messagesData),
+		UserResponseChains:          responseChains,
+		ConversationSpark:           conversationSpark,
+		FirstTextResponses:          calculateFirstTextResponses(messagesData, convoBreakDuration),
+		DateSpikes:                  calculateDateSpikes(messagesData),
+		ChatChanges:                 calculateChatChanges(messagesData, convoBreakDuration, opts.changeDate),
+		Politeness:                  calculatePolitenessStats(messagesData),
+		AffectionIndex:              calculateAffectionIndex(messagesData, convoBreakDuration),
+		MediaAttachments:            calculateMediaAttachmentStats(markers.Attachments),
+		LongestMessages:             calculateLongestMessages(messagesData),
+		IdleMembers:                 calculateIdleMembers(messagesData, opts.groupEvents),
+		ParticipationBalance:        calculateParticipationBalance(messagesData, convoBreakDuration),
+		FirstReplyTimes:             calculateFirstReplyTimes(messagesData, convoBreakDuration),
+	}
+	if opts.profanity {
+		stats.Profanity = calculateProfanityStats(messagesData)
 	}
 
+	stats.OmittedStats = applyStatThresholds(stats, totalMessages)
+
+	if len(markers.Sent) == 1 {
+		stats.Notes = calculateNotesSummary(messagesData)
+		if stats.OmittedStats == nil {
+			stats.OmittedStats = make(map[string]string)
+		}
+		for _, name := range notesModeOmittedStats {
+			statOmitters[name](stats)
+			stats.OmittedStats[name] = "Not applicable to a notes-to-self chat."
+		}
+	}
+	stats.ChartDescriptions = describeCharts(stats)
+
 	return stats, nil
 }
 
+// markerCounts reports a marker count for every sender, including senders
+// whose only messages were deleted, polls or other stripped kinds.
+func markerCounts(counts map[string]int, users map[string]struct{}) UserMessageCount {
+	result := make(UserMessageCount, len(users))
+	for user := range users {
+		result[user] = counts[user]
+	}
+	return result
+}
+
+// shareOfTotal turns per-user counts into each user's percentage of the total.
+func shareOfTotal(counts map[string]int) PercentageMap {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	shares := make(PercentageMap)
+	if total > 0 {
+		for user, count := range counts {
+			shares[user] = roundFloat(float64(count)*100.0/float64(total), 2)
+		}
+	}
+	return shares
+}
+
+func topCountChampion(counts UserMessageCount) *ChampionInfo {
+	users := maps.Keys(counts)
+	sort.Strings(users)
+
+	var champion *ChampionInfo
+	for _, user := range users {
+		if count := counts[user]; count > 0 && (champion == nil || count > champion.Count) {
+			champion = &ChampionInfo{User: user, Count: count}
+		}
+	}
+	return champion
+}
+
 func getMonthlyActivity(monthlyActivityByUser UserStringIntMap, allMonths map[string]struct{}, allUsersList []string) []UserActivityChartData {
 	if len(allMonths) == 0 || len(allUsersList) == 0 {
 		return []UserActivityChartData{}
@@ -410,42 +818,103 @@ func getMonthlyActivity(monthlyActivityByUser UserStringIntMap, allMonths map[st
 	return userMonthlyStats
 }
 
-func calcWeekdayWeekendAvg(dailyMessageCountByWeekday map[int]int) WeekdayWeekendAverage {
-	totalWeekday := 0
-	totalWeekend := 0
+// getMonthlyShare turns per-user monthly counts into each user's percentage
+// of that month's total, one series per user over every month of the chat.
+func getMonthlyShare(monthlyCountsByUser UserStringIntMap, allMonths map[string]struct{}, allUsersList []string) []UserShareChartData {
+	if len(allMonths) == 0 || len(allUsersList) == 0 {
+		return []UserShareChartData{}
+	}
+
+	sortedMonths := maps.Keys(allMonths)
+	sort.Strings(sortedMonths)
+	sort.Strings(allUsersList)
 
-	// Weekdays: Monday (1) to Friday (5) in Go's time.Weekday
-	for day := 1; day <= 5; day++ {
-		totalWeekday += dailyMessageCountByWeekday[day]
+	monthTotals := make(map[string]int, len(sortedMonths))
+	for _, counts := range monthlyCountsByUser {
+		for month, count := range counts {
+			monthTotals[month] += count
+		}
 	}
-	// Weekends: Sunday (0) and Saturday (6)
-	totalWeekend += dailyMessageCountByWeekday[0] // Sunday
-	totalWeekend += dailyMessageCountByWeekday[6] // Saturday
 
-	avgWeekday := 0.0
-	if totalWeekday > 0 {
-		avgWeekday = roundFloat(float64(totalWeekday)/5.0, 2)
+	series := make([]UserShareChartData, 0, len(allUsersList))
+	for _, user := range allUsersList {
+		points := make([]SharePoint, 0, len(sortedMonths))
+		for _, month := range sortedMonths {
+			point := SharePoint{X: month}
+			if total := monthTotals[month]; total > 0 {
+				share := roundFloat(float64(monthlyCountsByUser[user][month])*100.0/float64(total), 2)
+				point.Y = &share
+			}
+			points = append(points, point)
+		}
+		series = append(series, UserShareChartData{ID: user, Data: points})
 	}
+	return series
+}
 
-	avgWeekend := 0.0
-	if totalWeekend > 0 {
-		avgWeekend = roundFloat(float64(totalWeekend)/2.0, 2)
+// calcWeekdayWeekendAvg averages messages per active day, counting only the
+// dates that had messages, so a short chat isn't measured against weekdays
+// or weekends it never spanned.
+func calcWeekdayWeekendAvg(dailyMessageCountByDate map[string]int) *WeekdayWeekendAverage {
+	messagesByWeekday := make(map[time.Weekday]int)
+	activeDaysByWeekday := make(map[time.Weekday]int)
+	for dateStr, count := range dailyMessageCountByDate {
+		date, err := time.Parse("2006-01-02", dateStr)
+		if err != nil || count == 0 {
+			continue
+		}
+		messagesByWeekday[date.Weekday()] += count
+		activeDaysByWeekday[date.Weekday()]++
 	}
 
+	totalWeekday, weekdays := 0, 0
+	totalWeekend, weekendDays := 0, 0
+	byWeekday := make([]WeekdayAverage, 0, 7)
+	// Monday first; Sunday is day 0 in Go's time.Weekday.
+	for i := 1; i <= 7; i++ {
+		day := time.Weekday(i % 7)
+		if day == time.Saturday || day == time.Sunday {
+			totalWeekend += messagesByWeekday[day]
+			weekendDays += activeDaysByWeekday[day]
+		} else {
+			totalWeekday += messagesByWeekday[day]
+			weekdays += activeDaysByWeekday[day]
+		}
+		byWeekday = append(byWeekday, WeekdayAverage{
+			Day:             day.String(),
+			Messages:        messagesByWeekday[day],
+			ActiveDays:      activeDaysByWeekday[day],
+			AverageMessages: averagePerDay(messagesByWeekday[day], activeDaysByWeekday[day]),
+		})
+	}
+
+	avgWeekday := averagePerDay(totalWeekday, weekdays)
+	avgWeekend := averagePerDay(totalWeekend, weekendDays)
+
 	diff := roundFloat(avgWeekday-avgWeekend, 2)
 	pctDiff := 0.0
 	if avgWeekday > 0 {
 		pctDiff = roundFloat((diff/avgWeekday)*100.0, 2)
 	}
 
-	return WeekdayWeekendAverage{
+	return &WeekdayWeekendAverage{
 		AverageWeekdayMessages: avgWeekday,
 		AverageWeekendMessages: avgWeekend,
 		Difference:             diff,
 		PercentageDifference:   pctDiff,
+		ActiveWeekdays:         weekdays,
+		ActiveWeekendDays:      weekendDays,
+		ByWeekday:              byWeekday,
 	}
 }
 
+func averagePerDay(messages, days int) float64 {
+	if days == 0 {
+		return 0
+	}
+	return roundFloat(float64(messages)/float64(days), 2)
+}
+
 func formatInteractionMatrix(interactionMatrix InteractionMatrix, allUsersList []string) [][]interface{} {
 	if len(allUsersList) <= 1 {
 		return nil
@@ -481,6 +950,181 @@ func formatInteractionMatrix(interactionMatrix InteractionMatrix, allUsersList [
 	return listOfListsMatrix
 }
 
+// formatInteractionMatrixPct has the same layout as formatInteractionMatrix,
+// but each row is the share (in percent) of that sender's messages that each
+// other member replied to, so quiet members' rows are as readable as busy ones.
+func formatInteractionMatrixPct(interactionMatrix InteractionMatrix, allUsersList []string) [][]interface{} {
+	matrix := formatInteractionMatrix(interactionMatrix, allUsersList)
+	if matrix == nil {
+		return nil
+	}
+	for _, row := range matrix[1:] {
+		rowTotal := 0
+		for _, cell := range row[1:] {
+			rowTotal += cell.(int)
+		}
+		for j := 1; j < len(row); j++ {
+			pct := 0.0
+			if rowTotal > 0 {
+				pct = roundFloat(float64(row[j].(int))/float64(rowTotal)*100, 2)
+			}
+			row[j] = pct
+		}
+	}
+	return matrix
+}
+
+const strongestPairsLimit = 3
+
+type InteractionPair struct {
+	Users        [2]string `json:"users"`
+	Interactions int       `json:"interactions"`
+	SharePct     float64   `json:"share_pct"`
+}
+
+// calculateStrongestPairs ranks pairs by replies in both directions combined
+// and returns the top ones with their share of all replies.
+func calculateStrongestPairs(interactionMatrix InteractionMatrix, allUsersList []string, limit int) []InteractionPair {
+	if len(allUsersList) <= 1 {
+		return nil
+	}
+	users := make([]string, len(allUsersList))
+	copy(users, allUsersList)
+	sort.Strings(users)
+
+	total := 0
+	for _, targets := range interactionMatrix {
+		for _, count := range targets {
+			total += count
+		}
+	}
+
+	pairs := []InteractionPair{}
+	for i, a := range users {
+		for _, b := range users[i+1:] {
+			count := interactionMatrix[a][b] + interactionMatrix[b][a]
+			if count == 0 {
+				continue
+			}
+			pairs = append(pairs, InteractionPair{
+				Users:        [2]string{a, b},
+				Interactions: count,
+				SharePct:     roundFloat(float64(count)/float64(total)*100, 2),
+			})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Interactions > pairs[j].Interactions })
+	if len(pairs) > limit {
+		pairs = pairs[:limit]
+	}
+	return pairs
+}
+
+// pairResponseTimes holds, for each message sender, the reply gaps of every
+// member who answered them.
+type pairResponseTimes map[string]map[string]*responseTally
+
+type responseTally struct {
+	totalSeconds float64
+	count        int
+}
+
+func (p pairResponseTimes) add(sender, replier string, seconds float64) {
+	if _, ok := p[sender]; !ok {
+		p[sender] = make(map[string]*responseTally)
+	}
+	tally, ok := p[sender][replier]
+	if !ok {
+		tally = &responseTally{}
+		p[sender][replier] = tally
+	}
+	tally.totalSeconds += seconds
+	tally.count++
+}
+
+// averageMinutes is how long replier takes on average to answer sender.
+func (p pairResponseTimes) averageMinutes(sender, replier string) (float64, int) {
+	tally, ok := p[sender][replier]
+	if !ok || tally.count == 0 {
+		return 0, 0
+	}
+	return roundFloat(tally.totalSeconds/float64(tally.count)/60.0, 2), tally.count
+}
+
+func formatResponseMatrix(responses pairResponseTimes, allUsersList []string) [][]interface{} {
+	matrix := formatInteractionMatrix(InteractionMatrix{}, allUsersList)
+	if matrix == nil {
+		return nil
+	}
+	header := matrix[0]
+	for _, row := range matrix[1:] {
+		for j := 1; j < len(row); j++ {
+			row[j] = nil
+			if minutes, count := responses.averageMinutes(row[0].(string), header[j].(string)); count > 0 {
+				row[j] = minutes
+			}
+		}
+	}
+	return matrix
+}
+
+const (
+	responseAsymmetriesLimit = 3
+	// A pair is only compared once each side has replied this often, and
+	// only reported when one side is at least responseAsymmetryMinRatio
+	// times slower.
+	responseAsymmetryMinSamples = 5
+	responseAsymmetryMinRatio   = 2.0
+)
+
+// ResponseAsymmetry is a pair where one member answers the other much faster
+// than they get answered: FastReplier answers SlowReplier in
+// FastReplyMinutes, while SlowReplier takes SlowReplyMinutes to answer back.
+type ResponseAsymmetry struct {
+	FastReplier      string  `json:"fast_replier"`
+	SlowReplier      string  `json:"slow_replier"`
+	FastReplyMinutes float64 `json:"fast_reply_minutes"`
+	SlowReplyMinutes float64 `json:"slow_reply_minutes"`
+	Ratio            float64 `json:"ratio"`
+}
+
+// calculateResponseAsymmetries returns the most lopsided pairs, largest
+// ratio first.
+func calculateResponseAsymmetries(responses pairResponseTimes, limit int) []ResponseAsymmetry {
+	users := maps.Keys(responses)
+	sort.Strings(users)
+
+	asymmetries := []ResponseAsymmetry{}
+	for i, a := range users {
+		for _, b := range users[i+1:] {
+			aToB, aCount := responses.averageMinutes(b, a)
+			bToA, bCount := responses.averageMinutes(a, b)
+			if aCount < responseAsymmetryMinSamples || bCount < responseAsymmetryMinSamples {
+				continue
+			}
+			fast, slow, fastMinutes, slowMinutes := a, b, aToB, bToA
+			if bToA < aToB {
+				fast, slow, fastMinutes, slowMinutes = b, a, bToA, aToB
+			}
+			if fastMinutes <= 0 || slowMinutes/fastMinutes < responseAsymmetryMinRatio {
+				continue
+			}
+			asymmetries = append(asymmetries, ResponseAsymmetry{
+				FastReplier:      fast,
+				SlowReplier:      slow,
+				FastReplyMinutes: fastMinutes,
+				SlowReplyMinutes: slowMinutes,
+				Ratio:            roundFloat(slowMinutes/fastMinutes, 2),
+			})
+		}
+	}
+	sort.SliceStable(asymmetries, func(i, j int) bool { return asymmetries[i].Ratio > asymmetries[j].Ratio })
+	if len(asymmetries) > limit {
+		asymmetries = asymmetries[:limit]
+	}
+	return asymmetries
+}
+
 func roundFloat(val float64, precision uint) float64 {
 	ratio := math.Pow(10, float64(precision))
 	return math.Round(val*ratio) / ratio
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	// Uneven steps, so using the wrong neighbour in the interpolation changes
+	// the result.
+	data := []float64{1, 3, 4, 8, 10, 15, 20, 30, 45, 60}
+
+	tests := []struct {
+		name string
+		data []float64
+		p    float64
+		want float64
+	}{
+		{"p25 interpolates", data, 25, 3.75},
+		{"p50 interpolates", data, 50, 12.5},
+		{"p75 interpolates", data, 75, 33.75},
+		{"p95 past the last rank clamps", data, 95, 60},
+		{"p5 before the first rank clamps", data, 5, 1},
+		{"p0 is the smallest", data, 0, 1},
+		{"p100 is the largest", data, 100, 60},
+		{"below 0 clamps", data, -10, 1},
+		{"above 100 clamps", data, 150, 60},
+		{"single value p0", []float64{7}, 0, 7},
+		{"single value p50", []float64{7}, 50, 7},
+		{"single value p100", []float64{7}, 100, 7},
+		{"empty", nil, 50, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Percentile(tt.data, tt.p); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Percentile(%v, %v) = %v, want %v", tt.data, tt.p, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"bloop-go-server/pkg/parser"
+)
+
+type StyleVector struct {
+	MessageLength float64 `json:"message_length"`
+	Emoji         float64 `json:"emoji"`
+	Punctuation   float64 `json:"punctuation"`
+	Caps          float64 `json:"caps"`
+	ResponseSpeed float64 `json:"response_speed"`
+}
+
+type StyleFingerprint struct {
+	AvgMessageLength   float64     `json:"avg_message_length"`
+	EmojiRatio         float64     `json:"emoji_ratio"`
+	PunctuationRatio   float64     `json:"punctuation_ratio"`
+	CapsRatio          float64     `json:"caps_ratio"`
+	AvgResponseMinutes float64     `json:"avg_response_minutes"`
+	Normalized         StyleVector `json:"normalized"`
+}
+
+type styleAccumulator struct {
+	messages     int
+	chars        int
+	emojis       int
+	words        int
+	punctuation  int
+	nonSpace     int
+	upper        int
+	letters      int
+	responseSecs float64
+	responses    int
+}
+
+// calculateStyleFingerprints measures how each user writes from the original
+// message text. Normalized values are scaled to 0..1 against the most extreme
+// user for each trait so they can be drawn on a shared radar chart; for
+// response speed the fastest responder scores 1.
+func calculateStyleFingerprints(messagesData []ParsedMessage, convoBreak time.Duration) map[string]StyleFingerprint {
+	accumulators := make(map[string]*styleAccumulator)
+
+	for i, msg := range messagesData {
+		acc, ok := accumulators[msg.Sender]
+		if !ok {
+			acc = &styleAccumulator{}
+			accumulators[msg.Sender] = acc
+		}
+
+		text := msg.OriginalMessage
+		acc.messages++
+		acc.chars += len([]rune(text))
+		acc.emojis += countEmojiRunes(text)
+		acc.words += len(strings.Fields(removeEmojis(text)))
+
+		for _, r := range text {
+			if unicode.IsSpace(r) {
+				continue
+			}
+			acc.nonSpace++
+			if unicode.IsPunct(r) {
+				acc.punctuation++
+			}
+			if unicode.IsLetter(r) {
+				acc.letters++
+				if unicode.IsUpper(r) {
+					acc.upper++
+				}
+			}
+		}
+
+		if i > 0 {
+			prev := messagesData[i-1]
+			diff := msg.Timestamp.Sub(prev.Timestamp)
+			if prev.Sender != msg.Sender && diff <= convoBreak && diff.Seconds() > 5 && diff.Seconds() < 12*3600 {
+				acc.responseSecs += diff.Seconds()
+				acc.responses++
+			}
+		}
+	}
+
+	fingerprints := make(map[string]StyleFingerprint, len(accumulators))
+	for user, acc := range accumulators {
+		fp := StyleFingerprint{}
+		if acc.messages > 0 {
+			fp.AvgMessageLength = roundFloat(float64(acc.chars)/float64(acc.messages), 2)
+		}
+		if acc.words > 0 {
+			fp.EmojiRatio = roundFloat(float64(acc.emojis)/float64(acc.words), 3)
+		} else {
+			fp.EmojiRatio = float64(acc.emojis)
+		}
+		if acc.nonSpace > 0 {
+			fp.PunctuationRatio = roundFloat(float64(acc.punctuation)/float64(acc.nonSpace), 3)
+		}
+		if acc.letters > 0 {
+			fp.CapsRatio = roundFloat(float64(acc.upper)/float64(acc.letters), 3)
+		}
+		if acc.responses > 0 {
+			fp.AvgResponseMinutes = roundFloat(acc.responseSecs/float64(acc.responses)/60.0, 2)
+		}
+		fingerprints[user] = fp
+	}
+
+	normalizeStyleFingerprints(fingerprints)
+	return fingerprints
+}
+
+func normalizeStyleFingerprints(fingerprints map[string]StyleFingerprint) {
+	var maxLength, maxEmoji, maxPunct, maxCaps, minResponse float64
+	for _, fp := range fingerprints {
+		maxLength = max(maxLength, fp.AvgMessageLength)
+		maxEmoji = max(maxEmoji, fp.EmojiRatio)
+		maxPunct = max(maxPunct, fp.PunctuationRatio)
+		maxCaps = max(maxCaps, fp.CapsRatio)
+		if fp.AvgResponseMinutes > 0 && (minResponse == 0 || fp.AvgResponseMinutes < minResponse) {
+			minResponse = fp.AvgResponseMinutes
+		}
+	}
+
+	for user, fp := range fingerprints {
+		fp.Normalized = StyleVector{
+			MessageLength: safeRatio(fp.AvgMessageLength, maxLength),
+			Emoji:         safeRatio(fp.EmojiRatio, maxEmoji),
+			Punctuation:   safeRatio(fp.PunctuationRatio, maxPunct),
+			Caps:          safeRatio(fp.CapsRatio, maxCaps),
+		}
+		if fp.AvgResponseMinutes > 0 {
+			fp.Normalized.ResponseSpeed = safeRatio(minResponse, fp.AvgResponseMinutes)
+		}
+		fingerprints[user] = fp
+	}
+}
+
+// describeStyleTraits renders fingerprints as short plain-text lines for the
+// AI prompt, so people descriptions can lean on measured behaviour.
+func describeStyleTraits(fingerprints map[string]StyleFingerprint) string {
+	users := make([]string, 0, len(fingerprints))
+	for user := range fingerprints {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	lines := make([]string, 0, len(users))
+	for _, user := range users {
+		fp := fingerprints[user]
+		line := fmt.Sprintf("- %s: ~%.0f characters per message, %.2f emojis per word, %.0f%% capital letters, %.0f%% punctuation",
+			user, fp.AvgMessageLength, fp.EmojiRatio, fp.CapsRatio*100, fp.PunctuationRatio*100)
+		if fp.AvgResponseMinutes > 0 {
+			line += fmt.Sprintf(", replies in ~%.1f min", fp.AvgResponseMinutes)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func countEmojiRunes(text string) int {
+	count := 0
+	for _, match := range emojiPattern.FindAllString(text, -1) {
+		for _, r := range match {
+			if r < 0xFE00 || r > 0xFE0F {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func safeRatio(value, limit float64) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return roundFloat(value/limit, 3)
+}
+
+type MessageLengthStats struct {
+	AvgWords        float64 `json:"avg_words"`
+	AvgCharacters   float64 `json:"avg_characters"`
+	UniqueWordRatio float64 `json:"unique_word_ratio"`
+}
+
+type AverageChampion struct {
+	User  string  `json:"user"`
+	Value float64 `json:"value"`
+}
+
+// calculateMessageLengthStats returns average words and characters per message
+// and the type/token ratio of each user's vocabulary, along with the users who
+// write the longest ("essay writer") and shortest ("k lol") messages on average.
+func calculateMessageLengthStats(messagesData []ParsedMessage) (map[string]MessageLengthStats, *AverageChampion, *AverageChampion) {
+	type accumulator struct {
+		messages    int
+		words       int
+		chars       int
+		uniqueWords map[string]struct{}
+	}
+	accumulators := make(map[string]*accumulator)
+
+	for _, msg := range messagesData {
+		acc, ok := accumulators[msg.Sender]
+		if !ok {
+			acc = &accumulator{uniqueWords: make(map[string]struct{})}
+			accumulators[msg.Sender] = acc
+		}
+		acc.messages++
+		acc.chars += len([]rune(msg.OriginalMessage))
+		for _, word := range strings.Fields(removeEmojis(msg.OriginalMessage)) {
+			normalized := parser.NormalizeWord(word)
+			if normalized == "" {
+				continue
+			}
+			acc.words++
+			acc.uniqueWords[normalized] = struct{}{}
+		}
+	}
+
+	users := make([]string, 0, len(accumulators))
+	for user := range accumulators {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	lengths := make(map[string]MessageLengthStats, len(accumulators))
+	var essayWriter, shortestTexter *AverageChampion
+	for _, user := range users {
+		acc := accumulators[user]
+		stats := MessageLengthStats{
+			AvgWords:      roundFloat(float64(acc.words)/float64(acc.messages), 2),
+			AvgCharacters: roundFloat(float64(acc.chars)/float64(acc.messages), 2),
+		}
+		if acc.words > 0 {
+			stats.UniqueWordRatio = roundFloat(float64(len(acc.uniqueWords))/float64(acc.words), 3)
+		}
+		lengths[user] = stats
+
+		if essayWriter == nil || stats.AvgWords > essayWriter.Value {
+			essayWriter = &AverageChampion{User: user, Value: stats.AvgWords}
+		}
+		if shortestTexter == nil || stats.AvgWords < shortestTexter.Value {
+			shortestTexter = &AverageChampion{User: user, Value: stats.AvgWords}
+		}
+	}
+
+	if len(users) < 2 {
+		return lengths, nil, nil
+	}
+	return lengths, essayWriter, shortestTexter
+}
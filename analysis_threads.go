@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// firstReplyMinAnswered keeps members with only a couple of answered
+// conversations out of the longest wait pick.
+const firstReplyMinAnswered = 3
+
+// StarterReplyStats is how the conversations a member started got answered.
+// A conversation is answered when someone else writes before the next
+// conversation break; the minutes run from the starting message to that
+// first reply.
+type StarterReplyStats struct {
+	Started        int     `json:"started"`
+	Unanswered     int     `json:"unanswered"`
+	UnansweredPct  float64 `json:"unanswered_pct"`
+	MedianMinutes  float64 `json:"median_minutes,omitempty"`
+	AverageMinutes float64 `json:"average_minutes,omitempty"`
+}
+
+// FirstReplyTimes covers every conversation, split at the conversation break
+// like the starter stats. LongestWait has the highest median wait among
+// members with at least three answered conversations.
+type FirstReplyTimes struct {
+	Users         map[string]StarterReplyStats `json:"users"`
+	MedianMinutes float64                      `json:"median_minutes"`
+	LongestWait   *AverageChampion             `json:"longest_wait,omitempty"`
+}
+
+func calculateFirstReplyTimes(messagesData []ParsedMessage, convoBreak time.Duration) *FirstReplyTimes {
+	started := make(map[string]int)
+	unanswered := make(map[string]int)
+	waits := make(map[string][]float64)
+	var allWaits []float64
+
+	for i := 0; i < len(messagesData); {
+		start := messagesData[i]
+		started[start.Sender]++
+		answered := false
+		j := i + 1
+		for ; j < len(messagesData) && messagesData[j].Timestamp.Sub(messagesData[j-1].Timestamp) <= convoBreak; j++ {
+			if answered || messagesData[j].Sender == start.Sender {
+				continue
+			}
+			answered = true
+			minutes := messagesData[j].Timestamp.Sub(start.Timestamp).Minutes()
+			waits[start.Sender] = append(waits[start.Sender], minutes)
+			allWaits = append(allWaits, minutes)
+		}
+		if !answered {
+			unanswered[start.Sender]++
+		}
+		i = j
+	}
+	if len(allWaits) == 0 {
+		return nil
+	}
+
+	sort.Float64s(allWaits)
+	replies := &FirstReplyTimes{
+		Users:         make(map[string]StarterReplyStats, len(started)),
+		MedianMinutes: roundFloat(Percentile(allWaits, 50), 2),
+	}
+	for user, count := range started {
+		stats := StarterReplyStats{
+			Started:       count,
+			Unanswered:    unanswered[user],
+			UnansweredPct: roundFloat(float64(unanswered[user])*100/float64(count), 2),
+		}
+		if minutes := waits[user]; len(minutes) > 0 {
+			sort.Float64s(minutes)
+			total := 0.0
+			for _, m := range minutes {
+				total += m
+			}
+			stats.MedianMinutes = roundFloat(Percentile(minutes, 50), 2)
+			stats.AverageMinutes = roundFloat(total/float64(len(minutes)), 2)
+			if len(minutes) >= firstReplyMinAnswered {
+				replies.LongestWait = higherAverage(replies.LongestWait, user, stats.MedianMinutes)
+			}
+		}
+		replies.Users[user] = stats
+	}
+	return replies
+}
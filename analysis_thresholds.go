@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const statThresholdsFile = "stat_thresholds.json"
+
+// statThresholds maps a ChatStatistics JSON field to the minimum number of
+// parsed messages needed before that stat is meaningful.
+var statThresholds map[string]int
+
+// statOmitters clear a stat so it is dropped from the JSON output. Only stats
+// listed here can be given a threshold.
+var statOmitters = map[string]func(*ChatStatistics){
+	"conversation_starters_pct":     func(s *ChatStatistics) { s.ConversationStartersPct = nil },
+	"conversation_starters_monthly": func(s *ChatStatistics) { s.ConversationStartersMonthly = nil },
+	"conversation_enders_pct":       func(s *ChatStatistics) { s.ConversationEndersPct = nil },
+	"conversation_killers_pct":      func(s *ChatStatistics) { s.ConversationKillersPct = nil; s.ConversationKiller = nil },
+	"most_ignored_users_pct":        func(s *ChatStatistics) { s.MostIgnoredUsersPct = nil },
+	"first_text_champion":           func(s *ChatStatistics) { s.FirstTextChampion = nil },
+	"longest_monologue":             func(s *ChatStatistics) { s.LongestMonologue = nil },
+	"average_response_time_minutes": func(s *ChatStatistics) { s.AverageResponseTimeMinutes = nil },
+	"response_time_percentiles":     func(s *ChatStatistics) { s.ResponseTimePercentiles = nil },
+	"conversation_gap_percentiles":  func(s *ChatStatistics) { s.ConversationGapPercentiles = nil },
+	"peak_hour":                     func(s *ChatStatistics) { s.PeakHour = nil },
+	"weekday_vs_weekend_avg":        func(s *ChatStatistics) { s.WeekdayVsWeekendAvg = nil },
+	"texting_similarity":            func(s *ChatStatistics) { s.TextingSimilarity = nil },
+	"topics":                        func(s *ChatStatistics) { s.Topics = nil },
+	"inside_jokes":                  func(s *ChatStatistics) { s.InsideJokes = nil },
+	"essay_writer":                  func(s *ChatStatistics) { s.EssayWriter = nil },
+	"shortest_texter":               func(s *ChatStatistics) { s.ShortestTexter = nil },
+	"loudest_member":                func(s *ChatStatistics) { s.LoudestMember = nil },
+	"biggest_laugher":               func(s *ChatStatistics) { s.BiggestLaugher = nil },
+	"most_laughed_at":               func(s *ChatStatistics) { s.MostLaughedAt = nil },
+	"biggest_deleter":               func(s *ChatStatistics) { s.BiggestDeleter = nil },
+	"roles":                         func(s *ChatStatistics) { s.Roles = nil },
+	"chat_health":                   func(s *ChatStatistics) { s.ChatHealth = nil },
+	"seasonality":                   func(s *ChatStatistics) { s.Seasonality = nil },
+	"monthly_volume":                func(s *ChatStatistics) { s.MonthlyVolume = nil },
+	"chat_energy":                   func(s *ChatStatistics) { s.ChatEnergy = nil },
+	"conversation_spark":            func(s *ChatStatistics) { s.UserResponseChains = nil; s.ConversationSpark = nil },
+	"user_response_matrix":          func(s *ChatStatistics) { s.UserResponseMatrix = nil; s.ResponseAsymmetries = nil },
+	"first_text_responses":          func(s *ChatStatistics) { s.FirstTextResponses = nil },
+	"date_spikes":                   func(s *ChatStatistics) { s.DateSpikes = nil },
+	"chat_changes":                  func(s *ChatStatistics) { s.ChatChanges = nil },
+	"profanity":                     func(s *ChatStatistics) { s.Profanity = nil },
+	"politeness":                    func(s *ChatStatistics) { s.Politeness = nil },
+	"affection_index":               func(s *ChatStatistics) { s.AffectionIndex = nil },
+	"media_attachments":             func(s *ChatStatistics) { s.MediaAttachments = nil },
+	"longest_messages":              func(s *ChatStatistics) { s.LongestMessages = nil },
+	"idle_members":                  func(s *ChatStatistics) { s.IdleMembers = nil },
+	"participation_balance":         func(s *ChatStatistics) { s.ParticipationBalance = nil },
+	"first_reply_times":             func(s *ChatStatistics) { s.FirstReplyTimes = nil },
+}
+
+func init() {
+	loadThresholdData()
+}
+
+func loadThresholdData() {
+	var err error
+	statThresholds, err = loadStatThresholds(filepath.Join(dataDir, statThresholdsFile))
+	if err != nil {
+		log.Printf("Warning: Failed to load stat thresholds: %v. All stats will be reported regardless of chat size.", err)
+		statThresholds = map[string]int{}
+	}
+}
+
+func loadStatThresholds(filepath string) (map[string]int, error) {
+	file, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read stat thresholds file '%s': %w", filepath, err)
+	}
+
+	var thresholds map[string]int
+	if err := json.Unmarshal(file, &thresholds); err != nil {
+		return nil, fmt.Errorf("could not decode JSON from '%s': %w", filepath, err)
+	}
+
+	for name, minMessages := range thresholds {
+		if _, ok := statOmitters[name]; !ok {
+			log.Printf("Warning: Ignoring threshold for unknown stat '%s' in %s", name, filepath)
+			delete(thresholds, name)
+		} else if minMessages < 0 {
+			log.Printf("Warning: Ignoring negative threshold for stat '%s' in %s", name, filepath)
+			delete(thresholds, name)
+		}
+	}
+	log.Printf("Loaded %d stat thresholds from %s", len(thresholds), filepath)
+	return thresholds, nil
+}
+
+// applyStatThresholds drops stats that would be noise for a chat this small
+// and returns a note for each one explaining why it is missing.
+func applyStatThresholds(stats *ChatStatistics, messageCount int) map[string]string {
+	names := make([]string, 0, len(statThresholds))
+	for name := range statThresholds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var omitted map[string]string
+	for _, name := range names {
+		minMessages := statThresholds[name]
+		if messageCount >= minMessages {
+			continue
+		}
+		statOmitters[name](stats)
+		if omitted == nil {
+			omitted = make(map[string]string)
+		}
+		omitted[name] = fmt.Sprintf("Needs at least %d messages to be meaningful; this chat has %d.", minMessages, messageCount)
+	}
+	return omitted
+}
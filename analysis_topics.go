@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	topicKeywordsPerConversation = 5
+	topicMaxConversations        = 20
+	topicMinMessages             = 5
+	topicThemeCount              = 10
+)
+
+type ConversationTopic struct {
+	Start        string   `json:"start"`
+	End          string   `json:"end"`
+	MessageCount int      `json:"message_count"`
+	Keywords     []string `json:"keywords"`
+}
+
+type TopicSummary struct {
+	Conversations []ConversationTopic `json:"conversations"`
+	Themes        []string            `json:"themes"`
+}
+
+// extractTopics runs TF-IDF over the conversations produced by
+// groupMessagesByTopic, treating each conversation as a document. It gives
+// deployments without an AI key a "topics discussed" section: keywords for the
+// largest conversations plus overall themes that recur across conversations.
+func extractTopics(messagesData []ParsedMessage, gapHours float64) *TopicSummary {
+	var conversations []Topic
+	for _, topic := range groupMessagesByTopic(messagesData, gapHours) {
+		if len(topic) >= topicMinMessages {
+			conversations = append(conversations, topic)
+		}
+	}
+	if len(conversations) == 0 {
+		return nil
+	}
+
+	termCounts := make([]map[string]int, len(conversations))
+	docFrequency := make(map[string]int)
+	for i, convo := range conversations {
+		counts := make(map[string]int)
+		for _, msg := range convo {
+			for _, term := range strings.Fields(msg.CleanedMessage) {
+				if isTopicTerm(term) {
+					counts[term]++
+				}
+			}
+		}
+		for term := range counts {
+			docFrequency[term]++
+		}
+		termCounts[i] = counts
+	}
+
+	docCount := float64(len(conversations))
+	themeScores := make(map[string]float64)
+	scored := make([]map[string]float64, len(conversations))
+	for i, counts := range termCounts {
+		total := 0
+		for _, c := range counts {
+			total += c
+		}
+		scores := make(map[string]float64, len(counts))
+		for term, c := range counts {
+			idf := math.Log((1+docCount)/(1+float64(docFrequency[term]))) + 1
+			score := float64(c) / float64(total) * idf
+			scores[term] = score
+			if docFrequency[term] >= 2 {
+				themeScores[term] += score
+			}
+		}
+		scored[i] = scores
+	}
+
+	order := make([]int, len(conversations))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return len(conversations[order[a]]) > len(conversations[order[b]])
+	})
+	if len(order) > topicMaxConversations {
+		order = order[:topicMaxConversations]
+	}
+	sort.Ints(order)
+
+	summary := &TopicSummary{
+		Conversations: make([]ConversationTopic, 0, len(order)),
+		Themes:        topScoredTerms(themeScores, topicThemeCount),
+	}
+	for _, idx := range order {
+		convo := conversations[idx]
+		summary.Conversations = append(summary.Conversations, ConversationTopic{
+			Start:        convo[0].Timestamp.Format("2006-01-02 15:04"),
+			End:          convo[len(convo)-1].Timestamp.Format("2006-01-02 15:04"),
+			MessageCount: len(convo),
+			Keywords:     topScoredTerms(scored[idx], topicKeywordsPerConversation),
+		})
+	}
+	return summary
+}
+
+func isTopicTerm(term string) bool {
+	hasLetter := false
+	for _, r := range term {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+			break
+		}
+	}
+	return hasLetter && len([]rune(term)) > 2
+}
+
+func topScoredTerms(scores map[string]float64, n int) []string {
+	terms := make([]string, 0, len(scores))
+	for term := range scores {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if scores[terms[i]] != scores[terms[j]] {
+			return scores[terms[i]] > scores[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > n {
+		terms = terms[:n]
+	}
+	return terms
+}
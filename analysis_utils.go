@@ -2,9 +2,7 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -17,25 +15,26 @@ import (
 	"time"
 	"unicode"
 
+	"bloop-go-server/pkg/parser"
 	"golang.org/x/exp/maps"
 )
 
-type ParsedMessage struct {
-	Timestamp       time.Time
-	DateStr         string
-	Sender          string
-	CleanedMessage  string
-	OriginalMessage string
+type ParsedMessage = parser.Message
+
+type preprocessResult struct {
+	rawMessageCount int
+	messages        []ParsedMessage
+	markers         parser.Markers
+	groupEvents     []parser.GroupEvent
+	diagnostics     ParseDiagnostics
+	warnings        warningList
 }
 
 var (
 	stopwordsSet          map[string]struct{}
 	systemMessagePatterns []string
-	timestampPattern      *regexp.Regexp
-	urlPattern            *regexp.Regexp
 	emojiPattern          *regexp.Regexp
 	excessiveCharsPattern *regexp.Regexp
-	timestampParseLayouts []string
 )
 
 const (
@@ -43,22 +42,9 @@ const (
 	stopwordsFile           = "stopwords.txt"
 	systemMessagesFile      = "system_message_patterns.json"
 	allowedPunctuationRegex = `.,?!'"()`
-	maxLinesToSniff         = 100
 )
 
 func init() {
-	timestampPattern = regexp.MustCompile(
-		`(?i)^\s*(?:\x{200e})?` + // Optional LRM at start, optional space
-			`\[?` + // Optional opening bracket
-			`(\d{1,2}/\d{1,2}/\d{2,4})` + // Date (Group 1)
-			`,\s*` + // Comma and space separator
-			`(\d{1,2}:\d{2}(?::\d{2})?(?:[\s\x{202f}](?:AM|PM))?)` + // Time (Group 2) - handles space or \u202f, optional secs
-			`(?:\]?\s*-\s*|\]\s*)` + // Separator (non-capturing)
-			`(.*?):\s*` + // Sender (Group 3) - Non-greedy match for sender name
-			`(.*)`) // Message (Group 4) - Rest of the line
-
-	urlPattern = regexp.MustCompile(`https?://\S+|www\.\S+`)
-
 	emojiPattern = regexp.MustCompile("[" +
 		"\U0001F300-\U0001F5FF" + // symbols & pictographs
 		"\U0001F600-\U0001F64F" + // emoticons
@@ -73,6 +59,13 @@ func init() {
 	escapedPunctuation := regexp.QuoteMeta(allowedPunctuationRegex)
 	excessiveCharsPattern = regexp.MustCompile(`[^a-zA-Z0-9\s` + escapedPunctuation + `]`)
 
+	loadTextData()
+
+}
+
+// loadTextData reads the stopword list and the system message patterns used
+// while parsing.
+func loadTextData() {
 	var err error
 	stopwordsSet, err = loadStopwords(filepath.Join(dataDir, stopwordsFile))
 	if err != nil {
@@ -85,37 +78,6 @@ func init() {
 		log.Printf("Warning: Failed to load system message patterns: %v", err)
 		systemMessagePatterns = []string{}
 	}
-
-	timestampParseLayouts = []string{
-		// US style with AM/PM
-		"1/2/06 3:04 PM",        // m/d/yy h:mm AM/PM
-		"1/2/2006 3:04 PM",      // m/d/yyyy h:mm AM/PM
-		"1/2/06 3:04:05 PM",     // m/d/yy h:mm:ss AM/PM
-		"1/2/2006 3:04:05 PM",   // m/d/yyyy h:mm:ss AM/PM
-		"01/02/06 3:04 PM",      // mm/dd/yy h:mm AM/PM
-		"01/02/2006 3:04 PM",    // mm/dd/yyyy h:mm AM/PM
-		"01/02/06 3:04:05 PM",   // mm/dd/yy h:mm:ss AM/PM
-		"01/02/2006 3:04:05 PM", // mm/dd/yyyy h:mm:ss AM/PM
-
-		// European style 24-hour
-		"2/1/06 15:04",        // d/m/yy HH:mm
-		"2/1/2006 15:04",      // d/m/yyyy HH:mm
-		"2/1/06 15:04:05",     // d/m/yy HH:mm:ss
-		"2/1/2006 15:04:05",   // d/m/yyyy HH:mm:ss
-		"02/01/06 15:04",      // dd/mm/yy HH:mm
-		"02/01/2006 15:04",    // dd/mm/yyyy HH:mm
-		"02/01/06 15:04:05",   // dd/mm/yy HH:mm:ss
-		"02/01/2006 15:04:05", // dd/mm/yyyy HH:mm:ss
-
-		"2/1/06 3:04 PM",        // d/m/yy h:mm AM/PM
-		"2/1/2006 3:04 PM",      // d/m/yyyy h:mm AM/PM
-		"2/1/06 3:04:05 PM",     // d/m/yy h:mm:ss AM/PM
-		"2/1/2006 3:04:05 PM",   // d/m/yyyy h:mm:ss AM/PM
-		"02/01/06 3:04 PM",      // dd/mm/yy h:mm AM/PM
-		"02/01/2006 3:04 PM",    // dd/mm/yyyy h:mm AM/PM
-		"02/01/06 3:04:05 PM",   // dd/mm/yy h:mm:ss AM/PM
-		"02/01/2006 3:04:05 PM", // dd/mm/yyyy h:mm:ss AM/PM
-	}
 }
 
 func loadStopwords(filepath string) (map[string]struct{}, error) {
@@ -161,261 +123,87 @@ func loadSystemMessagePatterns(filepath string) ([]string, error) {
 	return lowerCasePatterns, nil
 }
 
-func sniffTimestampLayouts(reader io.Reader, allLayouts []string, maxLines int) ([]string, error) {
-	scanner := bufio.NewScanner(reader)
-	var sampleLines []string
-	linesRead := 0
-
-	for (maxLines <= 0 || linesRead < maxLines) && scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
-		trimmedLine = strings.TrimPrefix(trimmedLine, "\u200e")
-
-		if timestampPattern != nil && timestampPattern.MatchString(trimmedLine) {
-			sampleLines = append(sampleLines, trimmedLine)
-		}
-		linesRead++
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading lines for sniffing: %w", err)
+// loadLanguagePhrases reads a JSON object of language code to phrase list, as
+// used by the word lists under data/, and returns every phrase lowercased.
+func loadLanguagePhrases(filepath string) ([]string, error) {
+	file, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read phrases file '%s': %w", filepath, err)
 	}
 
-	if len(sampleLines) == 0 {
-		// log.Printf("Warning: No lines matched the general timestamp pattern during sniffing in the first %d lines. Cannot determine specific layout.", maxLines)
-		return nil, fmt.Errorf("no valid timestamp lines found in the first %d lines to sniff format from", maxLines)
+	var byLanguage map[string][]string
+	if err := json.Unmarshal(file, &byLanguage); err != nil {
+		return nil, fmt.Errorf("could not decode JSON from '%s': %w", filepath, err)
 	}
 
-	candidateLayouts := make([]string, len(allLayouts))
-	copy(candidateLayouts, allLayouts)
-
-	actualTimestampsProcessed := 0
-
-	for _, line := range sampleLines {
-		if len(candidateLayouts) == 0 {
-			break
-		}
-
-		match := timestampPattern.FindStringSubmatch(line)
-		if match == nil || len(match) != 5 {
-			continue
-		}
-		actualTimestampsProcessed++
-
-		dateStr := strings.TrimSpace(match[1])
-		timeStr := strings.TrimSpace(match[2])
-		timeCleaned := strings.ToUpper(strings.ReplaceAll(timeStr, "\u202f", " "))
-		datetimeStr := dateStr + " " + timeCleaned
-
-		currentlyValidLayouts := []string{}
-		for _, layout := range candidateLayouts {
-			_, err := time.Parse(layout, datetimeStr)
-			if err == nil {
-				currentlyValidLayouts = append(currentlyValidLayouts, layout)
+	seen := make(map[string]struct{})
+	var phrases []string
+	for _, list := range byLanguage {
+		for _, phrase := range list {
+			phrase = strings.ToLower(strings.TrimSpace(phrase))
+			if phrase == "" {
+				continue
 			}
-		}
-		candidateLayouts = currentlyValidLayouts
-	}
-
-	if actualTimestampsProcessed == 0 {
-		log.Println("Warning: No actual timestamps were successfully parsed from the sampled lines.")
-		return nil, fmt.Errorf("no timestamp lines could be parsed with any layout from the sample")
-	}
-
-	if len(candidateLayouts) == 0 {
-		// log.Printf("Sniffing failed: No layout consistently parsed %d sampled timestamp lines.", actualTimestampsProcessed)
-		return nil, fmt.Errorf("no timestamp layout consistently parsed the sample data")
-	}
-
-	if len(candidateLayouts) > 1 {
-		// log.Printf("Multiple layouts (%d) are consistent with sniffed data: %v. Applying prioritization.", len(candidateLayouts), candidateLayouts)
-
-		var europeanStyleLayouts []string
-		var usStyleLayouts []string
-
-		for _, layout := range candidateLayouts {
-			if strings.Contains(layout, "2/1/") || strings.Contains(layout, "02/01/") {
-				europeanStyleLayouts = append(europeanStyleLayouts, layout)
-			} else if strings.Contains(layout, "1/2/") || strings.Contains(layout, "01/02/") {
-				usStyleLayouts = append(usStyleLayouts, layout)
+			if _, dup := seen[phrase]; dup {
+				continue
 			}
+			seen[phrase] = struct{}{}
+			phrases = append(phrases, phrase)
 		}
-
-		if len(europeanStyleLayouts) > 0 {
-			// log.Printf("Prioritizing European-style (d/m or dd/mm) layouts as they are among consistent options: %v", europeanStyleLayouts)
-			return europeanStyleLayouts, nil
-		}
-		if len(usStyleLayouts) > 0 {
-			// log.Printf("Using US-style (m/d or mm/dd) layouts as they are the only consistent options: %v", usStyleLayouts)
-			return usStyleLayouts, nil
-		}
-
-		// log.Printf("Could not strongly prioritize among consistent layouts. Using all: %v", candidateLayouts)
-		return candidateLayouts, nil
 	}
-
-	log.Printf("Determined single consistent timestamp layout(s): %v", candidateLayouts)
-	return candidateLayouts, nil
+	sort.Strings(phrases)
+	log.Printf("Loaded %d phrases in %d languages from %s", len(phrases), len(byLanguage), filepath)
+	return phrases, nil
 }
 
-func preprocessMessages(reader io.Reader) (int, []ParsedMessage, error) {
-	buf, err := io.ReadAll(reader)
+// preprocessMessages parses an export with the stopwords, system message
+// patterns and laughter tokens currently loaded. Callers hold dataMu for
+// reading.
+func preprocessMessages(reader io.Reader, maxLineBytes int) (*preprocessResult, error) {
+	parsed, err := parser.Parse(reader, parser.Options{
+		MaxLineBytes:   maxLineBytes,
+		Stopwords:      stopwordsSet,
+		SystemPatterns: systemMessagePatterns,
+		IsLaughter:     isLaughter,
+	})
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to read input for buffering: %w", err)
-	}
-
-	sniffReader := bytes.NewReader(buf)
-	currentTimestampParseLayouts, err := sniffTimestampLayouts(sniffReader, timestampParseLayouts, maxLinesToSniff)
-
-	if err != nil || len(currentTimestampParseLayouts) == 0 {
-		log.Printf("Warning: Timestamp sniffing failed (%v) or returned no layouts. Falling back to all %d global layouts.", err, len(timestampParseLayouts))
-		currentTimestampParseLayouts = timestampParseLayouts
-		if len(currentTimestampParseLayouts) == 0 {
-			return 0, nil, errors.New("no timestamp layouts available even in global list")
-		}
-	} else {
-		log.Printf("Using determined timestamp layouts for parsing: %v", currentTimestampParseLayouts)
-	}
-
-	messagesData := []ParsedMessage{}
-	mainScanner := bufio.NewScanner(bytes.NewReader(buf))
-	lineNumber := 0
-	rawMessageCount := 0
-
-	for mainScanner.Scan() {
-		lineNumber++
-		line := mainScanner.Text()
-		line = strings.TrimSpace(line)
-
-		if line == "" {
-			continue
-		}
-		rawMessageCount++
-
-		line = strings.TrimPrefix(line, "\u200e")
-
-		if timestampPattern == nil {
-			return rawMessageCount, nil, fmt.Errorf("timestampPattern regex is not initialized")
-		}
-		match := timestampPattern.FindStringSubmatch(line)
-		if match == nil || len(match) != 5 {
-			continue
-		}
-
-		dateStr := strings.TrimSpace(match[1])
-		timeStr := strings.TrimSpace(match[2])
-		sender := strings.TrimSpace(match[3])
-		message := strings.TrimSpace(match[4])
-
-		message = strings.TrimPrefix(message, "\u200e")
-
-		isSystemMessage := false
-		lowerCaseMessage := strings.ToLower(message)
-		for _, pattern := range systemMessagePatterns {
-			if strings.Contains(lowerCaseMessage, pattern) {
-				isSystemMessage = true
-				break
-			}
-		}
-		if isSystemMessage || strings.Contains(message, "<attached:") || strings.Contains(message, " omitted>") || strings.Contains(message, "omitted media") {
-			continue
-		}
-
-		var timestamp time.Time
-		var parseError error
-		parsed := false
-		timeCleaned := strings.ToUpper(strings.ReplaceAll(timeStr, "\u202f", " "))
-		datetimeStr := dateStr + " " + timeCleaned
-
-		for _, layout := range currentTimestampParseLayouts {
-			hasSecondsLayout := strings.Contains(layout, ":05")
-			hasSecondsData := strings.Count(timeCleaned, ":") >= 2
-			hasAmPmLayout := strings.Contains(layout, " PM")
-			hasAmPmData := strings.HasSuffix(timeCleaned, " AM") || strings.HasSuffix(timeCleaned, " PM")
-
-			if hasSecondsLayout != hasSecondsData || hasAmPmLayout != hasAmPmData {
-				continue
-			}
-
-			timestamp, parseError = time.Parse(layout, datetimeStr)
-			if parseError == nil {
-				parsed = true
-				break
-			}
-		}
-
-		if !parsed {
-			// log.Printf("Line %d: Failed to parse timestamp '%s' with available layouts.", lineNumber, datetimeStr)
-			continue
-		}
-
-		cleanedMessage := cleanTextRemoveStopwords(message)
-
-		if cleanedMessage != "" {
-			messagesData = append(messagesData, ParsedMessage{
-				Timestamp:       timestamp,
-				DateStr:         dateStr,
-				Sender:          sender,
-				CleanedMessage:  cleanedMessage,
-				OriginalMessage: message,
-			})
-		} else {
-		}
+		return nil, err
 	}
 
-	if err := mainScanner.Err(); err != nil {
-		return rawMessageCount, messagesData, fmt.Errorf("error reading data stream: %w", err)
+	warnings := warningList(parsed.Warnings)
+	if len(stopwordsSet) == 0 {
+		warnings.add(warnStopwordsDegraded, 1, "The stopword list is unavailable, so common words and the AI sample include filler words.")
 	}
-
-	log.Printf("Preprocessing complete. Raw messages counted: %d, Parsed messages for analysis: %d", rawMessageCount, len(messagesData))
-
-	return rawMessageCount, messagesData, nil
-}
-func removeLinks(text string) string {
-	return urlPattern.ReplaceAllString(text, "")
+	return &preprocessResult{
+		rawMessageCount: parsed.RawLines,
+		messages:        parsed.Messages,
+		markers:         parsed.Markers,
+		groupEvents:     parsed.GroupEvents,
+		diagnostics:     ParseDiagnostics{Diagnostics: parsed.Diagnostics},
+		warnings:        warnings,
+	}, nil
 }
 
 func removeEmojis(text string) string {
 	return emojiPattern.ReplaceAllString(text, "")
 }
 
-func normalizeWord(word string) string {
-	trimmed := strings.Trim(word, string(stringPunctuation))
-	return strings.ToLower(trimmed)
-}
-
-const stringPunctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
-
-func cleanTextRemoveStopwords(text string) string {
-	text = removeLinks(text)
-	text = strings.TrimSpace(text)
-	if text == "" {
-		return ""
-	}
-
-	words := strings.Fields(text)
-	filteredWords := make([]string, 0, len(words))
-
-	for _, word := range words {
-		normalized := normalizeWord(word)
-		_, isStopword := stopwordsSet[normalized]
-		if !isStopword && len(normalized) > 2 && normalized != "" {
-			filteredWords = append(filteredWords, normalized)
-		}
-	}
-	return strings.Join(filteredWords, " ")
-}
-
 func containsExcessiveSpecialChars(text string) bool {
 	return excessiveCharsPattern.MatchString(text)
 }
 
 type Topic []ParsedMessage
 
-func groupMessagesByTopic(data []ParsedMessage, gapHours float64) []Topic {
-	if len(data) == 0 {
+// groupMessagesByTopic splits the messages, in time order, wherever two are
+// gapHours or more apart. It sorts a copy: the caller's slice is shared
+// between the stats and the AI tasks running at the same time.
+func groupMessagesByTopic(messages []ParsedMessage, gapHours float64) []Topic {
+	if len(messages) == 0 {
 		return []Topic{}
 	}
 
+	data := make([]ParsedMessage, len(messages))
+	copy(data, messages)
 	sort.SliceStable(data, func(i, j int) bool {
 		return data[i].Timestamp.Before(data[j].Timestamp)
 	})
@@ -462,7 +250,10 @@ func groupMessagesByTopic(data []ParsedMessage, gapHours float64) []Topic {
 	return processedTopics
 }
 
-func stratifyMessages(topics []Topic) map[string][]string {
+// stratifyMessages picks the messages the AI reads: a random sample of up to
+// 23 longer messages per sender. It also returns how many eligible messages
+// were left out of the sample.
+func stratifyMessages(topics []Topic) (map[string][]string, int) {
 	consolidatedMessages := make(map[string][]string)
 
 	for _, topic := range topics {
@@ -515,6 +306,7 @@ func stratifyMessages(topics []Topic) map[string][]string {
 
 	finalSampled := make(map[string][]string)
 	maxMessagesPerSender := 23
+	omitted := 0
 
 	senders := maps.Keys(consolidatedMessages)
 	sort.Strings(senders)
@@ -538,13 +330,14 @@ func stratifyMessages(topics []Topic) map[string][]string {
 			selectedMsgs := eligibleMsgs
 			if len(eligibleMsgs) > maxMessagesPerSender {
 				selectedMsgs = eligibleMsgs[:maxMessagesPerSender]
+				omitted += len(eligibleMsgs) - maxMessagesPerSender
 			}
 
 			finalSampled[sender] = selectedMsgs
 		}
 	}
 
-	return finalSampled
+	return finalSampled, omitted
 }
 
 func extractDisplayNames(users []string) []string {
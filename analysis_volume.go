@@ -0,0 +1,167 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	volumeGrowing   = "growing"
+	volumeShrinking = "shrinking"
+	volumeStable    = "stable"
+
+	// volumeTrendMonths is how many recent complete months are compared
+	// against the same number of months before them.
+	volumeTrendMonths = 3
+	// volumeTrendThresholdPct is how far the recent average has to move
+	// before the chat counts as growing or shrinking.
+	volumeTrendThresholdPct = 15.0
+)
+
+type MonthlyVolume struct {
+	Month     string   `json:"month"`
+	Messages  int      `json:"messages"`
+	GrowthPct *float64 `json:"growth_pct"`
+}
+
+// MonthlyVolumeTrend lists every calendar month from the first message to the
+// last, silent months included, with the change against the month before.
+// GrowthPct is null for the first month and after a silent month. Trend
+// compares the average of the last three complete months (the export's final
+// month is partial and left out) with the three before them; ChangePct is
+// that comparison, or null when there are fewer than two complete months.
+type MonthlyVolumeTrend struct {
+	Months    []MonthlyVolume `json:"months"`
+	Trend     string          `json:"trend"`
+	ChangePct *float64        `json:"change_pct"`
+}
+
+func calculateMonthlyVolume(messagesData []ParsedMessage) *MonthlyVolumeTrend {
+	if len(messagesData) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, msg := range messagesData {
+		counts[msg.Timestamp.Format("2006-01")]++
+	}
+
+	first := messagesData[0].Timestamp
+	last := messagesData[len(messagesData)-1].Timestamp
+	end := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	volume := &MonthlyVolumeTrend{Months: []MonthlyVolume{}, Trend: volumeStable}
+	for month := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(end); month = month.AddDate(0, 1, 0) {
+		entry := MonthlyVolume{Month: month.Format("2006-01"), Messages: counts[month.Format("2006-01")]}
+		if n := len(volume.Months); n > 0 && volume.Months[n-1].Messages > 0 {
+			previous := volume.Months[n-1].Messages
+			growth := roundFloat(float64(entry.Messages-previous)/float64(previous)*100, 2)
+			entry.GrowthPct = &growth
+		}
+		volume.Months = append(volume.Months, entry)
+	}
+
+	complete := volume.Months[:len(volume.Months)-1]
+	window := min(volumeTrendMonths, len(complete)/2)
+	if window == 0 {
+		return volume
+	}
+	recent := averageMonthlyMessages(complete[len(complete)-window:])
+	earlier := averageMonthlyMessages(complete[len(complete)-2*window : len(complete)-window])
+	if earlier == 0 {
+		if recent > 0 {
+			volume.Trend = volumeGrowing
+		}
+		return volume
+	}
+
+	change := roundFloat((recent-earlier)/earlier*100, 2)
+	volume.ChangePct = &change
+	switch {
+	case change >= volumeTrendThresholdPct:
+		volume.Trend = volumeGrowing
+	case change <= -volumeTrendThresholdPct:
+		volume.Trend = volumeShrinking
+	}
+	return volume
+}
+
+func averageMonthlyMessages(months []MonthlyVolume) float64 {
+	total := 0
+	for _, month := range months {
+		total += month.Messages
+	}
+	return float64(total) / float64(len(months))
+}
+
+// DailyCount is one row of the flat per-day export meant for spreadsheets and
+// BI tools. Only days with messages are listed.
+type DailyCount struct {
+	Date  string         `json:"date"`
+	Total int            `json:"total"`
+	Users map[string]int `json:"users"`
+}
+
+func calculateDailyCounts(messagesData []ParsedMessage) []DailyCount {
+	byDate := make(map[string]*DailyCount)
+	for _, msg := range messagesData {
+		date := msg.Timestamp.Format("2006-01-02")
+		day, ok := byDate[date]
+		if !ok {
+			day = &DailyCount{Date: date, Users: make(map[string]int)}
+			byDate[date] = day
+		}
+		day.Total++
+		day.Users[msg.Sender]++
+	}
+
+	days := make([]DailyCount, 0, len(byDate))
+	for _, day := range byDate {
+		days = append(days, *day)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date < days[j].Date
+	})
+	return days
+}
+
+type CalendarDay struct {
+	Day   string `json:"day"`
+	Value int    `json:"value"`
+}
+
+// CalendarHeatmap is shaped for Nivo's calendar chart: pass From and To as the
+// chart's from/to props and Data as its data. Every day in the range is
+// listed, silent days with a value of 0.
+type CalendarHeatmap struct {
+	From string        `json:"from"`
+	To   string        `json:"to"`
+	Data []CalendarDay `json:"data"`
+}
+
+func calculateCalendarHeatmap(messagesData []ParsedMessage) *CalendarHeatmap {
+	if len(messagesData) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, msg := range messagesData {
+		counts[msg.Timestamp.Format("2006-01-02")]++
+	}
+
+	first := messagesData[0].Timestamp
+	last := messagesData[len(messagesData)-1].Timestamp
+	start := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC)
+
+	heatmap := &CalendarHeatmap{
+		From: start.Format("2006-01-02"),
+		To:   end.Format("2006-01-02"),
+		Data: []CalendarDay{},
+	}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		heatmap.Data = append(heatmap.Data, CalendarDay{Day: date, Value: counts[date]})
+	}
+	return heatmap
+}
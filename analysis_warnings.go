@@ -0,0 +1,42 @@
+package main
+
+import "bloop-go-server/pkg/parser"
+
+// Warning codes reported in AnalysisResult.Warnings, next to the parser's
+// own (parser.WarnLinesTruncated and the like). Codes are stable so clients
+// can match on them; the messages are for people.
+const (
+	warnStopwordsDegraded  = "stopwords_degraded"
+	warnConvoBreakDefault  = "convo_break_default"
+	warnAISampleTruncated  = "ai_sample_truncated"
+	warnAIPeopleIncomplete = "ai_people_incomplete"
+	warnAIPaused           = "ai_paused"
+)
+
+// Warning is something that made a result less exact without failing it.
+type Warning = parser.Warning
+
+type warningList []Warning
+
+// add records a warning, folding repeats of a code into one entry with the
+// counts summed and the first message kept. Adding to a nil list is a no-op,
+// for callers that don't report warnings.
+func (w *warningList) add(code string, count int, message string) {
+	if w == nil {
+		return
+	}
+	for i := range *w {
+		if (*w)[i].Code == code {
+			(*w)[i].Count += count
+			return
+		}
+	}
+	*w = append(*w, Warning{Code: code, Message: message, Count: count})
+}
+
+// merge adds every warning in other.
+func (w *warningList) merge(other warningList) {
+	for _, warning := range other {
+		w.add(warning.Code, warning.Count, warning.Message)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "sort"
+
+// wordcloudSize is how many tokens a word cloud shows before it gets too
+// crowded to read on a phone.
+const wordcloudSize = 60
+
+// WordcloudToken is one word of the cloud. Weight is the count relative to the
+// most used word, so the top word is 1 and clients can scale font sizes from
+// it directly. ColorKey is the participant who used the word most, for
+// colouring each word by its owner.
+type WordcloudToken struct {
+	Token    string  `json:"token"`
+	Count    int     `json:"count"`
+	Weight   float64 `json:"weight"`
+	ColorKey string  `json:"color_key"`
+}
+
+// calculateWordcloud uses the same stopword- and name-filtered counts as
+// common_words, just more of them.
+func calculateWordcloud(wordCounter map[string]int, userWordCounter UserStringIntMap) []WordcloudToken {
+	tokens := make([]WordcloudToken, 0, len(wordCounter))
+	for word, count := range wordCounter {
+		tokens = append(tokens, WordcloudToken{Token: word, Count: count})
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Count != tokens[j].Count {
+			return tokens[i].Count > tokens[j].Count
+		}
+		return tokens[i].Token < tokens[j].Token
+	})
+	if len(tokens) > wordcloudSize {
+		tokens = tokens[:wordcloudSize]
+	}
+	if len(tokens) == 0 {
+		return tokens
+	}
+
+	users := make([]string, 0, len(userWordCounter))
+	for user := range userWordCounter {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	maxCount := float64(tokens[0].Count)
+	for i := range tokens {
+		tokens[i].Weight = roundFloat(float64(tokens[i].Count)/maxCount, 4)
+		best := 0
+		for _, user := range users {
+			if count := userWordCounter[user][tokens[i].Token]; count > best {
+				best = count
+				tokens[i].ColorKey = user
+			}
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// bundleSchemaVersion is bumped whenever the bundle layout or the meaning of a
+// chart's data changes, so the offline frontend can refuse bundles it does
+// not understand.
+const bundleSchemaVersion = 1
+
+// ChartConfig tells the frontend how to draw one chart from the bundled
+// result. DataPath is a JSON pointer (RFC 6901) into Result.
+type ChartConfig struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	DataPath string `json:"data_path"`
+}
+
+type BundleIntegrity struct {
+	Algorithm string `json:"algorithm"`
+	Hash      string `json:"hash"`
+}
+
+// AnalysisBundle is a self-contained export the frontend's offline mode can
+// import without calling the API. Integrity.Hash is the hex SHA-256 of Result
+// exactly as it appears in the bundle: compact JSON without HTML escaping,
+// which is what JSON.stringify produces for the parsed value.
+type AnalysisBundle struct {
+	SchemaVersion int             `json:"schema_version"`
+	GeneratedAt   string          `json:"generated_at"`
+	Integrity     BundleIntegrity `json:"integrity"`
+	Charts        []ChartConfig   `json:"charts"`
+	Result        json.RawMessage `json:"result"`
+}
+
+type bundleChart struct {
+	config  ChartConfig
+	present func(*ChatStatistics) bool
+}
+
+var bundleCharts = []bundleChart{
+	{ChartConfig{"messages_per_user", "pie", "Messages per person", "/stats/user_message_count"},
+		func(s *ChatStatistics) bool { return len(s.UserMessageCount) > 0 }},
+	{ChartConfig{"monthly_activity", "line", "Messages per month", "/stats/user_monthly_activity"},
+		func(s *ChatStatistics) bool { return len(s.UserMonthlyActivity) > 0 }},
+	{ChartConfig{"common_words", "bar", "Most used words", "/stats/common_words"},
+		func(s *ChatStatistics) bool { return len(s.CommonWords) > 0 }},
+	{ChartConfig{"common_emojis", "bar", "Most used emojis", "/stats/common_emojis"},
+		func(s *ChatStatistics) bool { return len(s.CommonEmojis) > 0 }},
+	{ChartConfig{"weekday_vs_weekend", "bar", "Weekday vs weekend", "/stats/weekday_vs_weekend_avg"},
+		func(s *ChatStatistics) bool { return s.WeekdayVsWeekendAvg != nil }},
+	{ChartConfig{"interaction_matrix", "heatmap", "Who replies to whom", "/stats/user_interaction_matrix"},
+		func(s *ChatStatistics) bool { return len(s.UserInteractionMatrix) > 0 }},
+	{ChartConfig{"style_fingerprints", "radar", "Texting style", "/stats/user_style_fingerprints"},
+		func(s *ChatStatistics) bool { return len(s.UserStyleFingerprints) > 0 }},
+	{ChartConfig{"chat_health_trend", "line", "Chat health", "/stats/chat_health/trend"},
+		func(s *ChatStatistics) bool { return s.ChatHealth != nil }},
+	{ChartConfig{"seasonality", "bar", "Activity by month of year", "/stats/seasonality/month_of_year"},
+		func(s *ChatStatistics) bool { return s.Seasonality != nil }},
+	{ChartConfig{"deletion_trend", "line", "Deleted messages per month", "/stats/deletion_trend/monthly"},
+		func(s *ChatStatistics) bool { return s.DeletionTrend != nil }},
+}
+
+// buildAnalysisBundle serializes the bundle itself, since encoding it through
+// json.Marshal would re-escape the embedded result and break the hash.
+func buildAnalysisBundle(result *AnalysisResult, now time.Time) ([]byte, error) {
+	resultJSON, err := marshalUnescaped(result)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode analysis result: %w", err)
+	}
+	sum := sha256.Sum256(resultJSON)
+
+	charts := []ChartConfig{}
+	if result.Stats != nil {
+		for _, chart := range bundleCharts {
+			if chart.present(result.Stats) {
+				charts = append(charts, chart.config)
+			}
+		}
+	}
+
+	bundle := AnalysisBundle{
+		SchemaVersion: bundleSchemaVersion,
+		GeneratedAt:   now.UTC().Format(time.RFC3339),
+		Integrity:     BundleIntegrity{Algorithm: "sha256", Hash: hex.EncodeToString(sum[:])},
+		Charts:        charts,
+		Result:        resultJSON,
+	}
+	return marshalUnescaped(bundle)
+}
+
+func marshalUnescaped(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// bundleFilename turns the chat name into a safe download name.
+func bundleFilename(chatName string) string {
+	var b strings.Builder
+	lastDash := true
+	for _, r := range strings.ToLower(chatName) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			lastDash = false
+		} else if !lastDash {
+			b.WriteRune('-')
+			lastDash = true
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "-")
+	if name == "" {
+		name = "chat"
+	}
+	return name + ".bloop.json"
+}
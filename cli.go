@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// runCLI analyses one export on this machine and writes the JSON result to
+// outPath, or to stdout when outPath is empty. Logs go to stderr so stdout
+// stays valid JSON. Chat messages only leave the machine when a Groq key is
+// configured and noAI is false.
+func runCLI(chatPath, outPath string, noAI bool) error {
+	data, err := os.ReadFile(chatPath)
+	if err != nil {
+		return fmt.Errorf("could not read chat export: %w", err)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	config = cfg
+
+	if !noAI && currentAISettings().apiKey == "" {
+		log.Println("GROQ_API_KEY is not set; running without AI analysis.")
+		noAI = true
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, cfg.AnalysisTimeout)
+	defer cancel()
+
+	queue := make(chan aiTask, 1)
+	var workerWg sync.WaitGroup
+	if !noAI {
+		workerWg.Add(1)
+		go aiWorker(0, queue, nil, &workerWg)
+	}
+
+	results, err := AnalyzeChat(ctx, bytes.NewReader(data), filepath.Base(chatPath), queue, cfg.AIQueueTimeout, cfg.MaxLineBytes, AnalysisOptions{NoAI: noAI})
+	close(queue)
+	workerWg.Wait()
+	if err != nil {
+		return err
+	}
+	if results.Error != "" {
+		log.Printf("Warning: %s", results.Error)
+	}
+	for _, warning := range results.Warnings {
+		log.Printf("Warning (%s): %s", warning.Code, warning.Message)
+	}
+
+	output, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode result: %w", err)
+	}
+	output = append(output, '\n')
+	if outPath == "" {
+		_, err = os.Stdout.Write(output)
+		return err
+	}
+	if err := os.WriteFile(outPath, output, 0644); err != nil {
+		return fmt.Errorf("could not write result: %w", err)
+	}
+	log.Printf("Wrote analysis of %s to %s", chatPath, outPath)
+	return nil
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -21,8 +24,49 @@ type Config struct {
 	MaxTempFileAge        time.Duration
 	MaxUploadSizeBytes    int64
 	AnalysisTimeout       time.Duration
+	DrainTimeout          time.Duration
+	IdempotencyTTL        time.Duration
+	DuplicateUploadWindow time.Duration
 	APIKey                string
+	AdminAPIKey           string
 	OpenAIAPIKey          string
+	MaxLineBytes          int
+	DebugSaveUploads      bool
+	StrictMinParsePct     int
+	Storage               StorageConfig
+	Watch                 WatchConfig
+	// Sources maps each variable LoadConfig read to where its value came
+	// from: configSourceEnv, configSourceFile or configSourceDefault.
+	Sources map[string]string
+}
+
+// StorageConfig selects where analysis results, and uploads the user opted to
+// keep, are persisted. An empty Backend disables storage.
+type StorageConfig struct {
+	Backend         string
+	LocalDir        string
+	Bucket          string
+	Region          string
+	Endpoint        string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// WatchConfig turns on the drop-folder pipeline: exports dropped into Dir or
+// mailed to the IMAP inbox are analysed and written to OutputDir.
+type WatchConfig struct {
+	Dir          string
+	OutputDir    string
+	Interval     time.Duration
+	IMAPHost     string
+	IMAPUser     string
+	IMAPPassword string
+	IMAPFolder   string
+}
+
+func (w WatchConfig) enabled() bool {
+	return w.Dir != "" || w.IMAPHost != ""
 }
 
 func LoadConfig() (*Config, error) {
@@ -30,13 +74,17 @@ func LoadConfig() (*Config, error) {
 	if err != nil && !os.IsNotExist(err) {
 		log.Printf("Warning: Could not load .env file: %v", err)
 	}
+	env := newEnvSettings()
 
-	apiKey := os.Getenv("VAL_API_KEY")
+	apiKey := env.get("VAL_API_KEY")
 	if apiKey == "" {
 		log.Println("Warning: VAL_API_KEY not set. API key protection will be disabled if configured.")
 	}
 
-	tempDirRoot := os.Getenv("TEMP_DIR_ROOT")
+	// ADMIN_API_KEY guards the /admin endpoints; they are not served without it.
+	adminAPIKey := env.get("ADMIN_API_KEY")
+
+	tempDirRoot := env.get("TEMP_DIR_ROOT")
 	if tempDirRoot == "" {
 		tempDirRoot = filepath.Join(os.TempDir(), "bloop")
 	}
@@ -47,81 +95,257 @@ func LoadConfig() (*Config, error) {
 	}
 	tempDirRoot = absTempDir
 
-	maxAgeStr := os.Getenv("MAX_TEMP_FILE_AGE_SECONDS")
-	if maxAgeStr == "" {
-		maxAgeStr = "6000"
-	}
-	maxAgeSec, err := strconv.Atoi(maxAgeStr)
-	if err != nil || maxAgeSec <= 0 {
-		log.Printf("Warning: Invalid MAX_TEMP_FILE_AGE_SECONDS value '%s'. Using default 86400. Error: %v", maxAgeStr, err)
-		maxAgeSec = 86400
+	maxAgeSec, err := env.intValue("MAX_TEMP_FILE_AGE_SECONDS", 6000, 1, math.MaxInt32)
+	if err != nil {
+		return nil, err
 	}
 
-	host := os.Getenv("HOST")
+	host := env.get("HOST")
 	if host == "" {
 		host = "0.0.0.0"
 	}
 
-	portStr := os.Getenv("PORT")
-	if portStr == "" {
-		portStr = "8000"
+	port, err := env.intValue("PORT", 8000, 1, 65535)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSizeMb, err := env.intValue("MAX_UPLOAD_SIZE_MB", 25, 1, math.MaxInt32)
+	if err != nil {
+		return nil, err
 	}
-	port, err := strconv.Atoi(portStr)
-	if err != nil || port <= 0 || port > 65535 {
-		log.Printf("Warning: Invalid PORT value '%s'. Using default 8000. Error: %v", portStr, err)
-		port = 8000
+	maxUploadSizeBytes := int64(maxSizeMb) * 1024 * 1024
+
+	analysisTimeoutSec, err := env.intValue("ANALYSIS_TIMEOUT_SECONDS", 300, 1, math.MaxInt32)
+	if err != nil {
+		return nil, err
 	}
 
-	maxSizeMbStr := os.Getenv("MAX_UPLOAD_SIZE_MB")
-	if maxSizeMbStr == "" {
-		maxSizeMbStr = "25"
+	drainTimeoutSec, err := env.intValue("DRAIN_TIMEOUT_SECONDS", 30, 0, math.MaxInt32)
+	if err != nil {
+		return nil, err
 	}
-	maxSizeMb, err := strconv.Atoi(maxSizeMbStr)
-	if err != nil || maxSizeMb <= 0 {
-		log.Printf("Warning: Invalid MAX_UPLOAD_SIZE_MB value '%s'. Using default 25. Error: %v", maxSizeMbStr, err)
-		maxSizeMb = 25
+
+	idempotencyTTLSec, err := env.intValue("IDEMPOTENCY_TTL_SECONDS", 3600, 0, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicateWindowSec, err := env.intValue("DUPLICATE_UPLOAD_WINDOW_SECONDS", 60, 0, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	maxConcurrentAICalls, err := env.intValue("MAX_CONCURRENT_AI_CALLS", 10, 1, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	maxConcurrentAnalyses, err := env.intValue("MAX_CONCURRENT_ANALYSES", 10, 1, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	aiQueueTimeoutSec, err := env.intValue("AI_QUEUE_TIMEOUT_SECONDS", 20, 0, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	maxLineKb, err := env.intValue("MAX_LINE_LENGTH_KB", 1024, 1, math.MaxInt32/1024)
+	if err != nil {
+		return nil, err
+	}
+
+	debugSaveUploads, err := env.boolValue("DEBUG_SAVE_UPLOADS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	strictMinParsePct, err := env.intValue("STRICT_MIN_PARSE_PCT", 90, 1, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := loadStorageConfig(env)
+	if err != nil {
+		return nil, err
 	}
-	maxUploadSizeBytes := int64(maxSizeMb) * 1024 * 1024
 
-	analysisTimeoutStr := os.Getenv("ANALYSIS_TIMEOUT_SECONDS")
-	if analysisTimeoutStr == "" {
-		analysisTimeoutStr = "300"
+	watch, err := loadWatchConfig(env)
+	if err != nil {
+		return nil, err
 	}
-	analysisTimeoutSec, err := strconv.Atoi(analysisTimeoutStr)
-	if err != nil || analysisTimeoutSec <= 0 {
-		log.Printf("Warning: Invalid ANALYSIS_TIMEOUT_SECONDS value '%s'. Using default 300. Error: %v", analysisTimeoutStr, err)
-		analysisTimeoutSec = 300
+
+	cfg := &Config{
+		Host:                  host,
+		Port:                  port,
+		MaxConcurrentAnalyses: maxConcurrentAnalyses,
+		MaxConcurrentAICalls:  maxConcurrentAICalls,
+		AIQueueTimeout:        time.Duration(aiQueueTimeoutSec) * time.Second,
+		TempDirRoot:           tempDirRoot,
+		MaxTempFileAge:        time.Duration(maxAgeSec) * time.Second,
+		MaxUploadSizeBytes:    maxUploadSizeBytes,
+		AnalysisTimeout:       time.Duration(analysisTimeoutSec) * time.Second,
+		DrainTimeout:          time.Duration(drainTimeoutSec) * time.Second,
+		IdempotencyTTL:        time.Duration(idempotencyTTLSec) * time.Second,
+		DuplicateUploadWindow: time.Duration(duplicateWindowSec) * time.Second,
+		APIKey:                apiKey,
+		AdminAPIKey:           adminAPIKey,
+		MaxLineBytes:          maxLineKb * 1024,
+		DebugSaveUploads:      debugSaveUploads,
+		StrictMinParsePct:     strictMinParsePct,
+		Storage:               storage,
+		Watch:                 watch,
+		Sources:               env.sources,
 	}
 
-	maxConcurrentAICallsStr := os.Getenv("MAX_CONCURRENT_AI_CALLS")
-	if maxConcurrentAICallsStr == "" {
-		maxConcurrentAICallsStr = "10"
+	return cfg, nil
+}
+
+// envSettings reads settings from the environment, after .env has been
+// loaded into it, and records where each one came from for the startup
+// report.
+type envSettings struct {
+	sources map[string]string
+}
+
+func newEnvSettings() *envSettings {
+	return &envSettings{sources: make(map[string]string)}
+}
+
+func (e *envSettings) get(key string) string {
+	value := os.Getenv(key)
+	e.sources[key] = settingSource(key, value)
+	return value
+}
+
+// intValue parses key as a whole number in [minValue, maxValue], or returns
+// def when it is unset. A value that doesn't parse or is out of range is an
+// error rather than a silent fallback, so a typo can't start the server with
+// settings nobody asked for.
+func (e *envSettings) intValue(key string, def, minValue, maxValue int) (int, error) {
+	raw := strings.TrimSpace(e.get(key))
+	if raw == "" {
+		return def, nil
 	}
-	maxConcurrentAICalls, err := strconv.Atoi(maxConcurrentAICallsStr)
-	if err != nil || maxConcurrentAICalls <= 0 {
-		log.Printf("Warning: Invalid MAX_CONCURRENT_AI_CALLS value '%s'. Using default 3. Error: %v", maxConcurrentAICallsStr, err)
-		maxConcurrentAICalls = 3
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < minValue || value > maxValue {
+		if maxValue == math.MaxInt32 {
+			return 0, fmt.Errorf("invalid %s value '%s': use a whole number of at least %d", key, raw, minValue)
+		}
+		return 0, fmt.Errorf("invalid %s value '%s': use a whole number from %d to %d", key, raw, minValue, maxValue)
 	}
+	return value, nil
+}
 
-	aiQueueTimeoutStr := os.Getenv("AI_QUEUE_TIMEOUT_SECONDS")
-	if aiQueueTimeoutStr == "" {
-		aiQueueTimeoutStr = "20"
+func (e *envSettings) boolValue(key string, def bool) (bool, error) {
+	raw := strings.TrimSpace(e.get(key))
+	if raw == "" {
+		return def, nil
 	}
-	aiQueueTimeoutSec, err := strconv.Atoi(aiQueueTimeoutStr)
-	if err != nil || aiQueueTimeoutSec < 0 {
-		log.Printf("Warning: Invalid AI_QUEUE_TIMEOUT_SECONDS value '%s'. Using default 20. Error: %v", aiQueueTimeoutStr, err)
-		aiQueueTimeoutSec = 20
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value '%s': use true or false", key, raw)
 	}
+	return value, nil
+}
 
-	return &Config{
-		Host:                 host,
-		Port:                 port,
-		MaxConcurrentAICalls: maxConcurrentAICalls,
-		AIQueueTimeout:       time.Duration(aiQueueTimeoutSec) * time.Second,
-		TempDirRoot:          tempDirRoot,
-		MaxTempFileAge:       time.Duration(maxAgeSec) * time.Second,
-		MaxUploadSizeBytes:   maxUploadSizeBytes,
-		AnalysisTimeout:      time.Duration(analysisTimeoutSec) * time.Second,
-		APIKey:               apiKey,
-	}, nil
+// settingSource says where value, the current value of key, came from. .env
+// never overrides the process environment, at startup or on reload, so a
+// variable set before it was read is the environment's.
+func settingSource(key, value string) string {
+	if value == "" {
+		return configSourceDefault
+	}
+	if _, fromProcess := processEnvKeys[key]; fromProcess {
+		return configSourceEnv
+	}
+	return configSourceFile
+}
+
+func loadStorageConfig(env *envSettings) (StorageConfig, error) {
+	storage := StorageConfig{
+		Backend:         strings.ToLower(strings.TrimSpace(env.get("STORAGE_BACKEND"))),
+		LocalDir:        env.get("STORAGE_LOCAL_DIR"),
+		Bucket:          env.get("STORAGE_BUCKET"),
+		Region:          env.get("STORAGE_REGION"),
+		Endpoint:        env.get("STORAGE_ENDPOINT"),
+		Prefix:          env.get("STORAGE_PREFIX"),
+		AccessKeyID:     env.get("STORAGE_ACCESS_KEY_ID"),
+		SecretAccessKey: env.get("STORAGE_SECRET_ACCESS_KEY"),
+	}
+
+	switch storage.Backend {
+	case "", "none":
+		storage.Backend = ""
+	case storageBackendLocal:
+		if storage.LocalDir == "" {
+			storage.LocalDir = "storage"
+		}
+		absDir, err := filepath.Abs(storage.LocalDir)
+		if err != nil {
+			return storage, fmt.Errorf("failed to get absolute path for STORAGE_LOCAL_DIR '%s': %w", storage.LocalDir, err)
+		}
+		storage.LocalDir = absDir
+	case storageBackendS3:
+		if storage.Region == "" {
+			storage.Region = "us-east-1"
+		}
+	case storageBackendGCS:
+		if storage.Region == "" {
+			storage.Region = "auto"
+		}
+	default:
+		return storage, fmt.Errorf("invalid STORAGE_BACKEND value '%s': use local, s3 or gcs", storage.Backend)
+	}
+	return storage, nil
+}
+
+func loadWatchConfig(env *envSettings) (WatchConfig, error) {
+	watch := WatchConfig{
+		Dir:          env.get("WATCH_DIR"),
+		OutputDir:    env.get("WATCH_OUTPUT_DIR"),
+		IMAPHost:     env.get("WATCH_IMAP_HOST"),
+		IMAPUser:     env.get("WATCH_IMAP_USER"),
+		IMAPPassword: env.get("WATCH_IMAP_PASSWORD"),
+		IMAPFolder:   env.get("WATCH_IMAP_FOLDER"),
+	}
+	if !watch.enabled() {
+		return watch, nil
+	}
+
+	intervalSec, err := env.intValue("WATCH_INTERVAL_SECONDS", 30, 1, math.MaxInt32)
+	if err != nil {
+		return watch, err
+	}
+	watch.Interval = time.Duration(intervalSec) * time.Second
+
+	if watch.OutputDir == "" {
+		return watch, errors.New("WATCH_OUTPUT_DIR is required when WATCH_DIR or WATCH_IMAP_HOST is set")
+	}
+	if watch.Dir != "" {
+		absDir, err := filepath.Abs(watch.Dir)
+		if err != nil {
+			return watch, fmt.Errorf("failed to get absolute path for WATCH_DIR '%s': %w", watch.Dir, err)
+		}
+		watch.Dir = absDir
+	}
+	absOutput, err := filepath.Abs(watch.OutputDir)
+	if err != nil {
+		return watch, fmt.Errorf("failed to get absolute path for WATCH_OUTPUT_DIR '%s': %w", watch.OutputDir, err)
+	}
+	watch.OutputDir = absOutput
+
+	if watch.IMAPHost != "" {
+		if !strings.Contains(watch.IMAPHost, ":") {
+			watch.IMAPHost += ":993"
+		}
+		if watch.IMAPUser == "" || watch.IMAPPassword == "" {
+			return watch, errors.New("WATCH_IMAP_USER and WATCH_IMAP_PASSWORD are required when WATCH_IMAP_HOST is set")
+		}
+		if watch.IMAPFolder == "" {
+			watch.IMAPFolder = "INBOX"
+		}
+	}
+	return watch, nil
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	configSourceEnv     = "env"
+	configSourceFile    = ".env"
+	configSourceDefault = "default"
+)
+
+// configSecrets are reported as set or unset, never by value.
+var configSecrets = map[string]bool{
+	"VAL_API_KEY":               true,
+	"ADMIN_API_KEY":             true,
+	"GROQ_API_KEY":              true,
+	"GROQ_API_KEYS":             true,
+	"STORAGE_ACCESS_KEY_ID":     true,
+	"STORAGE_SECRET_ACCESS_KEY": true,
+	"WATCH_IMAP_PASSWORD":       true,
+}
+
+type configEntry struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// buildConfigReport lists every setting with its effective value and where it
+// came from, as recorded by LoadConfig. The AI settings are re-read on SIGHUP
+// outside LoadConfig, so their source is worked out from the current
+// environment.
+func buildConfigReport(cfg *Config) []configEntry {
+	var entries []configEntry
+	add := func(key string, value interface{}) {
+		entry := configEntry{Key: key, Value: fmt.Sprint(value), Source: cfg.Sources[key]}
+		if entry.Source == "" {
+			entry.Source = settingSource(key, os.Getenv(key))
+		}
+		if configSecrets[key] {
+			entry.Value = "unset"
+			if value != "" {
+				entry.Value = "set"
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	add("HOST", cfg.Host)
+	add("PORT", cfg.Port)
+	add("VAL_API_KEY", cfg.APIKey)
+	add("ADMIN_API_KEY", cfg.AdminAPIKey)
+	ai := currentAISettings()
+	add("GROQ_API_KEY", ai.apiKey)
+	add("GROQ_API_KEYS", strings.Join(ai.apiKeys[min(1, len(ai.apiKeys)):], ","))
+	add("GROQ_MODEL", ai.model)
+	add("AI_TEMPERATURE", ai.temperature)
+	add("AI_MAX_TOKENS", ai.maxTokens)
+	add("AI_ALLOWED_MODELS", strings.Join(ai.allowedModels, ","))
+	add("AI_PROMPT_PROFILE", ai.profile)
+	add("MAX_CONCURRENT_ANALYSES", cfg.MaxConcurrentAnalyses)
+	add("MAX_CONCURRENT_AI_CALLS", cfg.MaxConcurrentAICalls)
+	add("AI_QUEUE_TIMEOUT_SECONDS", cfg.AIQueueTimeout)
+	add("ANALYSIS_TIMEOUT_SECONDS", cfg.AnalysisTimeout)
+	add("DRAIN_TIMEOUT_SECONDS", cfg.DrainTimeout)
+	add("IDEMPOTENCY_TTL_SECONDS", cfg.IdempotencyTTL)
+	add("DUPLICATE_UPLOAD_WINDOW_SECONDS", cfg.DuplicateUploadWindow)
+	add("MAX_UPLOAD_SIZE_MB", strconv.FormatInt(cfg.MaxUploadSizeBytes/(1024*1024), 10))
+	add("MAX_LINE_LENGTH_KB", cfg.MaxLineBytes/1024)
+	add("STRICT_MIN_PARSE_PCT", cfg.StrictMinParsePct)
+	add("DEBUG_SAVE_UPLOADS", cfg.DebugSaveUploads)
+	if cfg.DebugSaveUploads {
+		add("TEMP_DIR_ROOT", cfg.TempDirRoot)
+		add("MAX_TEMP_FILE_AGE_SECONDS", cfg.MaxTempFileAge)
+	}
+
+	storageBackend := cfg.Storage.Backend
+	if storageBackend == "" {
+		storageBackend = "none"
+	}
+	add("STORAGE_BACKEND", storageBackend)
+	switch cfg.Storage.Backend {
+	case storageBackendLocal:
+		add("STORAGE_LOCAL_DIR", cfg.Storage.LocalDir)
+	case storageBackendS3, storageBackendGCS:
+		add("STORAGE_BUCKET", cfg.Storage.Bucket)
+		add("STORAGE_REGION", cfg.Storage.Region)
+		add("STORAGE_ENDPOINT", cfg.Storage.Endpoint)
+		add("STORAGE_PREFIX", cfg.Storage.Prefix)
+		add("STORAGE_ACCESS_KEY_ID", cfg.Storage.AccessKeyID)
+		add("STORAGE_SECRET_ACCESS_KEY", cfg.Storage.SecretAccessKey)
+	}
+
+	if cfg.Watch.enabled() {
+		add("WATCH_DIR", cfg.Watch.Dir)
+		add("WATCH_OUTPUT_DIR", cfg.Watch.OutputDir)
+		add("WATCH_INTERVAL_SECONDS", cfg.Watch.Interval)
+		if cfg.Watch.IMAPHost != "" {
+			add("WATCH_IMAP_HOST", cfg.Watch.IMAPHost)
+			add("WATCH_IMAP_USER", cfg.Watch.IMAPUser)
+			add("WATCH_IMAP_PASSWORD", cfg.Watch.IMAPPassword)
+			add("WATCH_IMAP_FOLDER", cfg.Watch.IMAPFolder)
+		}
+	}
+	return entries
+}
+
+// configWarnings flags settings that are valid on their own but work against
+// each other.
+func configWarnings(cfg *Config) []string {
+	var warnings []string
+	// Each analysis queues at most two AI tasks: the analysis and the digest.
+	if cfg.MaxConcurrentAICalls > 2*cfg.MaxConcurrentAnalyses {
+		warnings = append(warnings, fmt.Sprintf("MAX_CONCURRENT_AI_CALLS (%d) is more than twice MAX_CONCURRENT_ANALYSES (%d); the extra AI workers will sit idle.", cfg.MaxConcurrentAICalls, cfg.MaxConcurrentAnalyses))
+	}
+	if cfg.AIQueueTimeout >= cfg.AnalysisTimeout {
+		warnings = append(warnings, fmt.Sprintf("AI_QUEUE_TIMEOUT_SECONDS (%s) is not shorter than ANALYSIS_TIMEOUT_SECONDS (%s); analyses can time out while still waiting for an AI worker.", cfg.AIQueueTimeout, cfg.AnalysisTimeout))
+	}
+	if int64(cfg.MaxLineBytes) > cfg.MaxUploadSizeBytes {
+		warnings = append(warnings, "MAX_LINE_LENGTH_KB is larger than MAX_UPLOAD_SIZE_MB and has no effect.")
+	}
+	return warnings
+}
+
+func logConfigReport(cfg *Config) {
+	entries := buildConfigReport(cfg)
+	width := 0
+	for _, entry := range entries {
+		width = max(width, len(entry.Key))
+	}
+
+	var b strings.Builder
+	b.WriteString("Effective configuration:")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "\n  %-*s %s (%s)", width, entry.Key, entry.Value, entry.Source)
+	}
+	log.Print(b.String())
+
+	for _, warning := range configWarnings(cfg) {
+		log.Printf("Warning: %s", warning)
+	}
+}
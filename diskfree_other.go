@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+func diskFreeBytes(path string) (uint64, error) {
+	return 0, errors.New("free space check is not supported on " + runtime.GOOS)
+}
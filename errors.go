@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Error codes. Every error response carries one in "code" next to the
+// human-readable "detail", so clients can branch on the cause and show their
+// own, localised message. Codes are stable; detail wording may change.
+const (
+	errCodeInvalidParameter    = "ERR_INVALID_PARAMETER"
+	errCodeMissingFile         = "ERR_MISSING_FILE"
+	errCodeUnsupportedFormat   = "ERR_UNSUPPORTED_FORMAT"
+	errCodeTooManyFiles        = "ERR_TOO_MANY_FILES"
+	errCodeUploadTooLarge      = "ERR_UPLOAD_TOO_LARGE"
+	errCodeMergeFailed         = "ERR_MERGE_FAILED"
+	errCodeParseFailed         = "ERR_PARSE_FAILED"
+	errCodeNoStats             = "ERR_NO_STATS"
+	errCodeFeatureDisabled     = "ERR_FEATURE_DISABLED"
+	errCodeNotFound            = "ERR_NOT_FOUND"
+	errCodeStorageUnavailable  = "ERR_STORAGE_UNAVAILABLE"
+	errCodeBusy                = "ERR_BUSY"
+	errCodeAnalysisTimeout     = "ERR_ANALYSIS_TIMEOUT"
+	errCodeShuttingDown        = "ERR_SHUTTING_DOWN"
+	errCodeAPIKeyMissing       = "ERR_API_KEY_MISSING"
+	errCodeAPIKeyInvalid       = "ERR_API_KEY_INVALID"
+	errCodeServerMisconfigured = "ERR_SERVER_MISCONFIGURED"
+	errCodeInternal            = "ERR_INTERNAL"
+	errCodeIdempotencyKeyReuse = "ERR_IDEMPOTENCY_KEY_REUSED"
+	errCodeDuplicateUpload     = "ERR_DUPLICATE_UPLOAD"
+)
+
+// Error codes for a result that came back but is incomplete, sent in the
+// result's "error_code" next to "error".
+const (
+	errCodeNoMessages  = "ERR_NO_MESSAGES"
+	errCodeStatsFailed = "ERR_STATS_FAILED"
+	errCodeAIFailed    = "ERR_AI_FAILED"
+	errCodeAITimeout   = "ERR_AI_TIMEOUT"
+)
+
+// analysisErrorCode is the code for an analysis that failed outright.
+func analysisErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrAIQueueTimeout):
+		return errCodeBusy
+	case errors.Is(err, context.DeadlineExceeded):
+		return errCodeAnalysisTimeout
+	default:
+		// Strict mode's ParseRatioError, or the file could not be read.
+		return errCodeParseFailed
+	}
+}
+
+// aiErrorCode tells a call to the AI provider that timed out from one that
+// failed some other way, or never got an AI worker at all.
+func aiErrorCode(err error) string {
+	if errors.Is(err, ErrAIQueueTimeout) {
+		return errCodeBusy
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errCodeAITimeout
+	}
+	return errCodeAIFailed
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxFieldPaths caps how many paths one fields parameter may list.
+const maxFieldPaths = 50
+
+// fieldTree is a parsed fields selection: each key is kept, and a nil subtree
+// keeps the whole value under it.
+type fieldTree map[string]fieldTree
+
+// parseFieldSelection reads the fields query parameter, a comma-separated
+// list of dotted JSON paths such as "stats.common_words,ai_analysis". It
+// returns nil when no fields were asked for.
+func parseFieldSelection(raw string) (fieldTree, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	tree := make(fieldTree)
+	paths := 0
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if paths++; paths > maxFieldPaths {
+			return nil, fmt.Errorf("at most %d fields can be selected", maxFieldPaths)
+		}
+		segments := strings.Split(path, ".")
+		node := tree
+		for i, segment := range segments {
+			if segment == "" {
+				return nil, fmt.Errorf("'%s' is not a valid field path", path)
+			}
+			if i == len(segments)-1 {
+				node[segment] = nil
+				break
+			}
+			child, ok := node[segment]
+			if ok && child == nil {
+				// A shorter path already keeps this whole value.
+				break
+			}
+			if !ok {
+				child = make(fieldTree)
+				node[segment] = child
+			}
+			node = child
+		}
+	}
+	if len(tree) == 0 {
+		return nil, nil
+	}
+	return tree, nil
+}
+
+var alwaysSelected = []string{"error", "error_code", "ai_status", "ai_result_url", "analysis_id"}
+
+// selectFields prunes an encoded JSON object down to the selected paths.
+// Paths that don't exist are left out, and the top-level alwaysSelected
+// fields are kept so a client asking for a few stats still learns why they
+// are missing, or where the pending AI analysis will be.
+func selectFields(data []byte, fields fieldTree) ([]byte, error) {
+	if fields == nil {
+		return data, nil
+	}
+	for _, name := range alwaysSelected {
+		if _, ok := fields[name]; !ok {
+			fields[name] = nil
+		}
+	}
+	pruned, ok, err := pruneJSON(data, fields)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return []byte("{}"), nil
+	}
+	return pruned, nil
+}
+
+// pruneJSON keeps the parts of value named by fields. It reports false when
+// the value is not an object but the selection reaches into it.
+func pruneJSON(value json.RawMessage, fields fieldTree) (json.RawMessage, bool, error) {
+	if fields == nil {
+		return value, true, nil
+	}
+	if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		return value, true, nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(value, &object); err != nil {
+		return nil, false, nil
+	}
+
+	kept := make(map[string]json.RawMessage, len(fields))
+	for key, subtree := range fields {
+		child, ok := object[key]
+		if !ok {
+			continue
+		}
+		pruned, ok, err := pruneJSON(child, subtree)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			kept[key] = pruned
+		}
+	}
+	encoded, err := json.Marshal(kept)
+	if err != nil {
+		return nil, false, err
+	}
+	return encoded, true, nil
+}
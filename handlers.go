@@ -1,29 +1,155 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic" // Added for reading activeAICallsCount
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 var ErrAIQueueTimeout = errors.New("AI analysis queue is full, server is busy")
 
+const groqPingTimeout = 10 * time.Second
+
+// healthCheckHandler reports queue and worker load, uptime, build info, free
+// space in the temp dir when uploads are saved for debugging, and the last
+// known Groq status. /health is public, so paths and error messages are only
+// shown to requests with the admin key. With ?deep=true, which needs the
+// admin key because it spends Groq quota, it also pings Groq and answers 503
+// if the ping fails.
 func healthCheckHandler(c *gin.Context) {
+	deep, ok := parseBoolParam(c, "deep", c.Query("deep"), fmt.Sprintf("[Health from %s]", c.ClientIP()))
+	if !ok {
+		return
+	}
+	admin := isAdminRequest(c)
+	if deep && !admin {
+		abortAdminOnly(c, "The deep health check")
+		return
+	}
+
 	queuedAITasks := len(aiTaskQueue)
-	maxConcurrentAITasks := cap(aiTaskQueue)
+	maxConcurrentAITasks := currentAIWorkers()
 	processingAITasks := atomic.LoadInt32(&activeAICallsCount)
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"status":                   "ok",
+		"version":                  buildVersion,
+		"commit":                   buildCommit,
+		"uptime_seconds":           int64(time.Since(serverStartTime).Seconds()),
 		"ai_tasks_queued":          queuedAITasks,
 		"ai_tasks_processing":      processingAITasks,
 		"ai_tasks_worker_capacity": maxConcurrentAITasks,
+	}
+	if config.DebugSaveUploads {
+		tempDir := gin.H{}
+		if admin {
+			tempDir["path"] = config.TempDirRoot
+		}
+		if freeBytes, err := diskFreeBytes(config.TempDirRoot); err != nil {
+			if admin {
+				tempDir["error"] = err.Error()
+			}
+		} else {
+			tempDir["free_bytes"] = freeBytes
+		}
+		response["temp_dir"] = tempDir
+	}
+
+	statusCode := http.StatusOK
+	if atomic.LoadInt32(&draining) != 0 {
+		// Tell load balancers to stop sending uploads here.
+		response["status"] = "draining"
+		statusCode = http.StatusServiceUnavailable
+	}
+	if deep {
+		pingCtx, cancel := context.WithTimeout(c.Request.Context(), groqPingTimeout)
+		defer cancel()
+
+		started := time.Now()
+		ping := gin.H{"ok": true}
+		if err := pingGroq(pingCtx); err != nil {
+			log.Printf("Deep health check: Groq ping failed: %v", err)
+			ping["ok"] = false
+			ping["error"] = err.Error()
+			response["status"] = "degraded"
+			statusCode = http.StatusServiceUnavailable
+		}
+		ping["latency_ms"] = time.Since(started).Milliseconds()
+		response["groq_ping"] = ping
+	}
+	groq := currentGroqHealth()
+	if !admin {
+		groq = groq.withoutErrors()
+	}
+	response["groq"] = groq
+
+	c.JSON(statusCode, response)
+}
+
+// isAdminRequest reports whether the request carries ADMIN_API_KEY.
+func isAdminRequest(c *gin.Context) bool {
+	return config.AdminAPIKey != "" && c.GetHeader("X-API-Key") == config.AdminAPIKey
+}
+
+// abortAdminOnly turns away a request for something that needs the admin key,
+// the way apiKeyAuthMiddleware would.
+func abortAdminOnly(c *gin.Context, what string) {
+	switch {
+	case config.AdminAPIKey == "":
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"code": errCodeFeatureDisabled, "detail": what + " needs ADMIN_API_KEY, which is not set on this server."})
+	case c.GetHeader("X-API-Key") == "":
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": errCodeAPIKeyMissing, "detail": "API key is missing"})
+	default:
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": errCodeAPIKeyInvalid, "detail": "Invalid API key"})
+	}
+}
+
+// versionHandler identifies the exact build and what this instance has
+// switched on, so a bug report can say which capabilities were in play.
+func versionHandler(c *gin.Context) {
+	aiProviders := []string{}
+	if currentAISettings().apiKey != "" {
+		aiProviders = append(aiProviders, "groq")
+	}
+
+	importers := []string{"upload"}
+	if config.Watch.Dir != "" {
+		importers = append(importers, "watch_dir")
+	}
+	if config.Watch.IMAPHost != "" {
+		importers = append(importers, "watch_imap")
+	}
+
+	storageBackend := config.Storage.Backend
+	if storageBackend == "" {
+		storageBackend = "none"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"version":        buildVersion,
+		"commit":         buildCommit,
+		"build_date":     buildDate,
+		"schema_version": bundleSchemaVersion,
+		"features": gin.H{
+			"ai_providers":     aiProviders,
+			"importers":        importers,
+			"presets":          presetNames(),
+			"response_formats": []string{responseFormatJSON, responseFormatBundle},
+			"storage":          storageBackend,
+		},
 	})
 }
 
@@ -31,53 +157,290 @@ func analyzeHandler(c *gin.Context) {
 	clientHost := c.ClientIP()
 	logPrefix := fmt.Sprintf("[Req from %s]", clientHost)
 
-	// get file header
-	fileHeader, err := c.FormFile("file")
+	form, err := readAnalysisForm(c.Request)
 	if err != nil {
-		log.Printf("%s Error getting form file: %v", logPrefix, err)
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"detail": "Could not get file from request"})
+		abortFormError(c, err, logPrefix)
 		return
 	}
 
-	filename := fileHeader.Filename
+	filename := form.filename
 	logPrefix = fmt.Sprintf("[Req from %s | File: %s]", clientHost, filename)
-	log.Printf("%s Received analysis request. Content-Type: %s", logPrefix, fileHeader.Header.Get("Content-Type"))
+	log.Printf("%s Received analysis request. Content-Type: %s, %d bytes", logPrefix, form.contentType, len(form.data))
 
 	// validate filename
 	if filename == "" {
 		log.Printf("%s Filename is empty.", logPrefix)
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"detail": "Filename cannot be empty."})
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeMissingFile, "detail": "Filename cannot be empty."})
 		return
 	}
 	if !strings.HasSuffix(strings.ToLower(filename), ".txt") {
 		log.Printf("%s Invalid file extension: %s", logPrefix, filename)
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"detail": "Invalid file extension. Please upload a .txt file."})
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeUnsupportedFormat, "detail": "Invalid file extension. Please upload a .txt file."})
+		return
+	}
+
+	var mergeReport *MergeReport
+	if len(form.moreFiles) > 0 {
+		if len(form.moreFiles)+1 > maxMergeExports {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeTooManyFiles, "detail": fmt.Sprintf("Too many files. Up to %d exports of the same chat can be merged.", maxMergeExports)})
+			return
+		}
+		exports := [][]byte{form.data}
+		for _, file := range form.moreFiles {
+			if !strings.HasSuffix(strings.ToLower(file.filename), ".txt") {
+				log.Printf("%s Invalid file extension: %s", logPrefix, file.filename)
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeUnsupportedFormat, "detail": "Invalid file extension. Please upload a .txt file."})
+				return
+			}
+			exports = append(exports, file.data)
+		}
+		merged, report, err := mergeExports(exports, config.MaxLineBytes)
+		if err != nil {
+			log.Printf("%s Merging %d exports failed: %v", logPrefix, len(exports), err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeMergeFailed, "detail": fmt.Sprintf("Could not merge exports: %v", err)})
+			return
+		}
+		log.Printf("%s Merged %d exports into %d messages, dropped %d duplicates.", logPrefix, report.Files, report.Messages, report.DuplicatesDropped)
+		form.data, form.moreFiles = merged, nil
+		mergeReport = report
+	}
+
+	preset := strings.TrimSpace(form.fields[presetField])
+	if preset != "" && !applyPreset(preset, form.fields) {
+		log.Printf("%s Unknown preset: %s", logPrefix, preset)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Unknown preset '%s'.", preset)})
+		return
+	}
+
+	tone := strings.ToLower(strings.TrimSpace(form.fields["tone"]))
+	if tone != "" && !isValidAITone(tone) {
+		log.Printf("%s Invalid tone: %s", logPrefix, tone)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid tone '%s'. Allowed tones: %s.", tone, strings.Join(aiTones, ", "))})
+		return
+	}
+
+	aiModel := strings.TrimSpace(form.fields["ai_model"])
+	if aiModel != "" && !isAllowedAIModel(aiModel) {
+		log.Printf("%s Model not allowed: %s", logPrefix, aiModel)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Model '%s' is not allowed. Allowed models: %s.", aiModel, strings.Join(currentAISettings().selectableAIModels(), ", "))})
+		return
+	}
+
+	aiRoles, ok := formBool(c, form, "ai_roles", logPrefix)
+	if !ok {
+		return
+	}
+
+	keepNames, ok := formBool(c, form, "keep_names", logPrefix)
+	if !ok {
 		return
 	}
 
-	uploadedFile, err := fileHeader.Open()
+	excludeBots, ok := formBool(c, form, "exclude_bots", logPrefix)
+	if !ok {
+		return
+	}
+
+	collapseForwards, ok := formBool(c, form, "collapse_forwards", logPrefix)
+	if !ok {
+		return
+	}
+
+	profanity, ok := formBool(c, form, "profanity", logPrefix)
+	if !ok {
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(form.fields["format"]))
+	if format != "" && format != responseFormatJSON && format != responseFormatBundle {
+		log.Printf("%s Invalid format: %s", logPrefix, format)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid format '%s'. Use %s or %s.", format, responseFormatJSON, responseFormatBundle)})
+		return
+	}
+
+	saveUpload, ok := formBool(c, form, "save_upload", logPrefix)
+	if !ok {
+		return
+	}
+	if saveUpload && resultStore == nil {
+		log.Printf("%s save_upload requested but storage is disabled.", logPrefix)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeFeatureDisabled, "detail": "Saving uploads is not enabled on this server."})
+		return
+	}
+
+	detach, ok := formBool(c, form, "detach", logPrefix)
+	if !ok {
+		return
+	}
+	if detach && resultStore == nil {
+		log.Printf("%s detach requested but storage is disabled.", logPrefix)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeFeatureDisabled, "detail": "Detached analysis needs result storage, which is not enabled on this server."})
+		return
+	}
+
+	aiAsync, ok := formBool(c, form, "ai_async", logPrefix)
+	if !ok {
+		return
+	}
+	if aiAsync && resultStore == nil {
+		log.Printf("%s ai_async requested but storage is disabled.", logPrefix)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeFeatureDisabled, "detail": "ai_async needs result storage, which is not enabled on this server."})
+		return
+	}
+
+	digest := strings.ToLower(strings.TrimSpace(form.fields["digest"]))
+	if digest != "" && !isValidDigestPeriod(digest) {
+		log.Printf("%s Invalid digest: %s", logPrefix, digest)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid digest '%s'. Use %s or %s.", digest, digestWeekly, digestMonthly)})
+		return
+	}
+	digestAI, ok := formBool(c, form, "digest_ai", logPrefix)
+	if !ok {
+		return
+	}
+	if digestAI && digest == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": "digest_ai needs a digest period (weekly or monthly)."})
+		return
+	}
+
+	strict, ok := formBool(c, form, "strict", logPrefix)
+	if !ok {
+		return
+	}
+	minParsePct := 0
+	if strict {
+		minParsePct = config.StrictMinParsePct
+	}
+
+	convoBreakMinutes := 0
+	if raw := strings.TrimSpace(form.fields["convo_break_minutes"]); raw != "" {
+		convoBreakMinutes, err = strconv.Atoi(raw)
+		if err != nil || convoBreakMinutes < minConvoBreakOverride || convoBreakMinutes > maxConvoBreakOverride {
+			log.Printf("%s Invalid convo_break_minutes value: %s", logPrefix, raw)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid convo_break_minutes value '%s'. Use a whole number of minutes from %d to %d.", raw, minConvoBreakOverride, maxConvoBreakOverride)})
+			return
+		}
+	}
+
+	var changeDate time.Time
+	if raw := strings.TrimSpace(form.fields["change_date"]); raw != "" {
+		changeDate, err = time.Parse("2006-01-02", raw)
+		if err != nil {
+			log.Printf("%s Invalid change_date value: %s", logPrefix, raw)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid change_date value '%s'. Use a date like 2024-03-01.", raw)})
+			return
+		}
+	}
+
+	topWords, err := parseTopN(c.Query("top_words"), maxTopWords)
 	if err != nil {
-		log.Printf("%s Error opening uploaded file header: %v", logPrefix, err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"detail": "Server error: Failed to open uploaded file."})
+		log.Printf("%s Invalid top_words value: %s", logPrefix, c.Query("top_words"))
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid top_words value '%s'. Use a whole number from 1 to %d.", c.Query("top_words"), maxTopWords)})
+		return
+	}
+	topEmojis, err := parseTopN(c.Query("top_emojis"), maxTopEmojis)
+	if err != nil {
+		log.Printf("%s Invalid top_emojis value: %s", logPrefix, c.Query("top_emojis"))
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid top_emojis value '%s'. Use a whole number from 1 to %d.", c.Query("top_emojis"), maxTopEmojis)})
+		return
+	}
+
+	fields, err := parseFieldSelection(c.Query("fields"))
+	if err != nil {
+		log.Printf("%s Invalid fields: %v", logPrefix, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid fields: %v.", err)})
+		return
+	}
+	if fields != nil && format == responseFormatBundle {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": "fields cannot be combined with format=bundle."})
+		return
+	}
+
+	denylist, err := parseDenylist(form.fields["denylist"])
+	if err != nil {
+		log.Printf("%s Invalid denylist: %v", logPrefix, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid denylist: %v.", err)})
+		return
+	}
+
+	keywords, err := parseKeywords(form.fields["keywords"])
+	if err != nil {
+		log.Printf("%s Invalid keywords: %v", logPrefix, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid keywords: %v.", err)})
+		return
+	}
+
+	contactNames, err := parseContactNames(form.fields[contactNamesField])
+	if err != nil {
+		log.Printf("%s Invalid names mapping: %v", logPrefix, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid names mapping: %v.", err)})
+		return
+	}
+	aliases, err := parseSenderAliases(form.fields["aliases"])
+	if err != nil {
+		log.Printf("%s Invalid aliases: %v", logPrefix, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid aliases: %v.", err)})
+		return
+	}
+	contactNames = contactNames.withAliases(aliases)
+
+	if config.DebugSaveUploads {
+		if savedPath, err := saveUploadForDebug(config.TempDirRoot, filename, form.data); err != nil {
+			log.Printf("%s Warning: Failed to save upload for debugging: %v", logPrefix, err)
+		} else {
+			log.Printf("%s Saved upload for debugging: %s", logPrefix, savedPath)
+		}
+	}
+
+	opts := AnalysisOptions{Tone: tone, AIModel: aiModel, AIRoles: aiRoles, Denylist: denylist, KeepNames: keepNames, Digest: digest, DigestAI: digestAI, ConvoBreakMinutes: convoBreakMinutes, MinParsePct: minParsePct, ContactNames: contactNames, Keywords: keywords, ExcludeBots: excludeBots, TopWords: topWords, TopEmojis: topEmojis, CollapseForwards: collapseForwards, ChangeDate: changeDate, Profanity: profanity}
+
+	if detach {
+		id, err := newAnalysisID()
+		if err != nil {
+			log.Printf("%s Could not generate analysis ID: %v", logPrefix, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": "Could not start the analysis."})
+			return
+		}
+		var upload []byte
+		if saveUpload {
+			upload = form.data
+		}
+		pendingAnalyses.Store(id, struct{}{})
+		detachedWg.Add(1)
+		// The analysis keeps the MAX_CONCURRENT_ANALYSES slot this request
+		// passed concurrencyLimitMiddleware with.
+		atomic.AddInt32(&detachedAnalyses, 1)
+		go runDetachedAnalysis(id, form.data, filename, opts, preset, mergeReport, upload, logPrefix)
+		log.Printf("%s Detached analysis %s started.", logPrefix, id)
+		c.JSON(http.StatusAccepted, gin.H{"analysis_id": id, "status": analysisStatusProcessing})
 		return
 	}
-	defer uploadedFile.Close()
 
 	analysisCtx, analysisCancel := context.WithTimeout(c.Request.Context(), config.AnalysisTimeout)
 	defer analysisCancel()
 
-	results, err := AnalyzeChat(analysisCtx, uploadedFile, filename, aiTaskQueue, config.AIQueueTimeout)
-	log.Printf("%s Analysis completed: %s with %d messages", logPrefix, results.ChatName, results.TotalMessages)
-
+	// With ai_async the stats are answered without waiting for the AI, whose
+	// tasks run detached and are stored with these stats once they finish.
+	statsOpts := opts
+	if aiAsync {
+		statsOpts.DeferAI = true
+	}
+	results, err := AnalyzeChat(analysisCtx, bytes.NewReader(form.data), filename, aiTaskQueue, currentAIQueueTimeout(), config.MaxLineBytes, statsOpts)
 	if err != nil {
 		if errors.Is(err, ErrAIQueueTimeout) {
 			log.Printf("%s AI Queue Timeout: %v", logPrefix, err)
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"detail": fmt.Sprintf("Server is busy processing AI requests, please try again later. (Queue wait > %s)", config.AIQueueTimeout)})
+			abortAIQueueBusy(c)
+			return
+		}
+
+		var ratioErr *ParseRatioError
+		if errors.As(err, &ratioErr) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"code": errCodeParseFailed, "detail": fmt.Sprintf("Strict mode: %s.", err.Error()), "diagnostics": ratioErr.Diagnostics})
 			return
 		}
 
 		log.Printf("%s AnalyzeChat setup/preprocessing failed: %v", logPrefix, err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"detail": fmt.Sprintf("Analysis setup failed: %s", err.Error())})
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeParseFailed, "detail": fmt.Sprintf("Analysis setup failed: %s", err.Error())})
 		return
 	}
 
@@ -86,25 +449,528 @@ func analyzeHandler(c *gin.Context) {
 		log.Printf("%s Analysis context ended after AnalyzeChat returned: %v", logPrefix, analysisCtx.Err())
 
 		if errors.Is(analysisCtx.Err(), context.DeadlineExceeded) {
-			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"detail": fmt.Sprintf("Analysis processing timed out after %s.", config.AnalysisTimeout)})
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"code": errCodeAnalysisTimeout, "detail": fmt.Sprintf("Analysis processing timed out after %s.", config.AnalysisTimeout)})
 		} else {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"detail": "Analysis context error after processing."})
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": "Analysis context error after processing."})
 		}
 		return
 	default:
 	}
 
+	if results != nil && results.deferredAI != nil {
+		id, err := newAnalysisID()
+		if err != nil {
+			log.Printf("%s Could not generate analysis ID: %v", logPrefix, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": "Could not start the AI analysis."})
+			return
+		}
+		var upload []byte
+		if saveUpload {
+			upload = form.data
+		}
+		results.Preset = preset
+		results.Merge = mergeReport
+		pendingAnalyses.Store(id, struct{}{})
+		detachedWg.Add(1)
+		go runDeferredAI(id, detachedCopy(results), results.deferredAI, upload, logPrefix)
+		log.Printf("%s Stats ready; AI analysis %s continues detached.", logPrefix, id)
+
+		results.ID = id
+		results.AIStatus = aiStatusPending
+		results.AIResultURL = "/results/" + id
+		writeAnalysisResponse(c, results, format, fields, logPrefix)
+		return
+	}
+
+	if results != nil {
+		log.Printf("%s Analysis completed: %s with %d messages", logPrefix, results.ChatName, results.TotalMessages)
+		results.Preset = preset
+		results.Merge = mergeReport
+		if resultStore != nil {
+			var upload []byte
+			if saveUpload {
+				upload = form.data
+			}
+			persistAnalysis(c.Request.Context(), resultStore, results, upload, logPrefix)
+		}
+	}
+
 	if results != nil && results.Error != "" {
 		log.Printf("%s Analysis completed with internal errors: %s", logPrefix, results.Error)
-		c.JSON(http.StatusOK, results)
+		writeAnalysisResponse(c, results, format, fields, logPrefix)
 		return
 	}
 
 	if results != nil {
 		log.Printf("%s Analysis successful.", logPrefix)
-		c.JSON(http.StatusOK, results)
+		writeAnalysisResponse(c, results, format, fields, logPrefix)
 	} else {
 		log.Printf("%s Analysis returned nil result and nil error unexpectedly.", logPrefix)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"detail": "Analysis failed unexpectedly."})
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": "Analysis failed unexpectedly."})
+	}
+}
+
+const (
+	analysisStatusProcessing = "processing"
+	aiStatusPending          = "pending"
+)
+
+// A stored result and its wrapped GIF never change once written, so the
+// client may keep them for good. They sit behind the API key, so shared
+// caches may not. The 202 for a result still pending must not be kept at all.
+const (
+	storedResultCacheControl  = "private, max-age=31536000, immutable"
+	pendingResultCacheControl = "no-store"
+)
+
+var (
+	// detachedCtx is the parent of analyses started with detach=true, which
+	// keep running when their client disconnects. Shutdown cancels it and
+	// waits on detachedWg so they store what they have before the AI queue
+	// closes.
+	detachedCtx, stopDetached = context.WithCancel(context.Background())
+	detachedWg                sync.WaitGroup
+	// pendingAnalyses holds the IDs of detached analyses not yet stored.
+	pendingAnalyses sync.Map
+)
+
+func countPendingAnalyses() int {
+	count := 0
+	pendingAnalyses.Range(func(_, _ any) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// abortAIQueueBusy answers 429 for a request that gave up waiting for an AI
+// worker, with where a retry would stand in line and, once tasks have been
+// timed, about how long it would wait.
+func abortAIQueueBusy(c *gin.Context) {
+	position, wait := aiQueueEstimate()
+	body := gin.H{
+		"code":           errCodeBusy,
+		"detail":         fmt.Sprintf("Server is busy processing AI requests, please try again later. (Queue wait > %s)", currentAIQueueTimeout()),
+		"queue_position": position,
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		body["estimated_wait_seconds"] = seconds
+		c.Header("Retry-After", strconv.Itoa(seconds))
+	}
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, body)
+}
+
+// runDetachedAnalysis analyses a chat independently of the request that sent
+// it and stores the result under id. A failure is stored as a result with
+// only an error, so a client polling the ID always gets an answer.
+func runDetachedAnalysis(id string, data []byte, filename string, opts AnalysisOptions, preset string, mergeReport *MergeReport, upload []byte, logPrefix string) {
+	defer detachedWg.Done()
+	defer pendingAnalyses.Delete(id)
+	defer atomic.AddInt32(&detachedAnalyses, -1)
+	logPrefix = fmt.Sprintf("%s [%s]", logPrefix, id)
+
+	ctx, cancel := context.WithTimeout(detachedCtx, config.AnalysisTimeout)
+	defer cancel()
+
+	results, err := AnalyzeChat(ctx, bytes.NewReader(data), filename, aiTaskQueue, currentAIQueueTimeout(), config.MaxLineBytes, opts)
+	if err != nil {
+		log.Printf("%s Detached analysis failed: %v", logPrefix, err)
+		results = &AnalysisResult{
+			ChatName:  deriveChatName(filename, []string{}),
+			Warnings:  []Warning{},
+			Error:     fmt.Sprintf("Analysis failed: %s", err.Error()),
+			ErrorCode: analysisErrorCode(err),
+		}
+	}
+	results.Preset = preset
+	results.Merge = mergeReport
+	storeAnalysis(context.Background(), resultStore, id, results, upload, logPrefix)
+}
+
+// runDeferredAI runs the AI tasks an ai_async request left for later and
+// stores results, the stats it was answered with, with their outcome added.
+func runDeferredAI(id string, results *AnalysisResult, ai *pendingAI, upload []byte, logPrefix string) {
+	defer detachedWg.Done()
+	defer pendingAnalyses.Delete(id)
+	logPrefix = fmt.Sprintf("%s [%s]", logPrefix, id)
+
+	ctx, cancel := context.WithTimeout(detachedCtx, config.AnalysisTimeout)
+	defer cancel()
+
+	if err := ai.enqueue(ctx, aiTaskQueue, currentAIQueueTimeout()); err != nil {
+		log.Printf("%s Deferred AI analysis could not be queued: %v", logPrefix, err)
+	}
+	ai.wait(ctx)
+	ai.apply(results)
+	storeAnalysis(context.Background(), resultStore, id, results, upload, logPrefix)
+}
+
+// detachedCopy copies what runDeferredAI changes on a result, so the
+// response can be written from the original while the AI runs.
+func detachedCopy(results *AnalysisResult) *AnalysisResult {
+	stored := *results
+	stored.deferredAI = nil
+	if results.Digest != nil {
+		digest := *results.Digest
+		stored.Digest = &digest
+	}
+	return &stored
+}
+
+// getResultHandler returns a stored analysis result by the analysis_id given
+// in the original response. A detached analysis still running answers 202
+// with its status.
+func getResultHandler(c *gin.Context) {
+	if resultStore == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"code": errCodeFeatureDisabled, "detail": "Result storage is not enabled on this server."})
+		return
+	}
+	id := c.Param("id")
+	if !analysisIDPattern.MatchString(id) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": "Invalid analysis ID."})
+		return
+	}
+	fields, err := parseFieldSelection(c.Query("fields"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid fields: %v.", err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	data, err := resultStore.Get(ctx, resultKey(id))
+	if errors.Is(err, errObjectNotFound) {
+		if _, pending := pendingAnalyses.Load(id); pending {
+			c.Header("Cache-Control", pendingResultCacheControl)
+			c.JSON(http.StatusAccepted, gin.H{"analysis_id": id, "status": analysisStatusProcessing})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"code": errCodeNotFound, "detail": "Analysis not found."})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load stored result %s: %v", id, err)
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"code": errCodeStorageUnavailable, "detail": "Could not load the stored result."})
+		return
+	}
+	if data, err = selectFields(data, fields); err != nil {
+		log.Printf("Failed to select fields of stored result %s: %v", id, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": "Could not read the stored result."})
+		return
+	}
+	c.Header("Cache-Control", storedResultCacheControl)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// getWrappedHandler returns an animated "wrapped" GIF of a stored result's
+// headline stats. The GIF is rendered on first request and stored next to
+// the result.
+func getWrappedHandler(c *gin.Context) {
+	if resultStore == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"code": errCodeFeatureDisabled, "detail": "Result storage is not enabled on this server."})
+		return
+	}
+	id := c.Param("id")
+	if !analysisIDPattern.MatchString(id) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": "Invalid analysis ID."})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), storageTimeout)
+	defer cancel()
+	if cached, err := resultStore.Get(ctx, wrappedKey(id)); err == nil {
+		c.Header("Cache-Control", storedResultCacheControl)
+		c.Data(http.StatusOK, "image/gif", cached)
+		return
+	}
+
+	data, err := resultStore.Get(ctx, resultKey(id))
+	if errors.Is(err, errObjectNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"code": errCodeNotFound, "detail": "Analysis not found."})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load stored result %s: %v", id, err)
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"code": errCodeStorageUnavailable, "detail": "Could not load the stored result."})
+		return
+	}
+	var result AnalysisResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		log.Printf("Failed to decode stored result %s: %v", id, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": "Could not read the stored result."})
+		return
+	}
+
+	rendered, err := renderWrappedGIF(&result)
+	if err != nil {
+		log.Printf("Failed to render wrapped GIF for %s: %v", id, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": "Could not render the wrapped GIF."})
+		return
+	}
+	if err := resultStore.Put(ctx, wrappedKey(id), rendered, "image/gif"); err != nil {
+		log.Printf("Failed to store wrapped GIF for %s: %v", id, err)
+	}
+	c.Header("Cache-Control", storedResultCacheControl)
+	c.Data(http.StatusOK, "image/gif", rendered)
+}
+
+// compareHandler compares two chats, sent either as two "file" parts or as
+// two stored analysis IDs in the result_ids field (comma separated). Uploaded
+// chats are analysed without AI and are not stored.
+func compareHandler(c *gin.Context) {
+	logPrefix := fmt.Sprintf("[Compare from %s]", c.ClientIP())
+
+	form, err := readMultipartForm(c.Request)
+	if err != nil {
+		abortFormError(c, err, logPrefix)
+		return
+	}
+
+	var ids []string
+	for _, id := range strings.Split(form.fields["result_ids"], ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	var files []formFile
+	if form.hasFile {
+		files = append([]formFile{{filename: form.filename, data: form.data}}, form.moreFiles...)
+	}
+
+	var sides []*AnalysisResult
+	switch {
+	case len(files) == 2 && len(ids) == 0:
+		analysisCtx, analysisCancel := context.WithTimeout(c.Request.Context(), config.AnalysisTimeout)
+		defer analysisCancel()
+		for _, file := range files {
+			if !strings.HasSuffix(strings.ToLower(file.filename), ".txt") {
+				log.Printf("%s Invalid file extension: %s", logPrefix, file.filename)
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeUnsupportedFormat, "detail": "Invalid file extension. Please upload a .txt file."})
+				return
+			}
+			result, err := AnalyzeChat(analysisCtx, bytes.NewReader(file.data), file.filename, aiTaskQueue, currentAIQueueTimeout(), config.MaxLineBytes, AnalysisOptions{NoAI: true})
+			if err != nil {
+				log.Printf("%s Analysing %s failed: %v", logPrefix, file.filename, err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeParseFailed, "detail": fmt.Sprintf("Analysis of '%s' failed: %s", file.filename, err.Error())})
+				return
+			}
+			sides = append(sides, result)
+		}
+	case len(ids) == 2 && len(files) == 0:
+		if resultStore == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"code": errCodeFeatureDisabled, "detail": "Result storage is not enabled on this server."})
+			return
+		}
+		for _, id := range ids {
+			if !analysisIDPattern.MatchString(id) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid analysis ID '%s'.", id)})
+				return
+			}
+			result, err := loadStoredResult(c.Request.Context(), resultStore, id)
+			if errors.Is(err, errObjectNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"code": errCodeNotFound, "detail": fmt.Sprintf("Analysis %s not found.", id)})
+				return
+			}
+			if err != nil {
+				log.Printf("%s Failed to load stored result %s: %v", logPrefix, id, err)
+				c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"code": errCodeStorageUnavailable, "detail": "Could not load the stored result."})
+				return
+			}
+			sides = append(sides, result)
+		}
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeMissingFile, "detail": "Send two chat files, or two analysis IDs in result_ids, to compare."})
+		return
+	}
+
+	for _, side := range sides {
+		if side.Stats == nil {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"code": errCodeNoStats, "detail": fmt.Sprintf("'%s' has no stats to compare.", side.ChatName)})
+			return
+		}
 	}
+	log.Printf("%s Compared %s with %s.", logPrefix, sides[0].ChatName, sides[1].ChatName)
+	c.JSON(http.StatusOK, compareResults(sides[0], sides[1]))
+}
+
+const (
+	responseFormatJSON   = "json"
+	responseFormatBundle = "bundle"
+)
+
+// writeAnalysisResponse sends the result as plain JSON, or with format=bundle
+// as a downloadable offline bundle.
+func writeAnalysisResponse(c *gin.Context, results *AnalysisResult, format string, fields fieldTree, logPrefix string) {
+	if fields != nil {
+		data, err := json.Marshal(results)
+		if err == nil {
+			data, err = selectFields(data, fields)
+		}
+		if err != nil {
+			log.Printf("%s Failed to select fields: %v", logPrefix, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": "Failed to encode the result."})
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+		return
+	}
+	if format != responseFormatBundle {
+		c.JSON(http.StatusOK, results)
+		return
+	}
+
+	bundle, err := buildAnalysisBundle(results, time.Now())
+	if err != nil {
+		log.Printf("%s Failed to build export bundle: %v", logPrefix, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": errCodeInternal, "detail": "Failed to build export bundle."})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", bundleFilename(results.ChatName)))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", bundle)
+}
+
+// formBool reads an optional true/false field of form, false when it is
+// absent. An invalid value aborts the request with ERR_INVALID_PARAMETER and
+// returns ok false.
+func formBool(c *gin.Context, form *analysisForm, name, logPrefix string) (value bool, ok bool) {
+	return parseBoolParam(c, name, form.fields[name], logPrefix)
+}
+
+// parseBoolParam is formBool for a value from anywhere in the request.
+func parseBoolParam(c *gin.Context, name, raw, logPrefix string) (bool, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return false, true
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("%s Invalid %s value: %s", logPrefix, name, raw)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Invalid %s value '%s'. Use true or false.", name, raw)})
+		return false, false
+	}
+	return value, true
+}
+
+// maxFormFieldBytes caps each non-file field of the analysis form.
+const maxFormFieldBytes = 64 * 1024
+
+// FormFieldError is a form field over maxFormFieldBytes.
+type FormFieldError struct {
+	Field string
+}
+
+func (e *FormFieldError) Error() string {
+	return fmt.Sprintf("form field '%s' exceeds %d bytes", e.Field, maxFormFieldBytes)
+}
+
+// abortFormError answers a request whose form could not be read: 413 for a
+// body over the upload limit, ERR_MISSING_FILE when it has no chat file, and
+// ERR_INVALID_PARAMETER for one that isn't a usable multipart form.
+func abortFormError(c *gin.Context, err error, logPrefix string) {
+	var fieldErr *FormFieldError
+	switch {
+	case isUploadTooLarge(err):
+		log.Printf("%s Rejected upload: body exceeds limit %d bytes.", logPrefix, config.MaxUploadSizeBytes)
+		abortUploadTooLarge(c, config.MaxUploadSizeBytes)
+	case errors.Is(err, http.ErrMissingFile):
+		log.Printf("%s Form has no chat file.", logPrefix)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeMissingFile, "detail": "Could not get file from request"})
+	case errors.As(err, &fieldErr):
+		log.Printf("%s Rejected form: %v", logPrefix, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": fmt.Sprintf("Form field '%s' is longer than %d bytes.", fieldErr.Field, maxFormFieldBytes)})
+	case errors.Is(err, http.ErrNotMultipart), errors.Is(err, http.ErrMissingBoundary):
+		log.Printf("%s Rejected form: %v", logPrefix, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": "Send the request as multipart/form-data."})
+	default:
+		log.Printf("%s Error reading form: %v", logPrefix, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": "Could not read the multipart form."})
+	}
+}
+
+// contactNamesField may be sent as a file (names.json or names.csv) or as a
+// plain field; either way it is read like any other field.
+const contactNamesField = "names"
+
+type analysisForm struct {
+	hasFile     bool
+	filename    string
+	contentType string
+	data        []byte
+	// moreFiles holds any further "file" parts: later exports of the same
+	// chat to merge with the first.
+	moreFiles []formFile
+	fields    map[string]string
+}
+
+type formFile struct {
+	filename string
+	data     []byte
+}
+
+// readAnalysisForm reads a multipart form that must carry a chat file.
+func readAnalysisForm(r *http.Request) (*analysisForm, error) {
+	form, err := readMultipartForm(r)
+	if err != nil {
+		return nil, err
+	}
+	if !form.hasFile {
+		return nil, http.ErrMissingFile
+	}
+	return form, nil
+}
+
+// readMultipartForm walks the multipart body part by part and keeps the chat
+// files in memory, unlike ParseMultipartForm which spills large files to disk.
+// The file isn't streamed into the parser: the fields that decide how to
+// analyse it may come after it, and detached analyses and saved uploads need
+// the bytes once the request is gone. The body is already capped by
+// limitUploadSizeMiddleware, so the read fails with a *http.MaxBytesError
+// rather than growing past the upload limit.
+func readMultipartForm(r *http.Request) (*analysisForm, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	form := &analysisForm{fields: make(map[string]string)}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := part.FormName()
+		switch {
+		case name == "file" && !form.hasFile:
+			form.filename = part.FileName()
+			form.contentType = part.Header.Get("Content-Type")
+			form.data, err = io.ReadAll(part)
+			form.hasFile = true
+		case name == "file":
+			file := formFile{filename: part.FileName()}
+			file.data, err = io.ReadAll(part)
+			form.moreFiles = append(form.moreFiles, file)
+		case name != "" && (part.FileName() == "" || name == contactNamesField):
+			var value []byte
+			value, err = io.ReadAll(io.LimitReader(part, maxFormFieldBytes+1))
+			if err == nil && len(value) > maxFormFieldBytes {
+				err = &FormFieldError{Field: name}
+			}
+			if _, seen := form.fields[name]; !seen {
+				form.fields[name] = string(value)
+			}
+		default:
+			_, err = io.Copy(io.Discard, part)
+		}
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return form, nil
 }
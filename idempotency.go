@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	duplicateUploadHeader     = "Duplicate-Upload"
+	maxIdempotencyKeyLength   = 255
+	// maxCachedResponses and maxCachedResponseBytes bound the memory each
+	// response cache holds. Once either is reached, new requests are served
+	// without being remembered.
+	maxCachedResponses     = 1000
+	maxCachedResponseBytes = 64 << 20
+	// requestFingerprintKey is where readRequestFingerprint leaves the hash
+	// in the gin context, so the body is only read into memory once.
+	requestFingerprintKey = "requestFingerprint"
+)
+
+// cachedResponse is a remembered response, or a request still running while
+// done is open.
+type cachedResponse struct {
+	fingerprint [sha256.Size]byte
+	done        chan struct{}
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+func (r *cachedResponse) isDone() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// responseCache holds successful responses to replay for a while. Expired
+// entries are swept on the next claim. bytes is the total size of the
+// bodies held.
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+	bytes   int
+}
+
+var (
+	idempotentResponses = &responseCache{entries: make(map[string]*cachedResponse)}
+	recentUploads       = &responseCache{entries: make(map[string]*cachedResponse)}
+)
+
+// claim returns the entry for key and whether it was already there. A new
+// entry is added, running, unless the cache is full; then it returns nil.
+func (rc *responseCache) claim(key string, fingerprint [sha256.Size]byte) (*cachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	for k, entry := range rc.entries {
+		if entry.isDone() && now.After(entry.expires) {
+			rc.bytes -= len(entry.body)
+			delete(rc.entries, k)
+		}
+	}
+	if entry, seen := rc.entries[key]; seen {
+		return entry, true
+	}
+	if len(rc.entries) >= maxCachedResponses || rc.bytes >= maxCachedResponseBytes {
+		return nil, false
+	}
+	entry := &cachedResponse{fingerprint: fingerprint, done: make(chan struct{})}
+	rc.entries[key] = entry
+	return entry, false
+}
+
+// record runs the rest of the chain and keeps its response in entry for ttl
+// when it is a 2xx and fits in the cache. Anything else is forgotten, so the
+// next try runs again.
+func (rc *responseCache) record(c *gin.Context, key string, entry *cachedResponse, ttl time.Duration) {
+	recorder := &recordingWriter{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	defer func() {
+		c.Writer = recorder.ResponseWriter
+		status := recorder.Status()
+		rc.mu.Lock()
+		size := recorder.body.Len()
+		if status >= 200 && status < 300 && rc.bytes+size <= maxCachedResponseBytes {
+			rc.bytes += size
+			entry.status = status
+			entry.contentType = recorder.Header().Get("Content-Type")
+			entry.body = recorder.body.Bytes()
+			entry.expires = time.Now().Add(ttl)
+		} else {
+			delete(rc.entries, key)
+		}
+		close(entry.done)
+		rc.mu.Unlock()
+	}()
+	c.Next()
+}
+
+// replay answers with a finished entry's response.
+func (r *cachedResponse) replay(c *gin.Context) {
+	c.Data(r.status, r.contentType, r.body)
+	c.Abort()
+}
+
+// recordingWriter keeps a copy of everything the handler writes. It sits
+// inside gzipMiddleware, so the copy is uncompressed and a replay is
+// compressed, or not, for the client asking.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// readRequestFingerprint reads the body into memory, puts it back for the
+// handler and hashes it with the query string, which carries options such as
+// top_words and fields. It aborts the request and returns false when the body
+// can't be read.
+func readRequestFingerprint(c *gin.Context) ([sha256.Size]byte, bool) {
+	if cached, ok := c.Get(requestFingerprintKey); ok {
+		return cached.([sha256.Size]byte), true
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		if isUploadTooLarge(err) {
+			abortUploadTooLarge(c, config.MaxUploadSizeBytes)
+			return [sha256.Size]byte{}, false
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": "Could not read the request body."})
+		return [sha256.Size]byte{}, false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	fingerprint := requestFingerprint(c.Request.URL.RawQuery, c.GetHeader("Content-Type"), body)
+	c.Set(requestFingerprintKey, fingerprint)
+	return fingerprint, true
+}
+
+// requestFingerprint hashes the query and the body, with the body's multipart
+// boundary taken out, since many clients pick a new random boundary for every
+// retry.
+func requestFingerprint(query, contentType string, body []byte) [sha256.Size]byte {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	if boundary := params["boundary"]; boundary != "" {
+		body = bytes.ReplaceAll(body, []byte(boundary), nil)
+	}
+	return sha256.Sum256(append([]byte(query+"\n"+mediaType+"\n"), body...))
+}
+
+// idempotencyMiddleware answers a POST that repeats the Idempotency-Key of an
+// earlier one, with the same query and body, with the earlier response instead of
+// running the analysis and its AI call again. A repeat that arrives while
+// the first is still running waits for it. Only 2xx responses are kept, for
+// ttl, so a retry after an error runs again. Keys are scoped to the path and
+// API key.
+func idempotencyMiddleware(ttl time.Duration, paths ...string) gin.HandlerFunc {
+	pathMap := make(map[string]bool)
+	for _, p := range paths {
+		pathMap[p] = true
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" || ttl <= 0 || c.Request.Method != http.MethodPost || !pathMap[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": errCodeInvalidParameter, "detail": "Idempotency-Key is too long; use at most 255 characters."})
+			return
+		}
+		fingerprint, ok := readRequestFingerprint(c)
+		if !ok {
+			return
+		}
+
+		scoped := c.Request.URL.Path + "\x00" + c.GetHeader("X-API-Key") + "\x00" + key
+		entry, seen := idempotentResponses.claim(scoped, fingerprint)
+		if entry == nil {
+			log.Printf("[%s] Idempotency cache is full; not remembering key.", c.ClientIP())
+			c.Next()
+			return
+		}
+		if !seen {
+			idempotentResponses.record(c, scoped, entry, ttl)
+			return
+		}
+		if entry.fingerprint != fingerprint {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"code": errCodeIdempotencyKeyReuse, "detail": "This Idempotency-Key was already used for a different request."})
+			return
+		}
+		select {
+		case <-entry.done:
+		case <-c.Request.Context().Done():
+			return
+		}
+		if entry.status == 0 {
+			// The first request failed and was forgotten; this one runs.
+			c.Next()
+			return
+		}
+		log.Printf("[%s] Replaying response for Idempotency-Key.", c.ClientIP())
+		c.Header(idempotencyReplayedHeader, "true")
+		entry.replay(c)
+	}
+}
+
+// duplicateUploadMiddleware catches the same upload, with the same form
+// fields and query string, sent again by the same client within window,
+// typically a frontend stuck in a retry loop. While the first is still running the repeat gets 429
+// with Retry-After; once it has succeeded the repeat gets its response back.
+// Clients are told apart by API key, or by IP when there is none.
+func duplicateUploadMiddleware(window time.Duration, paths ...string) gin.HandlerFunc {
+	pathMap := make(map[string]bool)
+	for _, p := range paths {
+		pathMap[p] = true
+	}
+
+	return func(c *gin.Context) {
+		if window <= 0 || c.Request.Method != http.MethodPost || !pathMap[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		fingerprint, ok := readRequestFingerprint(c)
+		if !ok {
+			return
+		}
+
+		client := c.GetHeader("X-API-Key")
+		if client == "" {
+			client = c.ClientIP()
+		}
+		key := c.Request.URL.Path + "\x00" + client + "\x00" + string(fingerprint[:])
+		entry, seen := recentUploads.claim(key, fingerprint)
+		if entry == nil {
+			c.Next()
+			return
+		}
+		if !seen {
+			recentUploads.record(c, key, entry, window)
+			return
+		}
+		if !entry.isDone() {
+			log.Printf("[%s] Rejecting duplicate upload while the first is still running.", c.ClientIP())
+			c.Header("Retry-After", strconv.Itoa(int(window/time.Second)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"code": errCodeDuplicateUpload, "detail": "The same upload is already being analysed. Wait for its result instead of sending it again."})
+			return
+		}
+		if entry.status == 0 {
+			c.Next()
+			return
+		}
+		log.Printf("[%s] Replaying response for a duplicate upload.", c.ClientIP())
+		c.Header(duplicateUploadHeader, "true")
+		entry.replay(c)
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,14 +19,63 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// buildVersion, buildCommit and buildDate are set at build time, e.g.
+// go build -ldflags "-X main.buildVersion=v1.2.0 -X main.buildCommit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
 var (
-	config             *Config
-	aiTaskQueue        chan aiTask
-	aiWorkerWg         sync.WaitGroup
-	activeAICallsCount int32 // New: counter for active AI calls
+	buildVersion = "dev"
+	buildCommit  = "unknown"
+	buildDate    = "unknown"
+)
+
+var (
+	config              *Config
+	serverStartTime     time.Time
+	aiTaskQueue         chan aiTask
+	resultStore         ObjectStore // nil when STORAGE_BACKEND is unset
+	aiWorkerWg          sync.WaitGroup
+	activeAICallsCount  int32 // New: counter for active AI calls
+	aiQueueWaiting      int32 // requests blocked waiting for a queue slot
+	aiTaskAvgNanos      int64 // moving average of AI task duration
+	aiQueueTimeoutNanos int64 // AI_QUEUE_TIMEOUT_SECONDS, adjustable at runtime
+	aiPaused            int32 // 1 while AI analysis is switched off at runtime
+	draining            int32 // 1 once shutdown has started turning uploads away
+	inFlightAnalyses    int32 // analyze and compare requests being served
+	runningAnalyses     int32 // analyze and compare requests past the API key check
+	detachedAnalyses    int32 // detach=true analyses still running after their request
+
+	// The AI worker count can change at runtime through /admin/settings.
+	// Each value sent on aiWorkerQuit stops one worker once it is idle.
+	aiWorkersMu     sync.Mutex
+	aiWorkerCount   int
+	aiWorkerNextID  int
+	aiWorkerQuit    chan struct{}
+	aiWorkersClosed bool
+	// aiQueueMu is held for reading while a task is being sent to the queue,
+	// so closeAIWorkers never closes it under a sender.
+	aiQueueMu sync.RWMutex
+)
+
+const (
+	// maxAIWorkers caps how many AI workers /admin/settings may ask for.
+	maxAIWorkers = 100
+	// drainPollInterval is how often shutdown checks for running analyses.
+	drainPollInterval = 100 * time.Millisecond
 )
 
 func main() {
+	cliPath := flag.String("cli", "", "analyze this chat export locally and print the JSON result instead of starting the server")
+	cliOut := flag.String("out", "", "with -cli, write the result to this file instead of stdout")
+	cliNoAI := flag.Bool("no-ai", false, "with -cli, never send messages to the AI even if GROQ_API_KEY is set")
+	flag.Parse()
+	if *cliPath != "" {
+		if err := runCLI(*cliPath, *cliOut, *cliNoAI); err != nil {
+			log.Fatalf("Analysis failed: %v", err)
+		}
+		return
+	}
+
+	serverStartTime = time.Now()
+
 	var err error
 	config, err = LoadConfig()
 	if err != nil {
@@ -32,17 +83,25 @@ func main() {
 	}
 
 	aiTaskQueue = make(chan aiTask, config.MaxConcurrentAICalls)
+	aiWorkerQuit = make(chan struct{}, max(config.MaxConcurrentAICalls, maxAIWorkers))
+	atomic.StoreInt64(&aiQueueTimeoutNanos, int64(config.AIQueueTimeout))
 
 	log.Printf("Starting %d AI worker goroutines...", config.MaxConcurrentAICalls)
-	aiWorkerWg.Add(config.MaxConcurrentAICalls)
-	for i := 0; i < config.MaxConcurrentAICalls; i++ {
-		go aiWorker(i, aiTaskQueue, &aiWorkerWg)
+	if err := resizeAIWorkers(config.MaxConcurrentAICalls); err != nil {
+		log.Fatalf("Failed to start AI workers: %v", err)
 	}
 	log.Printf("AI workers started.")
 
-	err = os.MkdirAll(config.TempDirRoot, 0755)
+	if config.DebugSaveUploads {
+		err = os.MkdirAll(config.TempDirRoot, 0755)
+		if err != nil {
+			log.Fatalf("Failed to create temporary directory %s: %v", config.TempDirRoot, err)
+		}
+	}
+
+	resultStore, err = newObjectStore(config.Storage)
 	if err != nil {
-		log.Fatalf("Failed to create temporary directory %s: %v", config.TempDirRoot, err)
+		log.Fatalf("Failed to set up %s storage: %v", config.Storage.Backend, err)
 	}
 
 	router := gin.Default()
@@ -52,39 +111,70 @@ func main() {
 	corsConfig.AllowOrigins = []string{"http://localhost:3000", "https://bloopit.vercel.app"}
 	corsConfig.AllowCredentials = true
 	corsConfig.AllowMethods = []string{"POST", "GET", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-API-Key"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-API-Key", "Idempotency-Key"}
 	router.Use(cors.New(corsConfig))
+	router.Use(gzipMiddleware())
 
 	router.GET("/health", healthCheckHandler)
+	router.GET("/version", versionHandler)
+	router.GET("/openapi.json", openAPIHandler)
+	router.GET("/docs", swaggerUIHandler)
 
 	analyzeGroup := router.Group("/")
-	analyzeGroup.Use(limitUploadSizeMiddleware(config.MaxUploadSizeBytes, "/analyze/"))
+	analyzeGroup.Use(drainMiddleware("/analyze/", "/compare"))
+	analyzeGroup.Use(limitUploadSizeMiddleware(config.MaxUploadSizeBytes, "/analyze/", "/compare"))
 	if config.APIKey != "" {
 		log.Println("API Key protection is ENABLED for /analyze/")
 		analyzeGroup.Use(apiKeyAuthMiddleware(config.APIKey))
 	} else {
 		log.Println("Warning: API Key protection is DISABLED for /analyze/ because VAL_API_KEY is not set.")
 	}
+	analyzeGroup.Use(concurrencyLimitMiddleware(config.MaxConcurrentAnalyses, "/analyze/", "/compare"))
+	analyzeGroup.Use(idempotencyMiddleware(config.IdempotencyTTL, "/analyze/", "/compare"))
+	analyzeGroup.Use(duplicateUploadMiddleware(config.DuplicateUploadWindow, "/analyze/", "/compare"))
 	analyzeGroup.POST("/analyze/", analyzeHandler)
+	analyzeGroup.POST("/compare", compareHandler)
+	analyzeGroup.GET("/results/:id", getResultHandler)
+	analyzeGroup.GET("/results/:id/wrapped.gif", getWrappedHandler)
+
+	if config.AdminAPIKey != "" {
+		adminGroup := router.Group("/admin")
+		adminGroup.Use(apiKeyAuthMiddleware(config.AdminAPIKey))
+		adminGroup.GET("/settings", getAdminSettingsHandler)
+		adminGroup.PATCH("/settings", updateAdminSettingsHandler)
+		adminGroup.POST("/cleanup", adminCleanupHandler)
+	}
+
+	watchCtx, watchCancel := context.WithCancel(context.Background())
+	defer watchCancel()
+	var watcherWg sync.WaitGroup
+	if config.Watch.enabled() {
+		if err := startWatchers(watchCtx, config.Watch, &watcherWg); err != nil {
+			log.Fatalf("Failed to start watchers: %v", err)
+		}
+	}
 
 	cleanupCtx, cleanupCancel := context.WithCancel(context.Background())
 	defer cleanupCancel()
-	go runPeriodicTempCleanup(cleanupCtx, config.TempDirRoot, config.MaxTempFileAge, config.MaxTempFileAge/2)
+	if config.DebugSaveUploads {
+		log.Printf("Warning: DEBUG_SAVE_UPLOADS is enabled; uploads are written to %s.", config.TempDirRoot)
+		go runPeriodicTempCleanup(cleanupCtx, config.TempDirRoot, config.MaxTempFileAge, config.MaxTempFileAge/2)
+	}
 
 	// start server
 	serverAddr := fmt.Sprintf("%s:%d", config.Host, config.Port)
+	// Every request's context derives from requestsCtx, so shutdown can cancel
+	// synchronous analyses still running after the drain timeout.
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	srv := &http.Server{
-		Addr:    serverAddr,
-		Handler: router,
+		Addr:        serverAddr,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return requestsCtx },
 	}
 
-	log.Printf("Server starting...")
-	log.Printf("Max concurrent AI calls: %d", config.MaxConcurrentAICalls)
-	log.Printf("AI queue timeout: %s", config.AIQueueTimeout)
-	log.Printf("Temporary directory: %s", config.TempDirRoot)
-	log.Printf("Max temp file age: %s", config.MaxTempFileAge)
-	log.Printf("Max upload size: %.1f MB", float64(config.MaxUploadSizeBytes)/(1024*1024))
-	log.Printf("Analysis timeout: %s", config.AnalysisTimeout)
+	log.Printf("Server starting (version %s, commit %s)...", buildVersion, buildCommit)
+	logConfigReport(config)
 	log.Printf("Listening on %s", serverAddr)
 
 	go func() {
@@ -93,15 +183,52 @@ func main() {
 		}
 	}()
 
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			reloadData()
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	signal.Stop(reload)
 	log.Println("Shutting down server...")
 
+	// Turn new uploads away and give the ones already running, detached
+	// analyses included, a chance to finish before anything is cancelled.
+	atomic.StoreInt32(&draining, 1)
+	log.Printf("Draining: waiting up to %s for running analyses...", config.DrainTimeout)
+	if waitForDrain(config.DrainTimeout) {
+		log.Println("All running analyses finished.")
+	} else {
+		log.Printf("Warning: %d analyses and %d detached analyses were still running after the drain timeout.", atomic.LoadInt32(&inFlightAnalyses), countPendingAnalyses())
+	}
+
+	cancelRequests()
 	cleanupCancel()
 
+	// Requests still running were just cancelled; wait for their handlers to
+	// return, so none is left to queue AI work once the queue is closed.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Warning: HTTP server did not shut down cleanly: %v", err)
+	}
+
+	// Watchers submit AI tasks, so they must stop before the queue is closed.
+	log.Println("Stopping watchers...")
+	watchCancel()
+	watcherWg.Wait()
+
+	log.Println("Stopping detached analyses...")
+	stopDetached()
+	detachedWg.Wait()
+
 	log.Println("Closing AI task queue...")
-	close(aiTaskQueue)
+	closeAIWorkers()
 	log.Println("Waiting for AI workers to finish...")
 	aiWorkerDone := make(chan struct{})
 	go func() {
@@ -115,24 +242,46 @@ func main() {
 		log.Println("Warning: AI workers did not finish gracefully within timeout.")
 	}
 
-	// Shutdown HTTP server
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
-	}
-
 	log.Println("Server exiting")
 }
 
-func aiWorker(id int, tasks <-chan aiTask, wg *sync.WaitGroup) {
+// waitForDrain polls until no analysis request or detached analysis is
+// running, and reports false if some still are after timeout.
+func waitForDrain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if atomic.LoadInt32(&inFlightAnalyses) == 0 && countPendingAnalyses() == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+}
+
+func aiWorker(id int, tasks <-chan aiTask, quit <-chan struct{}, wg *sync.WaitGroup) {
 	defer wg.Done()
 	log.Printf("AI Worker %d started", id)
-	for task := range tasks {
+	for {
+		var task aiTask
+		select {
+		case <-quit:
+			log.Printf("AI Worker %d stopped by resize. Active calls: %d", id, atomic.LoadInt32(&activeAICallsCount))
+			return
+		case next, ok := <-tasks:
+			if !ok {
+				log.Printf("AI Worker %d stopped. Final active calls: %d", id, atomic.LoadInt32(&activeAICallsCount))
+				return
+			}
+			task = next
+		}
 		atomic.AddInt32(&activeAICallsCount, 1) // Increment when task processing starts
 		log.Printf("[AI Worker %d] Processing task for %s. Active calls: %d", id, task.logPrefix, atomic.LoadInt32(&activeAICallsCount))
 
-		aiResult, aiErr := AnalyzeMessagesWithLLM(task.ctx, task.messagesData, task.gapHours)
+		started := time.Now()
+		aiResult, aiWarnings, aiErr := runAITask(task)
+		recordAITaskDuration(time.Since(started))
 
 		if errors.Is(aiErr, context.Canceled) {
 			log.Printf("[AI Worker %d] Task cancelled via context for %s", id, task.logPrefix)
@@ -148,11 +297,65 @@ func aiWorker(id int, tasks <-chan aiTask, wg *sync.WaitGroup) {
 		log.Printf("[AI Worker %d] Task finished for %s. Active calls: %d", id, task.logPrefix, atomic.LoadInt32(&activeAICallsCount))
 
 		select {
-		case task.resultChan <- aiResultTuple{result: aiResult, err: aiErr}:
+		case task.resultChan <- aiResultTuple{result: aiResult, warnings: aiWarnings, err: aiErr}:
 		default:
 			log.Printf("[AI Worker %d] Failed to send result back for %s (receiver might have timed out or cancelled)", id, task.logPrefix)
 		}
 		close(task.resultChan)
 	}
-	log.Printf("AI Worker %d stopped. Final active calls: %d", id, atomic.LoadInt32(&activeAICallsCount))
+}
+
+// resizeAIWorkers starts or stops workers until n are serving aiTaskQueue.
+// A worker asked to stop finishes the task it is on first.
+func resizeAIWorkers(n int) error {
+	aiWorkersMu.Lock()
+	defer aiWorkersMu.Unlock()
+	if aiWorkersClosed {
+		return errAIQueueClosed
+	}
+	for ; aiWorkerCount < n; aiWorkerCount++ {
+		// Take back a stop no worker has picked up yet before starting a
+		// new one, so pending stops never outnumber the quit buffer.
+		select {
+		case <-aiWorkerQuit:
+			continue
+		default:
+		}
+		aiWorkerWg.Add(1)
+		go aiWorker(aiWorkerNextID, aiTaskQueue, aiWorkerQuit, &aiWorkerWg)
+		aiWorkerNextID++
+	}
+	for ; aiWorkerCount > n; aiWorkerCount-- {
+		aiWorkerQuit <- struct{}{}
+	}
+	return nil
+}
+
+func currentAIWorkers() int {
+	aiWorkersMu.Lock()
+	defer aiWorkersMu.Unlock()
+	return aiWorkerCount
+}
+
+// closeAIWorkers closes the task queue so the workers exit once it is empty.
+func closeAIWorkers() {
+	aiQueueMu.Lock()
+	defer aiQueueMu.Unlock()
+	aiWorkersMu.Lock()
+	defer aiWorkersMu.Unlock()
+	aiWorkersClosed = true
+	close(aiTaskQueue)
+}
+
+// runAITask runs one task, reporting a panic as the task's error so the
+// worker keeps serving the queue.
+func runAITask(task aiTask) (result string, warnings warningList, err error) {
+	defer recoverAsError(&err, "AI task", task.logPrefix)
+	switch task.kind {
+	case aiTaskDigest:
+		result, err = WriteDigestParagraph(task.ctx, task.messagesData, task.gapHours, task.chatName, task.digestFacts, task.model)
+	default:
+		result, warnings, err = AnalyzeMessagesWithLLM(task.ctx, task.messagesData, task.gapHours, task.chatName, task.tone, task.model, task.notes, task.labelRoles)
+	}
+	return result, warnings, err
 }
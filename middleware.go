@@ -1,9 +1,15 @@
 package main
 
 import (
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,24 +18,28 @@ func apiKeyAuthMiddleware(requiredKey string) gin.HandlerFunc {
 	if requiredKey == "" {
 		log.Println("CRITICAL SERVER CONFIG ERROR: apiKeyAuthMiddleware applied, but VAL_API_KEY is not configured!")
 		return func(c *gin.Context) {
-			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"detail": "Server configuration error: API Key not set"})
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"code": errCodeServerMisconfigured, "detail": "Server configuration error: API Key not set"})
 		}
 	}
 
 	return func(c *gin.Context) {
 		providedKey := c.GetHeader("X-API-Key")
 		if providedKey == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"detail": "API key is missing"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": errCodeAPIKeyMissing, "detail": "API key is missing"})
 			return
 		}
 		if providedKey != requiredKey {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "Invalid API key"})
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": errCodeAPIKeyInvalid, "detail": "Invalid API key"})
 			return
 		}
 		c.Next()
 	}
 }
 
+// limitUploadSizeMiddleware rejects requests whose Content-Length is over the
+// limit up front, and caps the body itself so a missing or understated
+// Content-Length (e.g. chunked uploads) still fails once the limit is read.
+// Handlers must check read errors with isUploadTooLarge.
 func limitUploadSizeMiddleware(maxSizeBytes int64, paths ...string) gin.HandlerFunc {
 	pathMap := make(map[string]bool)
 	for _, p := range paths {
@@ -40,12 +50,169 @@ func limitUploadSizeMiddleware(maxSizeBytes int64, paths ...string) gin.HandlerF
 		if _, shouldCheck := pathMap[c.Request.URL.Path]; shouldCheck {
 			if c.Request.ContentLength > maxSizeBytes {
 				log.Printf("Rejected upload: Content-Length %d bytes exceeds limit %d bytes.", c.Request.ContentLength, maxSizeBytes)
-				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
-					"detail": fmt.Sprintf("Maximum request body size limit exceeded (%.1f MB)", float64(maxSizeBytes)/(1024*1024)),
-				})
+				abortUploadTooLarge(c, maxSizeBytes)
 				return
 			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSizeBytes)
 		}
 		c.Next()
 	}
 }
+
+// drainMiddleware turns new requests to the given paths away with 503 once
+// the server has started draining. It counts the ones in flight so shutdown
+// can wait for them to finish.
+func drainMiddleware(paths ...string) gin.HandlerFunc {
+	pathMap := make(map[string]bool)
+	for _, p := range paths {
+		pathMap[p] = true
+	}
+
+	return func(c *gin.Context) {
+		if _, shouldCount := pathMap[c.Request.URL.Path]; !shouldCount {
+			c.Next()
+			return
+		}
+		// Count first, so a request that passes the check is always seen by
+		// the drain.
+		atomic.AddInt32(&inFlightAnalyses, 1)
+		defer atomic.AddInt32(&inFlightAnalyses, -1)
+		if atomic.LoadInt32(&draining) != 0 {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"code": errCodeShuttingDown, "detail": "Server is shutting down, please try again in a moment."})
+			return
+		}
+		c.Next()
+	}
+}
+
+// analysesBusyRetryAfter is the Retry-After sent when MAX_CONCURRENT_ANALYSES
+// analyses are already running.
+const analysesBusyRetryAfter = 5 * time.Second
+
+// concurrencyLimitMiddleware answers 429 while maxRunning requests to the
+// given paths, detached analyses included, are already running. It goes after
+// the API key check so unauthenticated requests can't take up the slots.
+func concurrencyLimitMiddleware(maxRunning int, paths ...string) gin.HandlerFunc {
+	pathMap := make(map[string]bool)
+	for _, p := range paths {
+		pathMap[p] = true
+	}
+
+	return func(c *gin.Context) {
+		if _, shouldCount := pathMap[c.Request.URL.Path]; !shouldCount {
+			c.Next()
+			return
+		}
+		running := atomic.AddInt32(&runningAnalyses, 1)
+		defer atomic.AddInt32(&runningAnalyses, -1)
+		if int(running+atomic.LoadInt32(&detachedAnalyses)) > maxRunning {
+			log.Printf("[%s] Rejecting analysis: %d already running.", c.ClientIP(), maxRunning)
+			c.Header("Retry-After", strconv.Itoa(int(analysesBusyRetryAfter/time.Second)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"code": errCodeBusy, "detail": fmt.Sprintf("Server is busy with %d analyses, please try again in a moment.", maxRunning)})
+			return
+		}
+		c.Next()
+	}
+}
+
+func isUploadTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func abortUploadTooLarge(c *gin.Context, maxSizeBytes int64) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"code":   errCodeUploadTooLarge,
+		"detail": fmt.Sprintf("Maximum request body size limit exceeded (%.1f MB)", float64(maxSizeBytes)/(1024*1024)),
+	})
+}
+
+// gzipMiddleware compresses JSON and text responses for clients that send
+// Accept-Encoding: gzip. The choice is made at the first write, once the
+// handler has set the Content-Type, so images such as wrapped.gif are sent
+// as they are.
+func gzipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		writer := &gzipResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			if writer.gz != nil {
+				if err := writer.gz.Close(); err != nil {
+					log.Printf("Failed to finish gzip response: %v", err)
+				}
+			}
+			c.Writer = writer.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// acceptsGzip reads an Accept-Encoding header, honouring "gzip;q=0" as a
+// refusal.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(strings.TrimSpace(params), " ", ""), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func isCompressibleType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (w *gzipResponseWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || !isCompressibleType(header.Get("Content-Type")) {
+		return
+	}
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.gz == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gz.Write(data)
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
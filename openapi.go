@@ -0,0 +1,312 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/maps"
+)
+
+// The OpenAPI document is kept by hand next to the handlers it describes.
+// Enums and limits are read from the same constants the handlers validate
+// against, so they can't drift; anything else added to a handler needs a
+// line here too.
+
+// openAPIHandler serves the OpenAPI 3.0 description of the HTTP API.
+func openAPIHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPISpec())
+}
+
+// swaggerUIHandler serves Swagger UI for /openapi.json. The UI itself loads
+// from a CDN, so the binary doesn't have to carry it.
+func swaggerUIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+// swaggerUIVersion is the exact swagger-ui-dist release /docs loads, so a new
+// release on the CDN can't change the page without a change here.
+const swaggerUIVersion = "5.17.14"
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Bloop API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui.css" crossorigin="anonymous">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui-bundle.js" crossorigin="anonymous"></script>
+<script>SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+func openAPISpec() gin.H {
+	digestPeriods := maps.Keys(digestPeriodDays)
+	sort.Strings(digestPeriods)
+
+	apiKey := []gin.H{{"apiKey": []string{}}}
+	adminKey := []gin.H{{"adminKey": []string{}}}
+	errorResponse := func(description string) gin.H {
+		return gin.H{"description": description, "content": jsonContent(schemaRef("Error"))}
+	}
+	idParam := gin.H{
+		"name": "id", "in": "path", "required": true,
+		"description": "The analysis_id from an earlier response.",
+		"schema":      gin.H{"type": "string", "pattern": analysisIDPattern.String()},
+	}
+	fieldsParam := gin.H{
+		"name": "fields", "in": "query",
+		"description": "Comma-separated dotted paths to keep, e.g. stats.common_words,ai_analysis.",
+		"schema":      gin.H{"type": "string"},
+	}
+	idempotencyParam := gin.H{
+		"name": idempotencyKeyHeader, "in": "header",
+		"description": "Any unique string. A retry with the same key and body gets the first response back, with Idempotent-Replayed: true.",
+		"schema":      gin.H{"type": "string", "maxLength": maxIdempotencyKeyLength},
+	}
+
+	presetSchema := gin.H{"type": "string", "description": "Named bundle of the options below."}
+	// An empty enum is invalid, so presets are only listed when there are some.
+	if presets := presetNames(); len(presets) > 0 {
+		presetSchema["enum"] = presets
+	}
+
+	analyzeForm := gin.H{
+		"type":     "object",
+		"required": []string{"file"},
+		"properties": gin.H{
+			"file": gin.H{
+				"type": "array", "items": gin.H{"type": "string", "format": "binary"}, "maxItems": maxMergeExports,
+				"description": "The exported .txt chat. Send several to merge exports of the same chat.",
+			},
+			"preset":              presetSchema,
+			"tone":                gin.H{"type": "string", "enum": aiTones},
+			"ai_model":            gin.H{"type": "string", "enum": currentAISettings().selectableAIModels(), "description": "Run the AI on this model instead of GROQ_MODEL."},
+			"ai_roles":            boolSchema("Ask the AI to label group roles."),
+			"keep_names":          boolSchema("Keep participant names in word stats and AI input."),
+			"exclude_bots":        boolSchema("Leave detected bots out of the stats."),
+			"collapse_forwards":   boolSchema("Count forwarded content once in word and emoji stats."),
+			"profanity":           boolSchema("Add per-member swear word counts from the lists in data/profanity (stats.profanity)."),
+			"denylist":            gin.H{"type": "string", "description": "Comma-separated words or phrases to keep out of word stats and AI input."},
+			"keywords":            gin.H{"type": "string", "description": "Comma-separated keywords to track month by month."},
+			"digest":              gin.H{"type": "string", "enum": digestPeriods},
+			"digest_ai":           boolSchema("Add an AI recap paragraph to the digest."),
+			"strict":              boolSchema("Fail with 422 when too few lines parse."),
+			"convo_break_minutes": gin.H{"type": "integer", "minimum": minConvoBreakOverride, "maximum": maxConvoBreakOverride},
+			"change_date":         gin.H{"type": "string", "format": "date", "description": "Split stats.chat_changes here instead of at the chat's midpoint."},
+			"format":              gin.H{"type": "string", "enum": []string{responseFormatJSON, responseFormatBundle}},
+			"save_upload":         boolSchema("Store the uploaded chat with the result."),
+			"detach":              boolSchema("Answer 202 at once and keep analysing if the client disconnects."),
+			"ai_async":            boolSchema("Answer with the stats at once and store the full result, AI included, at ai_result_url."),
+			"names":               gin.H{"type": "string", "description": "JSON object or CSV mapping phone numbers to names."},
+			"aliases":             gin.H{"type": "string", "description": "JSON object of a name to the other names the same person appears under."},
+		},
+	}
+
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":       "Bloop",
+			"version":     buildVersion,
+			"description": "Analyses exported WhatsApp chats.",
+		},
+		"paths": gin.H{
+			"/health": gin.H{"get": gin.H{
+				"summary": "Queue load, uptime and Groq status",
+				"parameters": []gin.H{{
+					"name": "deep", "in": "query", "schema": gin.H{"type": "boolean"},
+					"description": "Also ping Groq and answer 503 if that fails. Needs the admin key.",
+				}},
+				"responses": gin.H{
+					"200": gin.H{"description": "Healthy.", "content": jsonContent(gin.H{"type": "object"})},
+					"401": errorResponse("deep=true without an API key."),
+					"403": errorResponse("deep=true with a key other than the admin key."),
+					"404": errorResponse("deep=true on a server without ADMIN_API_KEY."),
+					"503": gin.H{"description": "The deep check failed, or the server is shutting down.", "content": jsonContent(gin.H{"type": "object"})},
+				},
+			}},
+			"/version": gin.H{"get": gin.H{
+				"summary":   "Build and enabled features",
+				"responses": gin.H{"200": gin.H{"description": "Build info.", "content": jsonContent(gin.H{"type": "object"})}},
+			}},
+			"/analyze/": gin.H{"post": gin.H{
+				"summary":  "Analyse a chat export",
+				"security": apiKey,
+				"parameters": []gin.H{
+					{"name": "top_words", "in": "query", "schema": gin.H{"type": "integer", "minimum": 1, "maximum": maxTopWords, "default": defaultTopWords}},
+					{"name": "top_emojis", "in": "query", "schema": gin.H{"type": "integer", "minimum": 1, "maximum": maxTopEmojis, "default": defaultTopEmojis}},
+					fieldsParam,
+					idempotencyParam,
+				},
+				"requestBody": gin.H{"required": true, "content": gin.H{"multipart/form-data": gin.H{"schema": analyzeForm}}},
+				"responses": gin.H{
+					"200": gin.H{"description": "The analysis, or an export bundle with format=bundle.", "content": jsonContent(schemaRef("AnalysisResult"))},
+					"202": gin.H{"description": "A detached analysis was started.", "content": jsonContent(schemaRef("Pending"))},
+					"400": errorResponse("An option or the file is invalid."),
+					"413": errorResponse("The upload is too large."),
+					"422": errorResponse("Strict mode: too few lines parsed, or the Idempotency-Key was used for a different request."),
+					"429": gin.H{"description": "MAX_CONCURRENT_ANALYSES analyses are already running, no AI worker freed up within AI_QUEUE_TIMEOUT_SECONDS, or the same upload is still being analysed.", "content": jsonContent(schemaRef("Busy"))},
+					"503": errorResponse("The server is shutting down."),
+				},
+			}},
+			"/compare": gin.H{"post": gin.H{
+				"summary":    "Compare two chats",
+				"security":   apiKey,
+				"parameters": []gin.H{idempotencyParam},
+				"requestBody": gin.H{"required": true, "content": gin.H{"multipart/form-data": gin.H{"schema": gin.H{
+					"type": "object",
+					"properties": gin.H{
+						"file":       gin.H{"type": "array", "items": gin.H{"type": "string", "format": "binary"}, "minItems": 2, "maxItems": 2},
+						"result_ids": gin.H{"type": "string", "description": "Two comma-separated analysis IDs, instead of files."},
+					},
+				}}}},
+				"responses": gin.H{
+					"200": gin.H{"description": "The comparison.", "content": jsonContent(gin.H{"type": "object"})},
+					"400": errorResponse("Not exactly two chats were sent."),
+					"404": errorResponse("A stored result was not found."),
+					"422": errorResponse("The Idempotency-Key was used for a different request."),
+					"429": gin.H{"description": "MAX_CONCURRENT_ANALYSES analyses are already running, or the same upload is still being compared.", "content": jsonContent(schemaRef("Busy"))},
+					"503": errorResponse("The server is shutting down."),
+				},
+			}},
+			"/results/{id}": gin.H{"get": gin.H{
+				"summary":    "Fetch a stored analysis",
+				"security":   apiKey,
+				"parameters": []gin.H{idParam, fieldsParam},
+				"responses": gin.H{
+					"200": gin.H{"description": "The stored analysis.", "content": jsonContent(schemaRef("AnalysisResult"))},
+					"202": gin.H{"description": "A detached analysis is still running.", "content": jsonContent(schemaRef("Pending"))},
+					"404": errorResponse("No such analysis, or storage is off."),
+				},
+			}},
+			"/results/{id}/wrapped.gif": gin.H{"get": gin.H{
+				"summary":    "Animated summary of a stored analysis",
+				"security":   apiKey,
+				"parameters": []gin.H{idParam},
+				"responses": gin.H{
+					"200": gin.H{"description": "A 360×640 GIF.", "content": gin.H{"image/gif": gin.H{"schema": gin.H{"type": "string", "format": "binary"}}}},
+					"404": errorResponse("No such analysis, or storage is off."),
+				},
+			}},
+			"/admin/settings": gin.H{
+				"get": gin.H{
+					"summary":   "Runtime AI settings",
+					"security":  adminKey,
+					"responses": gin.H{"200": gin.H{"description": "The settings now in effect.", "content": jsonContent(schemaRef("AdminSettings"))}},
+				},
+				"patch": gin.H{
+					"summary":     "Change runtime AI settings until restart",
+					"security":    adminKey,
+					"requestBody": gin.H{"required": true, "content": jsonContent(schemaRef("AdminSettings"))},
+					"responses": gin.H{
+						"200": gin.H{"description": "The settings now in effect.", "content": jsonContent(schemaRef("AdminSettings"))},
+						"400": errorResponse("A value is out of range or unknown."),
+					},
+				},
+			},
+			"/admin/cleanup": gin.H{"post": gin.H{
+				"summary":  "Remove expired debug uploads now",
+				"security": adminKey,
+				"responses": gin.H{
+					"200": gin.H{"description": "What was removed.", "content": jsonContent(gin.H{"type": "object"})},
+					"409": errorResponse("DEBUG_SAVE_UPLOADS is off."),
+				},
+			}},
+		},
+		"components": gin.H{
+			"securitySchemes": gin.H{
+				"apiKey":   gin.H{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"adminKey": gin.H{"type": "apiKey", "in": "header", "name": "X-API-Key", "description": "ADMIN_API_KEY; the /admin endpoints only exist when it is set."},
+			},
+			"schemas": gin.H{
+				"Error": gin.H{
+					"type":     "object",
+					"required": []string{"code", "detail"},
+					"properties": gin.H{
+						"code": gin.H{"type": "string", "description": "Stable cause to branch on or localise.", "enum": []string{
+							errCodeInvalidParameter, errCodeMissingFile, errCodeUnsupportedFormat, errCodeTooManyFiles,
+							errCodeUploadTooLarge, errCodeMergeFailed, errCodeParseFailed, errCodeNoStats,
+							errCodeFeatureDisabled, errCodeNotFound, errCodeStorageUnavailable, errCodeBusy,
+							errCodeAnalysisTimeout, errCodeShuttingDown, errCodeAPIKeyMissing, errCodeAPIKeyInvalid,
+							errCodeServerMisconfigured, errCodeInternal, errCodeIdempotencyKeyReuse,
+							errCodeDuplicateUpload,
+						}},
+						"detail": gin.H{"type": "string", "description": "Human-readable explanation; wording may change."},
+					},
+				},
+				"Pending": gin.H{
+					"type": "object",
+					"properties": gin.H{
+						"analysis_id": gin.H{"type": "string"},
+						"status":      gin.H{"type": "string", "enum": []string{analysisStatusProcessing}},
+					},
+				},
+				"Busy": gin.H{
+					"type": "object",
+					"properties": gin.H{
+						"code":                   gin.H{"type": "string", "enum": []string{errCodeBusy, errCodeDuplicateUpload}},
+						"detail":                 gin.H{"type": "string"},
+						"queue_position":         gin.H{"type": "integer", "description": "Where a retry sent now would stand in line, 1 being next."},
+						"estimated_wait_seconds": gin.H{"type": "integer", "description": "Rough wait for that retry; absent until an AI task has been timed."},
+					},
+				},
+				"AdminSettings": gin.H{
+					"type": "object",
+					"properties": gin.H{
+						"max_concurrent_ai_calls":  gin.H{"type": "integer", "minimum": 1, "maximum": maxAIWorkers},
+						"ai_queue_timeout_seconds": gin.H{"type": "integer", "minimum": 0, "maximum": maxAIQueueTimeoutSeconds},
+						"ai_enabled":               gin.H{"type": "boolean"},
+					},
+				},
+				"Warning": gin.H{
+					"type": "object",
+					"properties": gin.H{
+						"code":    gin.H{"type": "string"},
+						"message": gin.H{"type": "string"},
+						"count":   gin.H{"type": "integer"},
+					},
+				},
+				"AnalysisResult": gin.H{
+					"type": "object",
+					"properties": gin.H{
+						"analysis_id":         gin.H{"type": "string"},
+						"chat_name":           gin.H{"type": "string"},
+						"mode":                gin.H{"type": "string", "enum": []string{analysisModeChat, analysisModeNotes}},
+						"preset":              gin.H{"type": "string"},
+						"total_messages":      gin.H{"type": "integer"},
+						"convo_break_minutes": gin.H{"type": "integer"},
+						"convo_break":         gin.H{"type": "object"},
+						"stats":               gin.H{"type": "object", "nullable": true, "description": "Every stat is described in the README."},
+						"ai_analysis":         gin.H{"type": "object", "nullable": true},
+						"ai_model":            gin.H{"type": "string", "description": "The model that wrote ai_analysis."},
+						"group_events":        gin.H{"type": "array", "items": gin.H{"type": "object"}},
+						"digest":              gin.H{"type": "object"},
+						"diagnostics":         gin.H{"type": "object"},
+						"merge":               gin.H{"type": "object"},
+						"bots":                gin.H{"type": "array", "items": gin.H{"type": "object"}},
+						"warnings":            gin.H{"type": "array", "items": schemaRef("Warning")},
+						"error":               gin.H{"type": "string"},
+						"error_code":          gin.H{"type": "string", "enum": []string{errCodeNoMessages, errCodeStatsFailed, errCodeAIFailed, errCodeAITimeout, errCodeBusy, errCodeAnalysisTimeout, errCodeParseFailed}},
+						"ai_status":           gin.H{"type": "string", "enum": []string{aiStatusPending}},
+						"ai_result_url":       gin.H{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func jsonContent(schema gin.H) gin.H {
+	return gin.H{"application/json": gin.H{"schema": schema}}
+}
+
+func schemaRef(name string) gin.H {
+	return gin.H{"$ref": "#/components/schemas/" + name}
+}
+
+func boolSchema(description string) gin.H {
+	return gin.H{"type": "boolean", "description": description}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bloop-go-server/pkg/parser"
+	"golang.org/x/exp/maps"
+)
+
+// testdata/exports holds anonymized snippets of real exports, one per
+// platform and locale variant the parser supports. manifest.json records
+// what each one must parse to, so a change for one format that breaks
+// another shows up before it ships.
+const (
+	exportCorpusDir      = "testdata/exports"
+	exportCorpusManifest = "manifest.json"
+	corpusTimeLayout     = "2006-01-02 15:04"
+	corpusMaxLineBytes   = 1024 * 1024
+)
+
+// corpusExpectation is one manifest entry. Layout is the first timestamp
+// layout the parser should settle on; Note explains output that pins a known
+// gap rather than the behaviour we want.
+type corpusExpectation struct {
+	Platform    string         `json:"platform"`
+	Locale      string         `json:"locale"`
+	Layout      string         `json:"layout"`
+	Messages    int            `json:"messages"`
+	Senders     map[string]int `json:"senders"`
+	GroupEvents int            `json:"group_events"`
+	First       string         `json:"first"`
+	Last        string         `json:"last"`
+	Note        string         `json:"note,omitempty"`
+}
+
+func loadCorpusManifest(t testing.TB) map[string]corpusExpectation {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(exportCorpusDir, exportCorpusManifest))
+	if err != nil {
+		t.Fatalf("could not read corpus manifest: %v", err)
+	}
+	var manifest map[string]corpusExpectation
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("could not decode corpus manifest: %v", err)
+	}
+	return manifest
+}
+
+func corpusExports(t testing.TB) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(exportCorpusDir, "*.txt"))
+	if err != nil {
+		t.Fatalf("could not list corpus: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no exports in %s", exportCorpusDir)
+	}
+	return paths
+}
+
+// quietLogs silences parser logging for the rest of the test.
+func quietLogs(t testing.TB) {
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(output) })
+}
+
+func TestParserCorpus(t *testing.T) {
+	manifest := loadCorpusManifest(t)
+	paths := corpusExports(t)
+	quietLogs(t)
+
+	listed := make(map[string]bool, len(manifest))
+	for name := range manifest {
+		listed[name] = true
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		delete(listed, name)
+		t.Run(strings.TrimSuffix(name, ".txt"), func(t *testing.T) {
+			expected, ok := manifest[name]
+			if !ok {
+				t.Fatalf("%s has no manifest entry", name)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := preprocessMessages(bytes.NewReader(data), corpusMaxLineBytes)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+
+			if layouts := result.diagnostics.TimestampLayouts; len(layouts) == 0 || layouts[0] != expected.Layout {
+				t.Errorf("layout: got %v, want %s", layouts, expected.Layout)
+			}
+			if got := len(result.messages); got != expected.Messages {
+				t.Errorf("messages: got %d, want %d", got, expected.Messages)
+			}
+			if got := len(result.groupEvents); got != expected.GroupEvents {
+				t.Errorf("group events: got %d, want %d", got, expected.GroupEvents)
+			}
+			senders := make(map[string]int)
+			for _, msg := range result.messages {
+				senders[msg.Sender]++
+			}
+			if !maps.Equal(senders, expected.Senders) {
+				t.Errorf("senders: got %v, want %v", senders, expected.Senders)
+			}
+			if len(result.messages) > 0 {
+				if first := result.messages[0].Timestamp.Format(corpusTimeLayout); first != expected.First {
+					t.Errorf("first message: got %s, want %s", first, expected.First)
+				}
+				if last := result.messages[len(result.messages)-1].Timestamp.Format(corpusTimeLayout); last != expected.Last {
+					t.Errorf("last message: got %s, want %s", last, expected.Last)
+				}
+			}
+		})
+	}
+	for name := range listed {
+		t.Errorf("manifest lists %s, which is not in the corpus", name)
+	}
+}
+
+// FuzzPreprocessMessages feeds arbitrary exports to the parser. Any input may
+// be rejected with an error, but it must not panic, and what it returns must
+// be internally consistent.
+func FuzzPreprocessMessages(f *testing.F) {
+	for _, path := range corpusExports(f) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	quietLogs(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		result, err := preprocessMessages(bytes.NewReader(data), corpusMaxLineBytes)
+		if err != nil {
+			return
+		}
+		diagnostics := result.diagnostics
+		switch {
+		case diagnostics.ParserVersion != parser.Version:
+			t.Errorf("diagnostics report parser version %d, want %d", diagnostics.ParserVersion, parser.Version)
+		case diagnostics.ParsedMessages != len(result.messages):
+			t.Errorf("diagnostics count %d messages but %d were returned", diagnostics.ParsedMessages, len(result.messages))
+		case diagnostics.ParseRatioPct < 0 || diagnostics.ParseRatioPct > 100:
+			t.Errorf("parse ratio %.2f is out of range", diagnostics.ParseRatioPct)
+		case len(diagnostics.UnparseableSamples) > parser.MaxDiagnosticSamples:
+			t.Errorf("%d unparseable samples kept, limit is %d", len(diagnostics.UnparseableSamples), parser.MaxDiagnosticSamples)
+		case result.rawMessageCount < len(result.messages):
+			t.Errorf("%d messages from %d non-empty lines", len(result.messages), result.rawMessageCount)
+		}
+		for i, msg := range result.messages {
+			if msg.Timestamp.IsZero() {
+				t.Fatalf("message %d has no timestamp", i)
+			}
+		}
+	})
+}
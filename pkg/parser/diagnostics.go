@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Version identifies how Parse reads an export. Bump it with any change that
+// can make the same file parse differently, and update the export corpus
+// manifest (testdata/exports/manifest.json at the module root) to match.
+const Version = 1
+
+// MaxDiagnosticSamples caps Diagnostics.UnparseableSamples.
+const MaxDiagnosticSamples = 5
+
+const diagnosticSampleMaxRune = 60
+
+// Diagnostics explains how an export was read, so one that yields
+// no or few messages can be told apart from a format the parser doesn't know.
+// RawLines counts non-empty lines and HeaderLines those that start like a
+// message; ParseRatioPct is the share of header lines whose timestamp parsed.
+// LinesWithoutTimestamp are lines that don't
+// start like a message; in a healthy export these are only the continuation
+// lines of multi-line messages. UnparsedTimestamps are lines that look like a
+// message but whose date matched none of the layouts. UnparseableSamples holds
+// the start of the first few of those, plus lines without a timestamp that
+// still begin like a message header; plain continuation lines are message
+// text and are never sampled. DateOrder is only present when the sample fit
+// both dd/mm and mm/dd and the whole file had to decide. ParserVersion tells
+// which parser produced these numbers.
+type Diagnostics struct {
+	ParserVersion         int                `json:"parser_version"`
+	TimestampLayouts      []string           `json:"timestamp_layouts"`
+	RawLines              int                `json:"raw_lines"`
+	ParsedMessages        int                `json:"parsed_messages"`
+	HeaderLines           int                `json:"header_lines"`
+	ParseRatioPct         float64            `json:"parse_ratio_pct"`
+	LinesWithoutTimestamp int                `json:"lines_without_timestamp"`
+	UnparsedTimestamps    int                `json:"unparsed_timestamps"`
+	FilteredSystemMedia   int                `json:"filtered_system_media"`
+	TruncatedLines        int                `json:"truncated_lines"`
+	UnparseableSamples    []string           `json:"unparseable_samples"`
+	DateOrder             *DateOrderDecision `json:"date_order,omitempty"`
+}
+
+func newDiagnostics(layouts []string) Diagnostics {
+	return Diagnostics{
+		ParserVersion:      Version,
+		TimestampLayouts:   layouts,
+		UnparseableSamples: []string{},
+	}
+}
+
+func (d *Diagnostics) addSample(line string) {
+	if len(d.UnparseableSamples) < MaxDiagnosticSamples {
+		d.UnparseableSamples = append(d.UnparseableSamples, sanitizeDiagnosticSample(line))
+	}
+}
+
+// looksLikeMessageHeader catches lines the timestamp pattern missed but that
+// start the way exports start a message, with a date or a bracket.
+func looksLikeMessageHeader(line string) bool {
+	for _, r := range line {
+		return unicode.IsDigit(r) || r == '['
+	}
+	return false
+}
+
+// sanitizeDiagnosticSample keeps only the start of a line, where the timestamp
+// and sender live, and drops control and invisible formatting characters so
+// the sample is safe to show as-is.
+func sanitizeDiagnosticSample(line string) string {
+	var b strings.Builder
+	runes := 0
+	for _, r := range strings.ToValidUTF8(line, "�") {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		if runes == diagnosticSampleMaxRune {
+			b.WriteString("…")
+			break
+		}
+		b.WriteRune(r)
+		runes++
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Group event types.
+const (
+	GroupEventCreated            = "created"
+	GroupEventAdded              = "added"
+	GroupEventRemoved            = "removed"
+	GroupEventLeft               = "left"
+	GroupEventJoined             = "joined"
+	GroupEventSubjectChanged     = "subject_changed"
+	GroupEventIconChanged        = "icon_changed"
+	GroupEventDescriptionChanged = "description_changed"
+)
+
+// GroupEvent is a change to a group's members or settings, read from a
+// system line. Timestamp is "2006-01-02 15:04".
+type GroupEvent struct {
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Actor     string `json:"actor"`
+	Target    string `json:"target,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+type groupEventPattern struct {
+	eventType string
+	pattern   *regexp.Regexp
+}
+
+// groupEventPatterns are tried in order, so the specific phrasings come before
+// the catch-all "X added Y" and "X removed Y". Group 1 is always the actor;
+// for added/removed group 2 is the target, otherwise it is the detail.
+var groupEventPatterns = []groupEventPattern{
+	{GroupEventCreated, regexp.MustCompile(`^(.+?) created (?:the )?group "(.*)"$`)},
+	{GroupEventSubjectChanged, regexp.MustCompile(`^(.+?) changed the (?:subject|group name) from ".*" to "(.*)"$`)},
+	{GroupEventSubjectChanged, regexp.MustCompile(`^(.+?) changed the (?:subject|group name) to "(.*)"$`)},
+	{GroupEventIconChanged, regexp.MustCompile(`^(.+?) (?:changed|deleted|removed) (?:this group['’]s|the group) icon$`)},
+	{GroupEventDescriptionChanged, regexp.MustCompile(`^(.+?) (?:changed|deleted) (?:this group['’]s|the group) description$`)},
+	{GroupEventJoined, regexp.MustCompile(`^(.+?) joined using (?:this group['’]s invite link|a group link|a link)$`)},
+	{GroupEventLeft, regexp.MustCompile(`^(.+?) left$`)},
+	{GroupEventAdded, regexp.MustCompile(`^(.+?) added (.+)$`)},
+	{GroupEventRemoved, regexp.MustCompile(`^(.+?) removed (.+)$`)},
+}
+
+// parseGroupEvent recognises the system lines of an English export that record
+// group membership and settings changes.
+func parseGroupEvent(text string) (GroupEvent, bool) {
+	text = strings.TrimSpace(strings.Trim(strings.TrimSpace(text), "\u200e"))
+	for _, candidate := range groupEventPatterns {
+		match := candidate.pattern.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		event := GroupEvent{Type: candidate.eventType, Actor: strings.TrimSpace(match[1])}
+		if len(match) > 2 {
+			switch candidate.eventType {
+			case GroupEventAdded, GroupEventRemoved:
+				event.Target = strings.TrimSpace(match[2])
+			default:
+				event.Detail = match[2]
+			}
+		}
+		return event, true
+	}
+	return GroupEvent{}, false
+}
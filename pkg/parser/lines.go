@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+// DefaultMaxLineBytes is the line limit used when none is given.
+const DefaultMaxLineBytes = 1024 * 1024
+
+// LineReader splits input into lines like bufio.Scanner, but lines longer than
+// maxBytes are truncated (and reported) instead of aborting with ErrTooLong.
+type LineReader struct {
+	reader    *bufio.Reader
+	maxBytes  int
+	line      []byte
+	truncated bool
+	err       error
+}
+
+// NewLineReader reads lines of at most maxBytes, or DefaultMaxLineBytes when
+// maxBytes is not positive.
+func NewLineReader(reader io.Reader, maxBytes int) *LineReader {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxLineBytes
+	}
+	return &LineReader{reader: bufio.NewReader(reader), maxBytes: maxBytes}
+}
+
+func (lr *LineReader) Scan() bool {
+	if lr.err != nil {
+		return false
+	}
+
+	lr.line = lr.line[:0]
+	lr.truncated = false
+	readAny := false
+
+	for {
+		chunk, isPrefix, err := lr.reader.ReadLine()
+		if err != nil {
+			lr.err = err
+			break
+		}
+		readAny = true
+
+		if room := lr.maxBytes - len(lr.line); room > 0 {
+			if len(chunk) > room {
+				chunk = chunk[:room]
+				lr.truncated = true
+			}
+			lr.line = append(lr.line, chunk...)
+		} else if len(chunk) > 0 {
+			lr.truncated = true
+		}
+
+		if !isPrefix {
+			break
+		}
+	}
+
+	if !readAny {
+		return false
+	}
+	if lr.truncated {
+		// Don't leave half a multi-byte rune at the cut point.
+		if start := lastRuneStart(lr.line); !utf8.FullRune(lr.line[start:]) {
+			lr.line = lr.line[:start]
+		}
+	}
+	return true
+}
+
+func (lr *LineReader) Text() string {
+	return string(lr.line)
+}
+
+func (lr *LineReader) Truncated() bool {
+	return lr.truncated
+}
+
+func (lr *LineReader) Err() error {
+	if lr.err == io.EOF {
+		return nil
+	}
+	return lr.err
+}
+
+func lastRuneStart(b []byte) int {
+	for i := len(b) - 1; i >= 0; i-- {
+		if utf8.RuneStart(b[i]) {
+			return i
+		}
+	}
+	return 0
+}
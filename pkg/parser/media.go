@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Attachment kinds, from the filename WhatsApp gives the file.
+const (
+	MediaImage    = "image"
+	MediaVideo    = "video"
+	MediaAudio    = "audio"
+	MediaVoice    = "voice_note"
+	MediaSticker  = "sticker"
+	MediaGIF      = "gif"
+	MediaDocument = "document"
+	MediaContact  = "contact"
+	MediaOther    = "other"
+)
+
+var (
+	// Exports made with media name each attachment inline instead of writing
+	// "<Media omitted>": "IMG-20230115-WA0003.jpg (file attached)" on Android,
+	// "<attached: 00000012-PHOTO-2023-01-15-10-20-30.jpg>" on iOS.
+	androidAttachmentPattern = regexp.MustCompile(`(?i)^(\S.*?\.[a-z0-9]{1,5}) \((?:file attached|datei angehängt|archivo adjunto|arquivo anexado|fichier joint)\)$`)
+	iosAttachmentPattern     = regexp.MustCompile(`^<attached: (.+)>$`)
+
+	androidMediaNamePattern = regexp.MustCompile(`^(IMG|VID|AUD|PTT|STK|DOC)-(\d{4})(\d{2})\d{2}-WA\d+`)
+	iosMediaNamePattern     = regexp.MustCompile(`^\d+-(PHOTO|VIDEO|AUDIO|STICKER|GIF)-(\d{4})-(\d{2})-\d{2}-`)
+)
+
+var mediaNamePrefixKinds = map[string]string{
+	"IMG": MediaImage, "PHOTO": MediaImage,
+	"VID": MediaVideo, "VIDEO": MediaVideo,
+	"AUD": MediaAudio, "AUDIO": MediaAudio,
+	"PTT":     MediaVoice,
+	"STK":     MediaSticker,
+	"STICKER": MediaSticker,
+	"GIF":     MediaGIF,
+	"DOC":     MediaDocument,
+}
+
+var mediaExtensionKinds = map[string]string{
+	".jpg": MediaImage, ".jpeg": MediaImage, ".png": MediaImage, ".heic": MediaImage,
+	".mp4": MediaVideo, ".mov": MediaVideo, ".3gp": MediaVideo,
+	".mp3": MediaAudio, ".m4a": MediaAudio, ".aac": MediaAudio, ".wav": MediaAudio,
+	".opus": MediaVoice,
+	".webp": MediaSticker,
+	".gif":  MediaGIF,
+	".pdf":  MediaDocument, ".doc": MediaDocument, ".docx": MediaDocument, ".xls": MediaDocument,
+	".xlsx": MediaDocument, ".ppt": MediaDocument, ".pptx": MediaDocument, ".txt": MediaDocument,
+	".zip": MediaDocument,
+	".vcf": MediaContact,
+}
+
+// Attachment is one file named in a media-included export. Month is
+// "2006-01".
+type Attachment struct {
+	Sender string
+	Kind   string
+	Month  string
+}
+
+// parseAttachment reads the kind of an attachment line, and the month from
+// the date in the filename when it has one. Month is empty otherwise, and the
+// caller uses the month the message was sent.
+func parseAttachment(message string) (kind, month string, ok bool) {
+	var filename string
+	if match := androidAttachmentPattern.FindStringSubmatch(message); match != nil {
+		filename = match[1]
+	} else if match := iosAttachmentPattern.FindStringSubmatch(message); match != nil {
+		filename = strings.TrimSpace(match[1])
+	} else {
+		return "", "", false
+	}
+
+	if match := androidMediaNamePattern.FindStringSubmatch(filename); match != nil {
+		kind, month = mediaNamePrefixKinds[match[1]], match[2]+"-"+match[3]
+	} else if match := iosMediaNamePattern.FindStringSubmatch(filename); match != nil {
+		kind, month = mediaNamePrefixKinds[match[1]], match[2]+"-"+match[3]
+	}
+	if kind == MediaImage || kind == "" {
+		// Android names stickers and GIFs IMG- too; the extension knows better.
+		if byExtension, known := mediaExtensionKinds[strings.ToLower(filepath.Ext(filename))]; known && (kind == "" || byExtension != MediaImage) {
+			kind = byExtension
+		}
+	}
+	if kind == "" {
+		kind = MediaOther
+	}
+	return kind, month, true
+}
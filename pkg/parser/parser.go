@@ -0,0 +1,438 @@
+// Package parser reads WhatsApp chat exports, as written by "Export chat" on
+// Android and iOS in any of the date and time formats listed in
+// timestampFormats, into messages ready for analysis.
+//
+// Parse takes everything it depends on through Options, so it can be used
+// outside the server:
+//
+//	result, err := parser.Parse(file, parser.Options{})
+//	for _, msg := range result.Messages {
+//		fmt.Println(msg.Timestamp, msg.Sender, msg.OriginalMessage)
+//	}
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Message is one text message kept for analysis. CleanedMessage is the text
+// lowercased, without links, punctuation, short words and stopwords; it is
+// empty for a link-only message, which is only kept in a notes-to-self chat.
+type Message struct {
+	Timestamp       time.Time
+	DateStr         string
+	Sender          string
+	CleanedMessage  string
+	OriginalMessage string
+}
+
+// Options are what Parse needs besides the export. The zero value parses
+// with DefaultMaxLineBytes and no stopwords, system message patterns or
+// laughter detection.
+type Options struct {
+	// MaxLineBytes truncates longer lines, with a warning, instead of
+	// failing the parse.
+	MaxLineBytes int
+	// Stopwords are lowercase words left out of Message.CleanedMessage.
+	Stopwords map[string]struct{}
+	// SystemPatterns are lowercase substrings of messages WhatsApp writes
+	// itself, such as the encryption notice, which are not counted as sent.
+	SystemPatterns []string
+	// IsLaughter reports whether a message laughs, for Markers.Laughs.
+	IsLaughter func(text string) bool
+}
+
+// Result is everything Parse read from an export. RawLines counts the
+// non-empty lines.
+type Result struct {
+	RawLines    int
+	Messages    []Message
+	Markers     Markers
+	GroupEvents []GroupEvent
+	Diagnostics Diagnostics
+	Warnings    []Warning
+}
+
+// Markers counts, per sender, the message kinds Parse recognises besides
+// plain text: placeholders for deleted and edited messages (stripped from the
+// analysed text), polls and shared locations.
+type Markers struct {
+	Deleted   map[string]int
+	Edited    map[string]int
+	Polls     map[string]int
+	Locations map[string]int
+	PollList  []Poll
+	// DeletedByMonth is sender -> month (YYYY-MM) -> deleted messages.
+	DeletedByMonth map[string]map[string]int
+	// Attachments are the files named in an export made with media.
+	Attachments []Attachment
+	// Sent counts every message a sender wrote, including those Parse drops
+	// from the analysed text, so a member who only sends media or stopwords
+	// still counts as a participant.
+	Sent map[string]int
+	// Laughs are the text messages with laughter in them. They are found
+	// before stopwords are removed, since a plain "haha" is one.
+	Laughs []Laugh
+}
+
+func newMarkers() Markers {
+	return Markers{
+		Deleted:   make(map[string]int),
+		Edited:    make(map[string]int),
+		Polls:     make(map[string]int),
+		Locations: make(map[string]int),
+		Sent:      make(map[string]int),
+
+		DeletedByMonth: make(map[string]map[string]int),
+	}
+}
+
+// Senders returns the given users plus everyone with a marker.
+func (m Markers) Senders(users []string) map[string]struct{} {
+	all := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		all[user] = struct{}{}
+	}
+	for _, counts := range []map[string]int{m.Deleted, m.Edited, m.Polls, m.Locations} {
+		for user := range counts {
+			all[user] = struct{}{}
+		}
+	}
+	return all
+}
+
+// Laugh is one message with laughter in it. After is who wrote the text
+// message just before it, Gap later, when that was someone else.
+type Laugh struct {
+	Sender string
+	After  string
+	Gap    time.Duration
+}
+
+// Warning codes Parse reports. Codes are stable so clients can match on
+// them; the messages are for people.
+const (
+	WarnLinesTruncated  = "lines_truncated"
+	WarnLayoutAmbiguous = "layout_ambiguous"
+	WarnLayoutUnknown   = "layout_unknown"
+	WarnTimezoneAssumed = "timezone_assumed"
+)
+
+// Warning is something that made a result less exact without failing it.
+// Count is how many lines, messages or people it affected.
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+var deletedMessageMarkers = []string{"this message was deleted", "you deleted this message"}
+
+const editedMessageMarker = "<This message was edited>"
+
+const stringPunctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+var urlPattern = regexp.MustCompile(`https?://\S+|www\.\S+`)
+
+// Parse reads a whole export. Its timestamp layouts are sniffed from the
+// first lines and, when both day-first and month-first fit, settled over the
+// whole file.
+func Parse(reader io.Reader, opts Options) (*Result, error) {
+	buf, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input for buffering: %w", err)
+	}
+	maxLineBytes := opts.MaxLineBytes
+	if maxLineBytes <= 0 {
+		maxLineBytes = DefaultMaxLineBytes
+	}
+
+	var warnings []Warning
+	detection, err := DetectLayouts(buf, maxLineBytes)
+	if err != nil {
+		return nil, err
+	}
+	if detection.Guessed {
+		warnings = append(warnings, Warning{Code: WarnLayoutUnknown, Count: 1, Message: "The timestamp format could not be recognised from the start of the export, so every known format was tried line by line."})
+	}
+	if detection.Ambiguous {
+		warnings = append(warnings, Warning{Code: WarnLayoutAmbiguous, Count: 1, Message: "The dates fit day-first and month-first order equally well, so day-first was assumed; day and month may be swapped."})
+	}
+	currentTimestampParseLayouts := detection.Layouts
+
+	messagesData := []Message{}
+	mainScanner := NewLineReader(bytes.NewReader(buf), maxLineBytes)
+	lineNumber := 0
+	rawMessageCount := 0
+	truncatedLines := 0
+	markers := newMarkers()
+	var pendingPoll *Poll
+	groupEvents := []GroupEvent{}
+	diagnostics := newDiagnostics(currentTimestampParseLayouts)
+	diagnostics.DateOrder = detection.DateOrder
+	unrecognizedHeaders := 0
+	// backwardsJumps counts messages timestamped before the one above them,
+	// which in an export without time zones means the phone's clock moved.
+	backwardsJumps := 0
+	// previous is the last text message, kept or not, for crediting laughs.
+	var previous *Message
+
+	for mainScanner.Scan() {
+		lineNumber++
+		line := mainScanner.Text()
+		if mainScanner.Truncated() {
+			truncatedLines++
+			log.Printf("Warning: Line %d exceeds %d bytes and was truncated.", lineNumber, mainScanner.maxBytes)
+		}
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			continue
+		}
+		rawMessageCount++
+
+		line = strings.TrimPrefix(line, "\u200e")
+
+		match := timestampPattern.FindStringSubmatch(line)
+		if match == nil || len(match) != 5 {
+			if pendingPoll != nil && !systemLinePattern.MatchString(line) {
+				pendingPoll.addLine(line)
+				continue
+			}
+			systemMatch := systemLinePattern.FindStringSubmatch(line)
+			if systemMatch == nil {
+				diagnostics.LinesWithoutTimestamp++
+				if looksLikeMessageHeader(line) {
+					diagnostics.HeaderLines++
+					unrecognizedHeaders++
+					diagnostics.addSample(line)
+				}
+				continue
+			}
+			diagnostics.FilteredSystemMedia++
+			if event, ok := parseGroupEvent(systemMatch[3]); ok {
+				if timestamp, ok := ParseTimestamp(systemMatch[1], systemMatch[2], currentTimestampParseLayouts); ok {
+					event.Timestamp = timestamp.Format("2006-01-02 15:04")
+					groupEvents = append(groupEvents, event)
+				}
+			}
+			continue
+		}
+
+		pendingPoll = nil
+		diagnostics.HeaderLines++
+
+		dateStr := strings.TrimSpace(match[1])
+		timeStr := strings.TrimSpace(match[2])
+		sender := strings.TrimSpace(match[3])
+		message := strings.TrimSpace(match[4])
+
+		// iOS exports write system events as a message from the group itself,
+		// marked with a leading LRM.
+		if strings.HasPrefix(message, "\u200e") {
+			if event, ok := parseGroupEvent(message); ok {
+				if timestamp, ok := ParseTimestamp(dateStr, timeStr, currentTimestampParseLayouts); ok {
+					event.Timestamp = timestamp.Format("2006-01-02 15:04")
+					groupEvents = append(groupEvents, event)
+				}
+				continue
+			}
+		}
+		message = strings.TrimPrefix(message, "\u200e")
+
+		if message == pollMarker {
+			markers.Sent[sender]++
+			if timestamp, ok := ParseTimestamp(dateStr, timeStr, currentTimestampParseLayouts); ok {
+				markers.Polls[sender]++
+				markers.PollList = append(markers.PollList, Poll{
+					Timestamp: timestamp.Format("2006-01-02 15:04"),
+					Creator:   sender,
+					Options:   []PollOption{},
+				})
+				pendingPoll = &markers.PollList[len(markers.PollList)-1]
+			}
+			continue
+		}
+
+		lowerCaseMessage := strings.ToLower(message)
+		if isLocationMessage(lowerCaseMessage) {
+			markers.Locations[sender]++
+		}
+		if isDeletedMessage(lowerCaseMessage) {
+			markers.Sent[sender]++
+			markers.Deleted[sender]++
+			if timestamp, ok := ParseTimestamp(dateStr, timeStr, currentTimestampParseLayouts); ok {
+				if _, ok := markers.DeletedByMonth[sender]; !ok {
+					markers.DeletedByMonth[sender] = make(map[string]int)
+				}
+				markers.DeletedByMonth[sender][timestamp.Format("2006-01")]++
+			}
+			continue
+		}
+		if idx := strings.Index(message, editedMessageMarker); idx >= 0 {
+			markers.Edited[sender]++
+			message = strings.TrimSpace(strings.TrimSuffix(message[:idx], "\u200e"))
+			lowerCaseMessage = strings.ToLower(message)
+			if message == "" {
+				continue
+			}
+		}
+
+		kind, month, isAttachment := parseAttachment(message)
+		if isAttachment {
+			if month == "" {
+				if timestamp, ok := ParseTimestamp(dateStr, timeStr, currentTimestampParseLayouts); ok {
+					month = timestamp.Format("2006-01")
+				}
+			}
+			if month != "" {
+				markers.Attachments = append(markers.Attachments, Attachment{Sender: sender, Kind: kind, Month: month})
+			}
+		}
+
+		isSystemMessage := false
+		for _, pattern := range opts.SystemPatterns {
+			if strings.Contains(lowerCaseMessage, pattern) {
+				isSystemMessage = true
+				break
+			}
+		}
+		if !isSystemMessage {
+			markers.Sent[sender]++
+		}
+		if isSystemMessage || isAttachment || strings.Contains(message, "<attached:") || strings.Contains(message, " omitted>") || strings.Contains(message, "omitted media") {
+			diagnostics.FilteredSystemMedia++
+			continue
+		}
+
+		timestamp, parsed := ParseTimestamp(dateStr, timeStr, currentTimestampParseLayouts)
+		if !parsed {
+			// log.Printf("Line %d: Failed to parse timestamp '%s %s' with available layouts.", lineNumber, dateStr, timeStr)
+			diagnostics.UnparsedTimestamps++
+			diagnostics.addSample(line)
+			continue
+		}
+
+		if opts.IsLaughter != nil && opts.IsLaughter(message) {
+			laughed := Laugh{Sender: sender}
+			if previous != nil && previous.Sender != sender {
+				laughed.After = previous.Sender
+				laughed.Gap = timestamp.Sub(previous.Timestamp)
+			}
+			markers.Laughs = append(markers.Laughs, laughed)
+		}
+		previous = &Message{Timestamp: timestamp, Sender: sender}
+
+		cleanedMessage := CleanText(message, opts.Stopwords)
+
+		// Link-only messages have nothing left after cleaning; they are kept
+		// for now and dropped again below unless this is a notes-to-self chat,
+		// which is mostly saved links.
+		if cleanedMessage != "" || urlPattern.MatchString(message) {
+			if len(messagesData) > 0 && timestamp.Before(messagesData[len(messagesData)-1].Timestamp) {
+				backwardsJumps++
+			}
+			messagesData = append(messagesData, Message{
+				Timestamp:       timestamp,
+				DateStr:         dateStr,
+				Sender:          sender,
+				CleanedMessage:  cleanedMessage,
+				OriginalMessage: message,
+			})
+		}
+	}
+
+	if err := mainScanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading data stream: %w", err)
+	}
+	if len(markers.Sent) != 1 {
+		kept := messagesData[:0]
+		for _, msg := range messagesData {
+			if msg.CleanedMessage != "" {
+				kept = append(kept, msg)
+			}
+		}
+		messagesData = kept
+	}
+
+	if truncatedLines > 0 {
+		log.Printf("Warning: %d oversized lines were truncated during preprocessing.", truncatedLines)
+		warnings = append(warnings, Warning{Code: WarnLinesTruncated, Count: truncatedLines, Message: fmt.Sprintf("Lines longer than %d bytes were cut short before analysis.", maxLineBytes)})
+	}
+	if backwardsJumps > 0 {
+		warnings = append(warnings, Warning{Code: WarnTimezoneAssumed, Count: backwardsJumps, Message: "Some messages are timestamped earlier than the message before them. Exports carry no time zone, so times are read as the phone's local clock; a clock or time-zone change is the usual cause."})
+	}
+	log.Printf("Preprocessing complete. Raw messages counted: %d, Parsed messages for analysis: %d", rawMessageCount, len(messagesData))
+
+	diagnostics.RawLines = rawMessageCount
+	diagnostics.ParsedMessages = len(messagesData)
+	diagnostics.TruncatedLines = truncatedLines
+	if diagnostics.HeaderLines > 0 {
+		parsedHeaders := diagnostics.HeaderLines - diagnostics.UnparsedTimestamps - unrecognizedHeaders
+		diagnostics.ParseRatioPct = math.Round(float64(parsedHeaders)*100/float64(diagnostics.HeaderLines)*100) / 100
+	}
+
+	return &Result{
+		RawLines:    rawMessageCount,
+		Messages:    messagesData,
+		Markers:     markers,
+		GroupEvents: groupEvents,
+		Diagnostics: diagnostics,
+		Warnings:    warnings,
+	}, nil
+}
+
+func isDeletedMessage(lowerCaseMessage string) bool {
+	for _, marker := range deletedMessageMarkers {
+		if strings.Contains(lowerCaseMessage, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveLinks drops every URL from text.
+func RemoveLinks(text string) string {
+	return urlPattern.ReplaceAllString(text, "")
+}
+
+// FindLinks returns the URLs in text.
+func FindLinks(text string) []string {
+	return urlPattern.FindAllString(text, -1)
+}
+
+// NormalizeWord lowercases word and trims the punctuation around it.
+func NormalizeWord(word string) string {
+	trimmed := strings.Trim(word, string(stringPunctuation))
+	return strings.ToLower(trimmed)
+}
+
+// CleanText is text as Message.CleanedMessage holds it: without links, and
+// with its words normalized and those of two letters or fewer and stopwords
+// left out.
+func CleanText(text string, stopwords map[string]struct{}) string {
+	text = RemoveLinks(text)
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+
+	words := strings.Fields(text)
+	filteredWords := make([]string, 0, len(words))
+
+	for _, word := range words {
+		normalized := NormalizeWord(word)
+		_, isStopword := stopwords[normalized]
+		if !isStopword && len(normalized) > 2 && normalized != "" {
+			filteredWords = append(filteredWords, normalized)
+		}
+	}
+	return strings.Join(filteredWords, " ")
+}
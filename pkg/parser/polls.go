@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	pollMarker     = "POLL:"
+	locationPrefix = "location: "
+)
+
+var pollOptionPattern = regexp.MustCompile(`^OPTION:\s*(.*?)\s*(?:\((\d+) votes?\))?$`)
+
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// Poll is a poll posted in the chat, with its options and their votes as of
+// the export.
+type Poll struct {
+	Timestamp string       `json:"timestamp"`
+	Creator   string       `json:"creator"`
+	Question  string       `json:"question"`
+	Options   []PollOption `json:"options"`
+}
+
+// addLine consumes a continuation line of an exported poll block: the first
+// line is the question, then one "OPTION: text (n votes)" line per option.
+func (p *Poll) addLine(line string) {
+	if match := pollOptionPattern.FindStringSubmatch(line); match != nil {
+		votes, _ := strconv.Atoi(match[2])
+		p.Options = append(p.Options, PollOption{Text: match[1], Votes: votes})
+		return
+	}
+	if p.Question == "" {
+		p.Question = line
+	} else if len(p.Options) == 0 {
+		p.Question += "\n" + line
+	}
+}
+
+// isLocationMessage matches shared locations, exported as
+// "location: https://maps.google.com/?q=...".
+func isLocationMessage(lowerCaseMessage string) bool {
+	return strings.HasPrefix(lowerCaseMessage, locationPrefix) && urlPattern.MatchString(lowerCaseMessage)
+}
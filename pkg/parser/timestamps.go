@@ -0,0 +1,410 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxLinesToSniff is how many lines from the start of an export are sampled
+// to pick its timestamp layouts.
+const maxLinesToSniff = 100
+
+// timestampFormat registers one way exports write a message's date and time.
+// dateRegex and timeRegex are the variants the line pattern accepts for it,
+// and layout is the Go layout that reads "<date> <time>" once the time has
+// been through normalizeTimeToken.
+type timestampFormat struct {
+	dateRegex string
+	timeRegex string
+	layout    string
+}
+
+const (
+	slashDate     = `\d{1,2}/\d{1,2}/\d{2,4}`
+	yearFirstDate = `\d{4}/\d{1,2}/\d{1,2}`
+	dottedDate    = `\d{1,2}\.\d{1,2}\.\d{2,4}`
+
+	clockTime  = `\d{1,2}:\d{2}(?::\d{2})?(?:[\s\p{Zs}]*` + timeMarkerPattern + `)?` // optional secs and AM/PM marker
+	dottedTime = `\d{1,2}\.\d{2}`
+	hourHTime  = `\d{1,2}h\d{2}`
+)
+
+// timestampFormats lists every date and time shape the parser understands.
+// The line pattern accepts any registered date variant followed by any time
+// variant and sniffing narrows the layouts down per file, so a new format
+// only needs an entry here.
+var timestampFormats = []timestampFormat{
+	// US style with AM/PM
+	{slashDate, clockTime, "1/2/06 3:04 PM"},        // m/d/yy h:mm AM/PM
+	{slashDate, clockTime, "1/2/2006 3:04 PM"},      // m/d/yyyy h:mm AM/PM
+	{slashDate, clockTime, "1/2/06 3:04:05 PM"},     // m/d/yy h:mm:ss AM/PM
+	{slashDate, clockTime, "1/2/2006 3:04:05 PM"},   // m/d/yyyy h:mm:ss AM/PM
+	{slashDate, clockTime, "01/02/06 3:04 PM"},      // mm/dd/yy h:mm AM/PM
+	{slashDate, clockTime, "01/02/2006 3:04 PM"},    // mm/dd/yyyy h:mm AM/PM
+	{slashDate, clockTime, "01/02/06 3:04:05 PM"},   // mm/dd/yy h:mm:ss AM/PM
+	{slashDate, clockTime, "01/02/2006 3:04:05 PM"}, // mm/dd/yyyy h:mm:ss AM/PM
+
+	// European style 24-hour
+	{slashDate, clockTime, "2/1/06 15:04"},        // d/m/yy HH:mm
+	{slashDate, clockTime, "2/1/2006 15:04"},      // d/m/yyyy HH:mm
+	{slashDate, clockTime, "2/1/06 15:04:05"},     // d/m/yy HH:mm:ss
+	{slashDate, clockTime, "2/1/2006 15:04:05"},   // d/m/yyyy HH:mm:ss
+	{slashDate, clockTime, "02/01/06 15:04"},      // dd/mm/yy HH:mm
+	{slashDate, clockTime, "02/01/2006 15:04"},    // dd/mm/yyyy HH:mm
+	{slashDate, clockTime, "02/01/06 15:04:05"},   // dd/mm/yy HH:mm:ss
+	{slashDate, clockTime, "02/01/2006 15:04:05"}, // dd/mm/yyyy HH:mm:ss
+
+	{slashDate, clockTime, "2/1/06 3:04 PM"},        // d/m/yy h:mm AM/PM
+	{slashDate, clockTime, "2/1/2006 3:04 PM"},      // d/m/yyyy h:mm AM/PM
+	{slashDate, clockTime, "2/1/06 3:04:05 PM"},     // d/m/yy h:mm:ss AM/PM
+	{slashDate, clockTime, "2/1/2006 3:04:05 PM"},   // d/m/yyyy h:mm:ss AM/PM
+	{slashDate, clockTime, "02/01/06 3:04 PM"},      // dd/mm/yy h:mm AM/PM
+	{slashDate, clockTime, "02/01/2006 3:04 PM"},    // dd/mm/yyyy h:mm AM/PM
+	{slashDate, clockTime, "02/01/06 3:04:05 PM"},   // dd/mm/yy h:mm:ss AM/PM
+	{slashDate, clockTime, "02/01/2006 3:04:05 PM"}, // dd/mm/yyyy h:mm:ss AM/PM
+
+	// Year first (East Asian locales)
+	{yearFirstDate, clockTime, "2006/1/2 15:04"},      // yyyy/mm/dd HH:mm
+	{yearFirstDate, clockTime, "2006/1/2 15:04:05"},   // yyyy/mm/dd HH:mm:ss
+	{yearFirstDate, clockTime, "2006/1/2 3:04 PM"},    // yyyy/mm/dd h:mm AM/PM
+	{yearFirstDate, clockTime, "2006/1/2 3:04:05 PM"}, // yyyy/mm/dd h:mm:ss AM/PM
+
+	// Dotted dates (German, Russian, ...), some Android builds also dot the time
+	{dottedDate, clockTime, "2.1.06 15:04"},      // dd.mm.yy HH:mm
+	{dottedDate, clockTime, "2.1.2006 15:04"},    // dd.mm.yyyy HH:mm
+	{dottedDate, clockTime, "2.1.06 15:04:05"},   // dd.mm.yy HH:mm:ss
+	{dottedDate, clockTime, "2.1.2006 15:04:05"}, // dd.mm.yyyy HH:mm:ss
+	{dottedDate, dottedTime, "2.1.06 15.04"},     // dd.mm.yy HH.mm
+	{dottedDate, dottedTime, "2.1.2006 15.04"},   // dd.mm.yyyy HH.mm
+
+	// Hour-h-minute times (French Canadian, Portuguese)
+	{slashDate, hourHTime, "2/1/06 15h04"},    // d/m/yy HHhmm
+	{slashDate, hourHTime, "2/1/2006 15h04"},  // d/m/yyyy HHhmm
+	{dottedDate, hourHTime, "2.1.06 15h04"},   // dd.mm.yy HHhmm
+	{dottedDate, hourHTime, "2.1.2006 15h04"}, // dd.mm.yyyy HHhmm
+}
+
+var (
+	timestampPattern      *regexp.Regexp
+	systemLinePattern     *regexp.Regexp
+	timestampParseLayouts []string
+)
+
+func init() {
+	var dateVariants, timeVariants []string
+	for _, format := range timestampFormats {
+		if !slices.Contains(dateVariants, format.dateRegex) {
+			dateVariants = append(dateVariants, format.dateRegex)
+		}
+		if !slices.Contains(timeVariants, format.timeRegex) {
+			timeVariants = append(timeVariants, format.timeRegex)
+		}
+		timestampParseLayouts = append(timestampParseLayouts, format.layout)
+	}
+
+	linePrefix := `(?i)^[\s\p{Zs}]*(?:[\x{200e}\x{200f}])?` + // Optional LRM/RLM at start, optional space
+		`\[?` + // Optional opening bracket
+		`(` + strings.Join(dateVariants, "|") + `)` + // Date (Group 1)
+		`(?:[,\x{060c}][\s\p{Zs}]*|[\s\p{Zs}]+)` + // Comma (or Arabic comma) and space, or just space
+		`(` + strings.Join(timeVariants, "|") + `)` + // Time (Group 2)
+		`(?:\]?[\s\p{Zs}]*-[\s\p{Zs}]*|\][\s\p{Zs}]*)` // Separator (non-capturing)
+
+	timestampPattern = regexp.MustCompile(linePrefix +
+		`(.*?):\s*` + // Sender (Group 3) - Non-greedy match for sender name
+		`(.*)`) // Message (Group 4) - Rest of the line
+
+	// System lines (joins, leaves, subject changes) have no "sender:" part.
+	systemLinePattern = regexp.MustCompile(linePrefix + `(.*)`) // Event text (Group 3)
+}
+
+// Layouts returns the Go time layouts of every timestamp format the parser
+// knows, in the order they are tried.
+func Layouts() []string {
+	return slices.Clone(timestampParseLayouts)
+}
+
+// SplitHeader splits a line that starts with a timestamp, a message or a
+// system line, into its date, its time and the rest of the line. ok is false
+// for lines that don't start with a timestamp, such as the continuation lines
+// of a multi-line message.
+func SplitHeader(line string) (date, clock, rest string, ok bool) {
+	match := systemLinePattern.FindStringSubmatch(line)
+	if match == nil {
+		return "", "", "", false
+	}
+	return match[1], match[2], match[3], true
+}
+
+// ParseTimestamp reads the date and time of a line with the first of layouts
+// that fits. Layouts with seconds or an AM/PM marker are only tried on times
+// that have them.
+func ParseTimestamp(dateStr, timeStr string, layouts []string) (time.Time, bool) {
+	timeCleaned := normalizeTimeToken(timeStr)
+	datetimeStr := strings.TrimSpace(dateStr) + " " + timeCleaned
+
+	for _, layout := range layouts {
+		hasSecondsLayout := strings.Contains(layout, ":05")
+		hasSecondsData := strings.Count(timeCleaned, ":") >= 2
+		hasAmPmLayout := strings.Contains(layout, " PM")
+		hasAmPmData := strings.HasSuffix(timeCleaned, " AM") || strings.HasSuffix(timeCleaned, " PM")
+
+		if hasSecondsLayout != hasSecondsData || hasAmPmLayout != hasAmPmData {
+			continue
+		}
+
+		if timestamp, err := time.Parse(layout, datetimeStr); err == nil {
+			return timestamp, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timeMarkerPattern matches the AM/PM markers exports use across locales:
+// "PM", "p.m.", "p. m." (Spanish, Portuguese) and the Arabic ص/م.
+const timeMarkerPattern = `(?:AM|PM|[ap]\.[\s\p{Zs}]*m\.?|\x{0635}|\x{0645})`
+
+// normalizeTimeToken turns a localized time into the shape the parse layouts
+// expect: any Unicode space collapsed to a single ASCII space and the AM/PM
+// marker, if any, rewritten as "AM" or "PM".
+func normalizeTimeToken(timeStr string) string {
+	timeStr = strings.TrimSpace(timeStr)
+	clockEnd := strings.IndexFunc(timeStr, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != ':' && r != '.' && r != 'h' && r != 'H'
+	})
+	if clockEnd < 0 {
+		return strings.ToLower(timeStr)
+	}
+	clock, marker := strings.ToLower(timeStr[:clockEnd]), strings.TrimFunc(timeStr[clockEnd:], unicode.IsSpace)
+
+	marker = strings.Map(func(r rune) rune {
+		if r == '.' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, marker)
+	switch marker {
+	case "\u0635":
+		marker = "AM"
+	case "\u0645":
+		marker = "PM"
+	}
+	if marker == "" {
+		return clock
+	}
+	return clock + " " + marker
+}
+
+func sniffTimestampLayouts(reader io.Reader, allLayouts []string, maxLines int, maxLineBytes int) ([]string, error) {
+	scanner := NewLineReader(reader, maxLineBytes)
+	var sampleLines []string
+	linesRead := 0
+
+	for (maxLines <= 0 || linesRead < maxLines) && scanner.Scan() {
+		line := scanner.Text()
+		trimmedLine := strings.TrimSpace(line)
+		trimmedLine = strings.TrimPrefix(trimmedLine, "\u200e")
+
+		if timestampPattern.MatchString(trimmedLine) {
+			sampleLines = append(sampleLines, trimmedLine)
+		}
+		linesRead++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading lines for sniffing: %w", err)
+	}
+
+	if len(sampleLines) == 0 {
+		// log.Printf("Warning: No lines matched the general timestamp pattern during sniffing in the first %d lines. Cannot determine specific layout.", maxLines)
+		return nil, fmt.Errorf("no valid timestamp lines found in the first %d lines to sniff format from", maxLines)
+	}
+
+	candidateLayouts := make([]string, len(allLayouts))
+	copy(candidateLayouts, allLayouts)
+
+	actualTimestampsProcessed := 0
+
+	for _, line := range sampleLines {
+		if len(candidateLayouts) == 0 {
+			break
+		}
+
+		match := timestampPattern.FindStringSubmatch(line)
+		if match == nil || len(match) != 5 {
+			continue
+		}
+		actualTimestampsProcessed++
+
+		dateStr := strings.TrimSpace(match[1])
+		timeStr := strings.TrimSpace(match[2])
+		datetimeStr := dateStr + " " + normalizeTimeToken(timeStr)
+
+		currentlyValidLayouts := []string{}
+		for _, layout := range candidateLayouts {
+			_, err := time.Parse(layout, datetimeStr)
+			if err == nil {
+				currentlyValidLayouts = append(currentlyValidLayouts, layout)
+			}
+		}
+		candidateLayouts = currentlyValidLayouts
+	}
+
+	if actualTimestampsProcessed == 0 {
+		log.Println("Warning: No actual timestamps were successfully parsed from the sampled lines.")
+		return nil, fmt.Errorf("no timestamp lines could be parsed with any layout from the sample")
+	}
+
+	if len(candidateLayouts) == 0 {
+		// log.Printf("Sniffing failed: No layout consistently parsed %d sampled timestamp lines.", actualTimestampsProcessed)
+		return nil, fmt.Errorf("no timestamp layout consistently parsed the sample data")
+	}
+
+	if len(candidateLayouts) > 1 {
+		// log.Printf("Multiple layouts (%d) are consistent with sniffed data: %v. Applying prioritization.", len(candidateLayouts), candidateLayouts)
+
+		var europeanStyleLayouts []string
+		var usStyleLayouts []string
+
+		for _, layout := range candidateLayouts {
+			switch layoutDateOrder(layout) {
+			case DateOrderDayFirst:
+				europeanStyleLayouts = append(europeanStyleLayouts, layout)
+			case DateOrderMonthFirst:
+				usStyleLayouts = append(usStyleLayouts, layout)
+			}
+		}
+
+		if len(europeanStyleLayouts) > 0 {
+			// Both orders fitting the sample is settled over the whole file by
+			// resolveDateOrder; European stays first so it wins a tie.
+			// log.Printf("Prioritizing European-style (d/m or dd/mm) layouts as they are among consistent options: %v", europeanStyleLayouts)
+			return append(europeanStyleLayouts, usStyleLayouts...), nil
+		}
+		if len(usStyleLayouts) > 0 {
+			// log.Printf("Using US-style (m/d or mm/dd) layouts as they are the only consistent options: %v", usStyleLayouts)
+			return usStyleLayouts, nil
+		}
+
+		// log.Printf("Could not strongly prioritize among consistent layouts. Using all: %v", candidateLayouts)
+		return candidateLayouts, nil
+	}
+
+	log.Printf("Determined single consistent timestamp layout(s): %v", candidateLayouts)
+	return candidateLayouts, nil
+}
+
+// Date orders a DateOrderDecision chooses between.
+const (
+	DateOrderDayFirst   = "day_first"
+	DateOrderMonthFirst = "month_first"
+)
+
+// layoutDateOrder reports whether a layout reads the day or the month first.
+func layoutDateOrder(layout string) string {
+	switch {
+	case strings.HasPrefix(layout, "2/1/") || strings.HasPrefix(layout, "02/01/") || strings.HasPrefix(layout, "2.1."):
+		return DateOrderDayFirst
+	case strings.HasPrefix(layout, "1/2/") || strings.HasPrefix(layout, "01/02/"):
+		return DateOrderMonthFirst
+	}
+	return ""
+}
+
+// DateOrderDecision records how an ambiguous day/month order was settled.
+// Violations counts timestamps earlier than the one before them when read in
+// that order; Unparsed counts those that are not a valid date at all.
+type DateOrderDecision struct {
+	Chosen     string               `json:"chosen"`
+	Candidates []DateOrderCandidate `json:"candidates"`
+}
+
+type DateOrderCandidate struct {
+	Order      string `json:"order"`
+	Violations int    `json:"violations"`
+	Unparsed   int    `json:"unparsed"`
+}
+
+// resolveDateOrder settles exports whose sniffed sample fits both dd/mm and
+// mm/dd. Every timestamp in the file is read under each order and the one
+// that fails to parse the fewest lines, then goes back in time the fewest
+// times, is kept. A tie keeps day-first. The decision is returned for the
+// diagnostics; it is nil when the layouts were never ambiguous.
+func resolveDateOrder(buf []byte, layouts []string, maxLineBytes int) ([]string, *DateOrderDecision) {
+	byOrder := make(map[string][]string)
+	for _, layout := range layouts {
+		order := layoutDateOrder(layout)
+		byOrder[order] = append(byOrder[order], layout)
+	}
+	if len(byOrder[DateOrderDayFirst]) == 0 || len(byOrder[DateOrderMonthFirst]) == 0 {
+		return layouts, nil
+	}
+
+	candidates := []DateOrderCandidate{{Order: DateOrderDayFirst}, {Order: DateOrderMonthFirst}}
+	previous := make([]time.Time, len(candidates))
+	scanner := NewLineReader(bytes.NewReader(buf), maxLineBytes)
+	for scanner.Scan() {
+		match := timestampPattern.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match == nil {
+			continue
+		}
+		for i := range candidates {
+			timestamp, ok := ParseTimestamp(match[1], match[2], byOrder[candidates[i].Order])
+			if !ok {
+				candidates[i].Unparsed++
+				continue
+			}
+			if timestamp.Before(previous[i]) {
+				candidates[i].Violations++
+			}
+			previous[i] = timestamp
+		}
+	}
+
+	chosen := candidates[0]
+	if other := candidates[1]; other.Unparsed < chosen.Unparsed || (other.Unparsed == chosen.Unparsed && other.Violations < chosen.Violations) {
+		chosen = other
+	}
+	log.Printf("Timestamps fit both date orders; using %s (day-first: %d unparsed, %d out of order; month-first: %d unparsed, %d out of order).",
+		chosen.Order, candidates[0].Unparsed, candidates[0].Violations, candidates[1].Unparsed, candidates[1].Violations)
+	return append(byOrder[chosen.Order], byOrder[""]...), &DateOrderDecision{Chosen: chosen.Order, Candidates: candidates}
+}
+
+// LayoutDetection is what DetectLayouts settled on for an export. Guessed is
+// set when sniffing failed and Layouts holds every known layout, to be tried
+// line by line; Ambiguous when day-first and month-first fit equally well and
+// day-first was assumed. DateOrder is nil unless the sample fit both orders.
+type LayoutDetection struct {
+	Layouts   []string
+	DateOrder *DateOrderDecision
+	Guessed   bool
+	Ambiguous bool
+}
+
+// DetectLayouts sniffs the timestamp layouts a whole export is written in,
+// falling back to every known layout when sniffing fails.
+func DetectLayouts(buf []byte, maxLineBytes int) (LayoutDetection, error) {
+	layouts, err := sniffTimestampLayouts(bytes.NewReader(buf), timestampParseLayouts, maxLinesToSniff, maxLineBytes)
+	if err != nil || len(layouts) == 0 {
+		log.Printf("Warning: Timestamp sniffing failed (%v) or returned no layouts. Falling back to all %d global layouts.", err, len(timestampParseLayouts))
+		if len(timestampParseLayouts) == 0 {
+			return LayoutDetection{}, errors.New("no timestamp layouts available even in global list")
+		}
+		return LayoutDetection{Layouts: Layouts(), Guessed: true}, nil
+	}
+
+	layouts, dateOrder := resolveDateOrder(buf, layouts, maxLineBytes)
+	detection := LayoutDetection{Layouts: layouts, DateOrder: dateOrder}
+	if dateOrder != nil && dateOrder.Candidates[0].Violations == dateOrder.Candidates[1].Violations &&
+		dateOrder.Candidates[0].Unparsed == dateOrder.Candidates[1].Unparsed {
+		detection.Ambiguous = true
+	}
+	log.Printf("Using determined timestamp layouts for parsing: %v", layouts)
+	return detection, nil
+}
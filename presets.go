@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	presetsFile = "presets.json"
+	presetField = "preset"
+)
+
+// presetFields are the analysis form fields a preset may set. Anything the
+// client sends itself still wins over the preset.
+var presetFields = map[string]bool{
+	"tone":                true,
+	"ai_model":            true,
+	"ai_roles":            true,
+	"keep_names":          true,
+	"exclude_bots":        true,
+	"collapse_forwards":   true,
+	"profanity":           true,
+	"denylist":            true,
+	"keywords":            true,
+	"digest":              true,
+	"digest_ai":           true,
+	"strict":              true,
+	"convo_break_minutes": true,
+	"format":              true,
+}
+
+// analysisPresets maps a preset name to the form values it stands for.
+var analysisPresets map[string]map[string]string
+
+func init() {
+	loadPresetData()
+}
+
+func loadPresetData() {
+	var err error
+	analysisPresets, err = loadPresets(filepath.Join(dataDir, presetsFile))
+	if err != nil {
+		log.Printf("Warning: Failed to load analysis presets: %v. The preset field will be rejected.", err)
+		analysisPresets = map[string]map[string]string{}
+	}
+}
+
+func loadPresets(filepath string) (map[string]map[string]string, error) {
+	file, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read presets file '%s': %w", filepath, err)
+	}
+
+	var raw map[string]map[string]interface{}
+	if err := json.Unmarshal(file, &raw); err != nil {
+		return nil, fmt.Errorf("could not decode JSON from '%s': %w", filepath, err)
+	}
+
+	presets := make(map[string]map[string]string, len(raw))
+	for name, settings := range raw {
+		values := make(map[string]string, len(settings))
+		for field, value := range settings {
+			if !presetFields[field] {
+				log.Printf("Warning: Ignoring unknown field '%s' in preset '%s' in %s", field, name, filepath)
+				continue
+			}
+			switch v := value.(type) {
+			case string, bool, float64:
+				values[field] = fmt.Sprint(v)
+			default:
+				log.Printf("Warning: Ignoring field '%s' in preset '%s' in %s: use a string, number or boolean", field, name, filepath)
+			}
+		}
+		presets[name] = values
+	}
+	log.Printf("Loaded %d analysis presets from %s", len(presets), filepath)
+	return presets, nil
+}
+
+// applyPreset fills the form fields the client left out from the named
+// preset. It reports false for an unknown preset.
+func applyPreset(name string, fields map[string]string) bool {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+
+	values, ok := analysisPresets[name]
+	if !ok {
+		return false
+	}
+	for field, value := range values {
+		if _, set := fields[field]; !set {
+			fields[field] = value
+		}
+	}
+	return true
+}
+
+func presetNames() []string {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+
+	names := make([]string, 0, len(analysisPresets))
+	for name := range analysisPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
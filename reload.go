@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+var (
+	// dataMu guards everything reloadData replaces: word lists, phrase packs,
+	// stat thresholds, analysis presets, prompt templates and the Groq
+	// settings. Parsing and stats hold it for reading while they run; AI calls
+	// copy what they need through currentAISettings so a reload never waits
+	// on the network.
+	dataMu sync.RWMutex
+
+	// processEnvKeys are the variables set before .env was read. A reload
+	// only refreshes values that came from .env, so the process environment
+	// keeps priority just like at startup.
+	processEnvKeys = environmentKeys()
+)
+
+func environmentKeys() map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, kv := range os.Environ() {
+		if key, _, ok := strings.Cut(kv, "="); ok {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// reloadData re-reads .env and every data file under data/ and swaps them in
+// once the analyses currently parsing or computing stats have finished with
+// the old ones. Analyses waiting on the AI keep going with the settings they
+// started with. Server settings such as the port or concurrency limits still
+// need a restart.
+func reloadData() {
+	log.Println("Reloading data files and AI settings...")
+
+	values, err := godotenv.Read()
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Could not re-read .env file: %v", err)
+	}
+	for key, value := range values {
+		if _, fromProcess := processEnvKeys[key]; !fromProcess {
+			os.Setenv(key, value)
+		}
+	}
+
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	loadTextData()
+	loadSentimentData()
+	loadLaughterData()
+	loadReminderData()
+	loadBotData()
+	loadBirthdayData()
+	loadProfanityData()
+	loadPolitenessData()
+	loadAffectionData()
+	loadRoleData()
+	loadThresholdData()
+	loadPresetData()
+	loadAISettings()
+	log.Println("Reload complete.")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+)
+
+const (
+	storageBackendLocal = "local"
+	storageBackendS3    = "s3"
+	storageBackendGCS   = "gcs"
+
+	storageTimeout = 30 * time.Second
+)
+
+var (
+	errObjectNotFound = errors.New("object not found")
+
+	// analysisIDPattern matches IDs made by newAnalysisID, so a client-supplied
+	// ID can never escape the results prefix.
+	analysisIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// ObjectStore persists uploads and analysis results by key. Keys are slash
+// separated, e.g. "results/<id>.json".
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// newObjectStore builds the configured backend, or returns nil when storage is
+// disabled.
+func newObjectStore(cfg StorageConfig) (ObjectStore, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case storageBackendLocal:
+		return newLocalStore(cfg.LocalDir)
+	case storageBackendS3, storageBackendGCS:
+		return newS3Store(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend '%s'", cfg.Backend)
+	}
+}
+
+func newAnalysisID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func resultKey(id string) string  { return "results/" + id + ".json" }
+func uploadKey(id string) string  { return "uploads/" + id + ".txt" }
+func wrappedKey(id string) string { return "wrapped/" + id + ".gif" }
+
+// persistAnalysis stores the result, and the uploaded chat when the user opted
+// in, under a fresh analysis ID. The ID is only set on the result once the
+// result itself is stored, so clients never get an ID they cannot fetch.
+// Failures are logged and leave the response otherwise untouched.
+func persistAnalysis(ctx context.Context, store ObjectStore, results *AnalysisResult, upload []byte, logPrefix string) {
+	id, err := newAnalysisID()
+	if err != nil {
+		log.Printf("%s Could not generate analysis ID: %v", logPrefix, err)
+		return
+	}
+	storeAnalysis(ctx, store, id, results, upload, logPrefix)
+}
+
+// storeAnalysis is persistAnalysis for an ID handed out earlier, as detached
+// analyses do.
+func storeAnalysis(ctx context.Context, store ObjectStore, id string, results *AnalysisResult, upload []byte, logPrefix string) {
+	ctx, cancel := context.WithTimeout(ctx, storageTimeout)
+	defer cancel()
+
+	if upload != nil {
+		if err := store.Put(ctx, uploadKey(id), upload, "text/plain; charset=utf-8"); err != nil {
+			log.Printf("%s Failed to store upload: %v", logPrefix, err)
+			return
+		}
+	}
+
+	results.ID = id
+	data, err := json.Marshal(results)
+	if err != nil {
+		results.ID = ""
+		log.Printf("%s Could not encode result for storage: %v", logPrefix, err)
+		return
+	}
+	if err := store.Put(ctx, resultKey(id), data, "application/json"); err != nil {
+		results.ID = ""
+		log.Printf("%s Failed to store result: %v", logPrefix, err)
+		return
+	}
+	log.Printf("%s Stored analysis %s (upload saved: %t)", logPrefix, id, upload != nil)
+}
+
+// loadStoredResult reads and decodes a stored analysis result. A missing
+// result is reported as errObjectNotFound.
+func loadStoredResult(ctx context.Context, store ObjectStore, id string) (*AnalysisResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, storageTimeout)
+	defer cancel()
+
+	data, err := store.Get(ctx, resultKey(id))
+	if err != nil {
+		return nil, err
+	}
+	var result AnalysisResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("could not decode stored result: %w", err)
+	}
+	return &result, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -24,7 +25,9 @@ func runPeriodicTempCleanup(ctx context.Context, dir string, maxAge time.Duratio
 	}
 }
 
-func cleanupTempFiles(dir string, maxAge time.Duration) {
+// cleanupTempFiles removes files in dir older than maxAge and reports how
+// many it removed and how many bytes that freed.
+func cleanupTempFiles(dir string, maxAge time.Duration) (removed int, freedBytes int64, err error) {
 	log.Printf("Running periodic temp file cleanup in %s...", dir)
 	now := time.Now()
 	count := 0
@@ -34,10 +37,10 @@ func cleanupTempFiles(dir string, maxAge time.Duration) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.Printf("Temp directory %s does not exist, skipping cleanup.", dir)
-			return
+			return 0, 0, nil
 		}
 		log.Printf("Error reading temp directory %s: %v", dir, err)
-		return
+		return 0, 0, err
 	}
 
 	for _, entry := range entries {
@@ -72,4 +75,20 @@ func cleanupTempFiles(dir string, maxAge time.Duration) {
 	} else {
 		log.Println("Periodic cleanup found no old files to remove.")
 	}
+	return count, totalSize, nil
+}
+
+// saveUploadForDebug writes an upload to the temp dir so a failing chat can be
+// inspected later; the periodic cleanup removes it after the max temp file age.
+func saveUploadForDebug(dir string, filename string, data []byte) (string, error) {
+	file, err := os.CreateTemp(dir, "upload-*-"+filepath.Base(filename))
+	if err != nil {
+		return "", fmt.Errorf("could not create debug upload file in '%s': %w", dir, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return "", fmt.Errorf("could not write debug upload file '%s': %w", file.Name(), err)
+	}
+	return file.Name(), nil
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	watchProcessedDir = "processed"
+	watchFailedDir    = "failed"
+)
+
+// startWatchers launches the configured drop-folder and IMAP watchers. They
+// stop when ctx is cancelled; wait on wg before closing the AI task queue.
+func startWatchers(ctx context.Context, cfg WatchConfig, wg *sync.WaitGroup) error {
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("could not create watch output directory '%s': %w", cfg.OutputDir, err)
+	}
+
+	if cfg.Dir != "" {
+		for _, sub := range []string{watchProcessedDir, watchFailedDir} {
+			if err := os.MkdirAll(filepath.Join(cfg.Dir, sub), 0755); err != nil {
+				return fmt.Errorf("could not create '%s' in watch directory: %w", sub, err)
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runDirectoryWatcher(ctx, cfg)
+		}()
+	}
+	if cfg.IMAPHost != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runIMAPWatcher(ctx, cfg)
+		}()
+	}
+	return nil
+}
+
+type fileSnapshot struct {
+	size    int64
+	modTime time.Time
+}
+
+// runDirectoryWatcher polls the drop folder. A file is only picked up once its
+// size and modification time are unchanged between two polls, so exports that
+// are still being copied in are left alone. Processed files are moved to
+// processed/ or failed/ next to them.
+func runDirectoryWatcher(ctx context.Context, cfg WatchConfig) {
+	log.Printf("Watching %s for chat exports every %s", cfg.Dir, cfg.Interval)
+	seen := make(map[string]fileSnapshot)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		entries, err := os.ReadDir(cfg.Dir)
+		if err != nil {
+			log.Printf("Watcher: could not read %s: %v", cfg.Dir, err)
+		}
+
+		current := make(map[string]fileSnapshot)
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name()), ".txt") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			snapshot := fileSnapshot{size: info.Size(), modTime: info.ModTime()}
+			if previous, ok := seen[entry.Name()]; !ok || previous != snapshot {
+				current[entry.Name()] = snapshot
+				continue
+			}
+			processDroppedFile(ctx, cfg, entry.Name())
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		seen = current
+
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping directory watcher.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func processDroppedFile(ctx context.Context, cfg WatchConfig, name string) {
+	path := filepath.Join(cfg.Dir, name)
+	destDir := watchProcessedDir
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = analyzeToReport(ctx, cfg.OutputDir, name, data)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// Shutting down; leave the file to be picked up on the next start.
+			return
+		}
+		log.Printf("Watcher: analysis of %s failed: %v", name, err)
+		destDir = watchFailedDir
+		errPath := filepath.Join(cfg.Dir, destDir, name+".error.txt")
+		if writeErr := os.WriteFile(errPath, []byte(err.Error()+"\n"), 0644); writeErr != nil {
+			log.Printf("Watcher: could not write %s: %v", errPath, writeErr)
+		}
+	}
+
+	if err := os.Rename(path, filepath.Join(cfg.Dir, destDir, name)); err != nil {
+		log.Printf("Watcher: could not move %s to %s/: %v", name, destDir, err)
+	}
+}
+
+// analyzeToReport runs the same analysis as POST /analyze/ with default options
+// and writes the result as an offline bundle the frontend can import.
+func analyzeToReport(ctx context.Context, outputDir string, name string, data []byte) error {
+	if int64(len(data)) > config.MaxUploadSizeBytes {
+		return fmt.Errorf("file is %d bytes, over the %d byte upload limit", len(data), config.MaxUploadSizeBytes)
+	}
+
+	analysisCtx, cancel := context.WithTimeout(ctx, config.AnalysisTimeout)
+	defer cancel()
+	results, err := AnalyzeChat(analysisCtx, bytes.NewReader(data), name, aiTaskQueue, currentAIQueueTimeout(), config.MaxLineBytes, AnalysisOptions{})
+	if err != nil {
+		return err
+	}
+	if err := analysisCtx.Err(); err != nil {
+		return err
+	}
+
+	bundle, err := buildAnalysisBundle(results, time.Now())
+	if err != nil {
+		return err
+	}
+	reportName := strings.TrimSuffix(name, filepath.Ext(name)) + ".bloop.json"
+	reportPath := filepath.Join(outputDir, reportName)
+	if err := os.WriteFile(reportPath, bundle, 0644); err != nil {
+		return fmt.Errorf("could not write report: %w", err)
+	}
+	log.Printf("Watcher: wrote report for %s (%d messages) to %s", name, results.TotalMessages, reportPath)
+	return nil
+}
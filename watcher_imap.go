@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapCommandTimeout bounds each command, not the session, since a poll can
+// spend minutes analysing exports between commands.
+const imapCommandTimeout = 2 * time.Minute
+
+// runIMAPWatcher polls the inbox for unseen mail and analyses every .txt chat
+// export attached to it, the format WhatsApp's "Export chat > Without media"
+// produces when sent by email. Each message is marked seen once handled, or
+// once skipped as too large or unreadable, so a failing export is reported
+// once rather than retried forever.
+func runIMAPWatcher(ctx context.Context, cfg WatchConfig) {
+	log.Printf("Watching IMAP folder %s on %s every %s", cfg.IMAPFolder, cfg.IMAPHost, cfg.Interval)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := pollIMAPInbox(ctx, cfg); err != nil && ctx.Err() == nil {
+			log.Printf("IMAP watcher: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping IMAP watcher.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func pollIMAPInbox(ctx context.Context, cfg WatchConfig) error {
+	conn, err := dialIMAP(ctx, cfg.IMAPHost)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	if _, err := conn.command("LOGIN %s %s", imapQuote(cfg.IMAPUser), imapQuote(cfg.IMAPPassword)); err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	if _, err := conn.command("SELECT %s", imapQuote(cfg.IMAPFolder)); err != nil {
+		return fmt.Errorf("could not select %s: %w", cfg.IMAPFolder, err)
+	}
+
+	responses, err := conn.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return fmt.Errorf("search failed: %w", err)
+	}
+	var uids []string
+	for _, resp := range responses {
+		if fields := strings.Fields(resp.line); len(fields) > 2 && fields[1] == "SEARCH" {
+			uids = append(uids, fields[2:]...)
+		}
+	}
+
+	for _, uid := range uids {
+		if _, err := strconv.ParseUint(uid, 10, 32); err != nil {
+			continue
+		}
+		if err := handleIMAPMessage(ctx, conn, cfg, uid); err != nil && ctx.Err() == nil {
+			log.Printf("IMAP watcher: skipping message %s: %v", uid, err)
+			writeIMAPError(cfg, fmt.Sprintf("imap-%s", uid), err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if _, err := conn.command("UID STORE %s +FLAGS.SILENT (\\Seen)", uid); err != nil {
+			return fmt.Errorf("could not mark message %s as seen: %w", uid, err)
+		}
+	}
+
+	conn.command("LOGOUT")
+	return nil
+}
+
+// handleIMAPMessage fetches one message and analyses its exports. A message
+// too large to hold as an upload is refused by its RFC822.SIZE before its
+// body is fetched.
+func handleIMAPMessage(ctx context.Context, conn *imapConn, cfg WatchConfig, uid string) error {
+	responses, err := conn.command("UID FETCH %s (RFC822.SIZE)", uid)
+	if err != nil {
+		return fmt.Errorf("size fetch failed: %w", err)
+	}
+	size := int64(-1)
+	for _, resp := range responses {
+		if _, rest, ok := strings.Cut(resp.line, "RFC822.SIZE "); ok {
+			digits := strings.TrimRight(rest, ")")
+			if end := strings.IndexByte(digits, ' '); end >= 0 {
+				digits = digits[:end]
+			}
+			if n, err := strconv.ParseInt(digits, 10, 64); err == nil {
+				size = n
+			}
+		}
+	}
+	if size < 0 {
+		return errors.New("server did not report its size")
+	}
+	if size > maxIMAPMessageBytes() {
+		return fmt.Errorf("message is %d bytes, over the %d byte limit", size, maxIMAPMessageBytes())
+	}
+
+	responses, err = conn.command("UID FETCH %s (BODY.PEEK[])", uid)
+	if err != nil {
+		return fmt.Errorf("fetch failed: %w", err)
+	}
+	for _, resp := range responses {
+		if len(resp.literals) > 0 {
+			processMailedExports(ctx, cfg, uid, resp.literals[0])
+			return nil
+		}
+	}
+	return errors.New("server returned no body")
+}
+
+// maxIMAPMessageBytes is the largest message fetched: an upload-sized
+// export, with room for base64 and the rest of the mail.
+func maxIMAPMessageBytes() int64 {
+	return config.MaxUploadSizeBytes * 2
+}
+
+// writeIMAPError leaves err next to the reports as name.error.txt.
+func writeIMAPError(cfg WatchConfig, name string, err error) {
+	errPath := filepath.Join(cfg.OutputDir, name+".error.txt")
+	if writeErr := os.WriteFile(errPath, []byte(err.Error()+"\n"), 0644); writeErr != nil {
+		log.Printf("IMAP watcher: could not write %s: %v", errPath, writeErr)
+	}
+}
+
+func processMailedExports(ctx context.Context, cfg WatchConfig, uid string, raw []byte) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		log.Printf("IMAP watcher: could not parse message %s: %v", uid, err)
+		return
+	}
+	attachments, err := chatAttachments(msg.Header, msg.Body)
+	if err != nil {
+		log.Printf("IMAP watcher: could not read attachments of message %s: %v", uid, err)
+	}
+	if len(attachments) == 0 {
+		log.Printf("IMAP watcher: message %s has no .txt chat export, skipping.", uid)
+		return
+	}
+
+	for _, attachment := range attachments {
+		name := fmt.Sprintf("imap-%s-%s", uid, attachment.filename)
+		if err := analyzeToReport(ctx, cfg.OutputDir, name, attachment.data); err != nil && ctx.Err() == nil {
+			log.Printf("IMAP watcher: analysis of %s failed: %v", name, err)
+			writeIMAPError(cfg, name, err)
+		}
+	}
+}
+
+type mailAttachment struct {
+	filename string
+	data     []byte
+}
+
+// partHeader is satisfied by both mail.Header and textproto.MIMEHeader.
+type partHeader interface {
+	Get(key string) string
+}
+
+// chatAttachments walks a MIME body and returns the decoded .txt attachments.
+func chatAttachments(header partHeader, body io.Reader) ([]mailAttachment, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var attachments []mailAttachment
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return attachments, nil
+			}
+			if err != nil {
+				return attachments, err
+			}
+			nested, err := chatAttachments(part.Header, part)
+			attachments = append(attachments, nested...)
+			if err != nil {
+				return attachments, err
+			}
+		}
+	}
+
+	filename := params["name"]
+	if _, dispParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && dispParams["filename"] != "" {
+		filename = dispParams["filename"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	filename = filepath.Base(filename)
+	if !strings.HasSuffix(strings.ToLower(filename), ".txt") {
+		return nil, nil
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, config.MaxUploadSizeBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	return []mailAttachment{{filename: filename, data: data}}, nil
+}
+
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+func dialIMAP(ctx context.Context, addr string) (*imapConn, error) {
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: 30 * time.Second}}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.line, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected IMAP greeting: %s", greeting.line)
+	}
+	return c, nil
+}
+
+func (c *imapConn) close() {
+	c.conn.Close()
+}
+
+// command sends a tagged command and collects the untagged responses until the
+// tagged completion, which must be OK.
+func (c *imapConn) command(format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	c.conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+
+	var responses []imapResponse
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if rest, ok := strings.CutPrefix(resp.line, tag+" "); ok {
+			if !strings.HasPrefix(rest, "OK") {
+				return nil, errors.New(rest)
+			}
+			return responses, nil
+		}
+		responses = append(responses, resp)
+	}
+}
+
+// readResponse reads one response line, including any {n} literals it carries.
+func (c *imapConn) readResponse() (imapResponse, error) {
+	var resp imapResponse
+	var line strings.Builder
+	for {
+		part, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		part = strings.TrimRight(part, "\r\n")
+		line.WriteString(part)
+
+		open := strings.LastIndexByte(part, '{')
+		if open < 0 || !strings.HasSuffix(part, "}") {
+			break
+		}
+		size, err := strconv.ParseInt(part[open+1:len(part)-1], 10, 64)
+		if err != nil || size < 0 {
+			break
+		}
+		if size > maxIMAPMessageBytes() {
+			return resp, fmt.Errorf("IMAP literal of %d bytes is too large", size)
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, literal)
+	}
+	resp.line = line.String()
+	return resp, nil
+}
+
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	wrappedWidth  = 360
+	wrappedHeight = 640
+	// wrappedSlideDelay is how long each slide shows, in hundredths of a
+	// second.
+	wrappedSlideDelay = 250
+	wrappedMaxSlides  = 8
+
+	wrappedTitleScale  = 3
+	wrappedValueScale  = 6
+	wrappedDetailScale = 3
+)
+
+// Palette indexes for the slides.
+const (
+	wrappedBackground uint8 = iota
+	wrappedForeground
+	wrappedAccent
+	wrappedMuted
+)
+
+var wrappedPalette = color.Palette{
+	color.RGBA{0x11, 0x1b, 0x21, 0xff},
+	color.RGBA{0xff, 0xff, 0xff, 0xff},
+	color.RGBA{0x25, 0xd3, 0x66, 0xff},
+	color.RGBA{0x8a, 0x96, 0x9c, 0xff},
+}
+
+// wrappedSlide is one frame: a small heading, a big value and a line of
+// detail under it.
+type wrappedSlide struct {
+	title  string
+	value  string
+	detail string
+}
+
+// wrappedSlides picks the headline numbers of a result. Slides whose stat
+// was omitted for the chat are skipped.
+func wrappedSlides(result *AnalysisResult) []wrappedSlide {
+	slides := []wrappedSlide{{title: "Chat wrapped", value: "Bloop", detail: result.ChatName}}
+	stats := result.Stats
+	if stats == nil {
+		return slides
+	}
+
+	slides = append(slides, wrappedSlide{
+		title:  "Messages sent",
+		value:  formatThousands(stats.TotalMessages),
+		detail: fmt.Sprintf("over %s", countNoun(stats.DaysActive, "active day")),
+	})
+	if top := topCountChampion(stats.UserMessageCount); top != nil {
+		slides = append(slides, wrappedSlide{title: "Top texter", value: top.User, detail: countNoun(top.Count, "message")})
+	}
+	if stats.PeakHour != nil {
+		slides = append(slides, wrappedSlide{title: "Peak hour", value: fmt.Sprintf("%02d:00", *stats.PeakHour), detail: "when the chat is busiest"})
+	}
+	if word := topCountChampion(UserMessageCount(stats.CommonWords)); word != nil {
+		slides = append(slides, wrappedSlide{title: "Word of the chat", value: word.User, detail: "used " + countNoun(word.Count, "time")})
+	}
+	if stats.ConversationKiller != nil {
+		slides = append(slides, wrappedSlide{title: "Conversation killer", value: stats.ConversationKiller.User, detail: "had the last word " + countNoun(stats.ConversationKiller.Count, "time")})
+	}
+	if stats.AverageResponseTimeMinutes != nil {
+		slides = append(slides, wrappedSlide{title: "Average reply", value: fmt.Sprintf("%.0f min", *stats.AverageResponseTimeMinutes), detail: "between different people"})
+	}
+	if stats.ChatHealth != nil {
+		slides = append(slides, wrappedSlide{title: "Chat health", value: fmt.Sprintf("%d/100", stats.ChatHealth.Score), detail: "balance, replies, recency, mood"})
+	}
+	return slides[:min(len(slides), wrappedMaxSlides)]
+}
+
+// renderWrappedGIF draws the slides as a looping vertical GIF sized for
+// stories and status updates.
+func renderWrappedGIF(result *AnalysisResult) ([]byte, error) {
+	slides := wrappedSlides(result)
+	animation := &gif.GIF{LoopCount: 0}
+	for i, slide := range slides {
+		frame := image.NewPaletted(image.Rect(0, 0, wrappedWidth, wrappedHeight), wrappedPalette)
+		drawWrappedSlide(frame, slide)
+		drawWrappedProgress(frame, i, len(slides))
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, wrappedSlideDelay)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		return nil, fmt.Errorf("could not encode wrapped GIF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func drawWrappedSlide(frame *image.Paletted, slide wrappedSlide) {
+	title := wrapWrappedText(slide.title, wrappedTitleScale)
+	value := wrapWrappedText(slide.value, wrappedValueScale)
+	detail := wrapWrappedText(slide.detail, wrappedDetailScale)
+
+	gap := 8 * wrappedTitleScale
+	height := textBlockHeight(title, wrappedTitleScale) + gap + textBlockHeight(value, wrappedValueScale) + gap + textBlockHeight(detail, wrappedDetailScale)
+	y := (wrappedHeight - height) / 2
+	y = drawTextBlock(frame, title, y, wrappedTitleScale, wrappedMuted) + gap
+	y = drawTextBlock(frame, value, y, wrappedValueScale, wrappedAccent) + gap
+	drawTextBlock(frame, detail, y, wrappedDetailScale, wrappedForeground)
+}
+
+// drawWrappedProgress draws story-style segments along the top edge.
+func drawWrappedProgress(frame *image.Paletted, current, total int) {
+	const margin, spacing, top, thickness = 16, 6, 20, 4
+	segment := (wrappedWidth - 2*margin - (total-1)*spacing) / total
+	for i := 0; i < total; i++ {
+		colorIndex := wrappedMuted
+		if i <= current {
+			colorIndex = wrappedForeground
+		}
+		x0 := margin + i*(segment+spacing)
+		fillRect(frame, x0, top, x0+segment, top+thickness, colorIndex)
+	}
+}
+
+// wrapWrappedText turns text into the lines the bitmap font can draw at the
+// given scale: accents are stripped, letters upper-cased, emoji dropped and
+// anything else without a glyph shown as "?". Lines are broken at spaces, and
+// a word too long for a line is cut short.
+func wrapWrappedText(text string, scale int) []string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		r = unicode.ToUpper(r)
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		case unicode.Is(unicode.So, r) || unicode.Is(unicode.Sk, r) || unicode.Is(unicode.Cf, r):
+		default:
+			if _, ok := wrappedFont[r]; !ok {
+				r = '?'
+			}
+			b.WriteRune(r)
+		}
+	}
+
+	maxChars := (wrappedWidth - 32) / ((wrappedGlyphWidth + 1) * scale)
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(b.String()) {
+		if len(word) > maxChars {
+			word = word[:maxChars-1] + "."
+		}
+		switch {
+		case line == "":
+			line = word
+		case len(line)+1+len(word) <= maxChars:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func textBlockHeight(lines []string, scale int) int {
+	if len(lines) == 0 {
+		return 0
+	}
+	return len(lines)*(wrappedGlyphHeight+3)*scale - 3*scale
+}
+
+// drawTextBlock draws each line centred and returns the y below the block.
+func drawTextBlock(frame *image.Paletted, lines []string, y, scale int, colorIndex uint8) int {
+	for _, line := range lines {
+		width := len(line)*(wrappedGlyphWidth+1)*scale - scale
+		x := (wrappedWidth - width) / 2
+		for _, r := range line {
+			glyph := wrappedFont[r]
+			for row, bits := range glyph {
+				for col := 0; col < wrappedGlyphWidth; col++ {
+					if bits&(1<<(wrappedGlyphWidth-1-col)) != 0 {
+						px, py := x+col*scale, y+row*scale
+						fillRect(frame, px, py, px+scale, py+scale, colorIndex)
+					}
+				}
+			}
+			x += (wrappedGlyphWidth + 1) * scale
+		}
+		y += (wrappedGlyphHeight + 3) * scale
+	}
+	if len(lines) > 0 {
+		y -= 3 * scale
+	}
+	return y
+}
+
+func fillRect(frame *image.Paletted, x0, y0, x1, y1 int, colorIndex uint8) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			frame.SetColorIndex(x, y, colorIndex)
+		}
+	}
+}
+
+// formatThousands writes n with comma thousands separators.
+func formatThousands(n int) string {
+	if n < 0 {
+		return "-" + formatThousands(-n)
+	}
+	digits := strconv.Itoa(n)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return b.String()
+}